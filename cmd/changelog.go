@@ -0,0 +1,100 @@
+/*
+Copyright © 2023 Catalyst Squad <info@catalystcommunity.com>
+*/
+package cmd
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/catalystcommunity/app-utils-go/logging"
+	"github.com/catalystcommunity/semver-tags/core"
+	"github.com/spf13/cobra"
+)
+
+var changelogCmd = &cobra.Command{
+	Use:   "changelog [target...]",
+	Short: "Write a Markdown changelog of the releases of each release target",
+	Long: `Write a Markdown changelog of the releases of each release target.
+
+The command reads the version tags of each release target in semantic version
+order. Each release lists the conventional commits of the target after the
+release before it, grouped by type, with breaking changes first:
+
+  # api Changelog
+
+  ## [1.1.0](https://github.com/org/repo/compare/api/v1.0.0...api/v1.1.0) (2026-10-01)
+
+  ### Features
+
+  - **api:** add an endpoint ([abcdef1](https://github.com/org/repo/commit/abcdef1...))
+
+Name targets to write only their changelogs, in the order of the arguments.
+Use --from to list only the releases after one version tag; without named
+targets, only the target of that tag gets a changelog. Use --unreleased to add
+the commits after the last tag. Use --repo-url to link the releases and
+commits; in GitHub Actions it defaults to the current repository. Use --output
+to write a file instead of standard output, such as one CHANGELOG.md per
+target:
+
+  semver-tags changelog api --output services/api/CHANGELOG.md
+
+The command never writes a ref, so it does not take --fetch-tags or --deepen.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := initRunConfig(cmd)
+		if err != nil {
+			logging.Log.WithError(err).Error("error resolving configuration")
+			os.Exit(1)
+		}
+		options, output, err := changelogOptions(cmd, args)
+		if err != nil {
+			logging.Log.WithError(err).Error("error resolving configuration")
+			os.Exit(1)
+		}
+
+		changelogs, err := core.Changelogs(cmd.Context(), config, options)
+		if err != nil {
+			logging.Log.WithError(err).Error("error reading the releases")
+			os.Exit(1)
+		}
+		var text bytes.Buffer
+		if err := core.WriteChangelogs(&text, changelogs, config.RepoURL); err != nil {
+			logging.Log.WithError(err).Error("error writing the changelog")
+			os.Exit(1)
+		}
+		if output == "" {
+			_, err = os.Stdout.Write(text.Bytes())
+		} else {
+			err = os.WriteFile(output, text.Bytes(), 0o644)
+		}
+		if err != nil {
+			logging.Log.WithError(err).Error("error writing the changelog")
+			os.Exit(1)
+		}
+	},
+}
+
+// changelogOptions reads the changelog flags.
+func changelogOptions(cmd *cobra.Command, targets []string) (core.ChangelogOptions, string, error) {
+	options := core.ChangelogOptions{Targets: targets}
+	var err error
+	if options.From, err = cmd.Flags().GetString("from"); err != nil {
+		return core.ChangelogOptions{}, "", err
+	}
+	if options.Unreleased, err = cmd.Flags().GetBool("unreleased"); err != nil {
+		return core.ChangelogOptions{}, "", err
+	}
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return core.ChangelogOptions{}, "", err
+	}
+	return options, output, nil
+}
+
+func init() {
+	rootCmd.AddCommand(changelogCmd)
+	shareReadOnlyAnalysisFlags(changelogCmd, "repo-url")
+	changelogCmd.Flags().String("from", "", "list only the releases after this version tag")
+	changelogCmd.Flags().Bool("unreleased", false, "add the commits after the last version tag")
+	changelogCmd.Flags().String("output", "", "write the changelog to this file instead of standard output")
+}
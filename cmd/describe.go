@@ -0,0 +1,69 @@
+/*
+Copyright © 2023 Catalyst Squad <info@catalystcommunity.com>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/catalystcommunity/app-utils-go/logging"
+	"github.com/catalystcommunity/semver-tags/core"
+	"github.com/spf13/cobra"
+)
+
+var describeCmd = &cobra.Command{
+	Use:   "describe",
+	Short: "Print an untagged snapshot version for each release target",
+	Long: `Print an untagged snapshot version for each release target.
+
+The command runs the same analysis as run and prints one line for each
+release target, in the run output order. It never creates or pushes a tag, so
+a feature-branch build can use the version safely.
+
+The default go format makes a Go pseudo-version from the next version:
+
+  api/v1.3.0-0.20261017120000-abcdef123456
+
+The describe format makes a git describe version from the last release:
+
+  semver-tags describe --snapshot_format describe
+
+  api/v1.2.3-4-gabcdef
+
+A target without a release tag gives only the abbreviated HEAD commit.
+
+The go form sorts after the last release. The describe form is a
+pre-release of the last version, so semantic version order puts it before
+that release; use it to read, not to compare. Use run --snapshot to get the
+same values in the Snapshot_version output field.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := initRunConfig(cmd)
+		if err != nil {
+			logging.Log.WithError(err).Error("error resolving configuration")
+			os.Exit(1)
+		}
+		config.Snapshot = true
+		config.DryRun = true
+
+		results, err := core.AnalyzeReleases(cmd.Context(), config)
+		if err == nil {
+			// A snapshot of a blocked target would name a version that no
+			// release can have.
+			err = core.BlockedError(results)
+		}
+		if err != nil {
+			logging.Log.WithError(err).Error("error checking commits")
+			os.Exit(1)
+		}
+		for _, result := range results {
+			fmt.Println(result.SnapshotVersion)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(describeCmd)
+	shareAnalysisFlags(describeCmd, "snapshot_format")
+}
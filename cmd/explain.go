@@ -0,0 +1,86 @@
+/*
+Copyright © 2023 Catalyst Squad <info@catalystcommunity.com>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/catalystcommunity/app-utils-go/logging"
+	"github.com/catalystcommunity/semver-tags/core"
+	"github.com/spf13/cobra"
+)
+
+var explainCmd = &cobra.Command{
+	Use:   "explain [target...]",
+	Short: "Print how each release target gets its next version",
+	Long: `Print how each release target gets its next version.
+
+The command runs the same analysis as run and prints a trace for each release
+target, in the run output order:
+
+  target api
+    base: api/v1.2.0 at abcdef1
+      the highest version tag of the target
+    ignored: api/v1.1.0 at 1234567: it is lower than the base
+    commit 89abcde feat(api)!: drop the v1 routes
+      type=feat scope=api breaking=! paths=api
+      level major: a breaking marker makes a major release
+    bump: the highest level is major, from 89abcde "feat(api)!: drop the v1 routes"; 1.2.0 -> 2.0.0
+
+Name targets to print only their traces, in the order of the arguments. The
+command never writes a ref, so it does not take --fetch-tags or --deepen. Use
+run --explain to write the same trace to standard error during a release.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := initRunConfig(cmd)
+		if err != nil {
+			logging.Log.WithError(err).Error("error resolving configuration")
+			os.Exit(1)
+		}
+		config.DryRun = true
+		config.FetchTags = false
+		config.Deepen = false
+		config.Explain = true
+
+		results, err := core.AnalyzeReleases(cmd.Context(), config)
+		if err != nil {
+			logging.Log.WithError(err).Error("error checking commits")
+			os.Exit(1)
+		}
+		selected, err := selectTargets(results, args)
+		if err != nil {
+			logging.Log.WithError(err).Error("error selecting targets")
+			os.Exit(1)
+		}
+		if err := core.WriteExplanations(os.Stdout, selected); err != nil {
+			logging.Log.WithError(err).Error("error writing the explanations")
+			os.Exit(1)
+		}
+	},
+}
+
+// selectTargets gives the named targets in the order of the names, or every
+// target without names.
+func selectTargets(results []core.DirectoryVersionInfo, names []string) ([]core.DirectoryVersionInfo, error) {
+	if len(names) == 0 {
+		return results, nil
+	}
+	selected := make([]core.DirectoryVersionInfo, 0, len(names))
+	for _, name := range names {
+		idx := slices.IndexFunc(results, func(result core.DirectoryVersionInfo) bool {
+			return result.NextVersion.Package == name
+		})
+		if idx < 0 {
+			return nil, fmt.Errorf("no release target is named %q", name)
+		}
+		selected = append(selected, results[idx])
+	}
+	return selected, nil
+}
+
+func init() {
+	rootCmd.AddCommand(explainCmd)
+	shareReadOnlyAnalysisFlags(explainCmd)
+}
@@ -0,0 +1,67 @@
+/*
+Copyright © 2023 Catalyst Squad <info@catalystcommunity.com>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/catalystcommunity/app-utils-go/logging"
+	"github.com/catalystcommunity/semver-tags/core"
+	"github.com/spf13/cobra"
+)
+
+var migrateTagsCmd = &cobra.Command{
+	Use:   "migrate-tags",
+	Short: "Copy the latest version of each previous target name to the current name",
+	Long: `Copy the latest version of each previous target name to the current name.
+
+A renamed target keeps its version series when its configuration lists the
+old name in previous_names. Run this command one time after a rename to make
+the same version under the new name. After that, the target no longer needs
+its previous names.
+
+  targets:
+    - name: public-api
+      previous_names:
+        - api
+      paths:
+        - services/api
+
+If api/v1.4.2 is the latest tag of the old name, the command makes
+public-api/v1.4.2 on the same commit. It skips a previous name when the new
+name already has the same or a higher version. A legacy directory target also
+copies the tags of its full directory path.
+
+The command pushes all new tags in one push, and then to each mirror in the
+remotes list. With --atomic, the remote takes all of them or none. It does not
+push a branch. Use --dry_run to see the tags without making them. The command
+prints one line for each tag.
+
+Use --annotate or --sign as for run. The --annotation_template reads the new
+tag, and the copied tag as .PreviousTag; its one release note names the copied
+tag.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := initRunConfig(cmd)
+		if err != nil {
+			logging.Log.WithError(err).Error("error resolving configuration")
+			os.Exit(1)
+		}
+
+		migrations, err := core.MigrateTags(cmd.Context(), config)
+		if err != nil {
+			logging.Log.WithError(err).Error("error migrating tags")
+			os.Exit(1)
+		}
+		for _, migration := range migrations {
+			fmt.Printf("%s -> %s\n", migration.FromTag, migration.Tag)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(migrateTagsCmd)
+	shareAnalysisFlags(migrateTagsCmd, "dry_run", "atomic", "mirror-failure", "sign", "annotate", "annotation_template")
+}
@@ -0,0 +1,107 @@
+/*
+Copyright © 2023 Catalyst Squad <info@catalystcommunity.com>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/catalystcommunity/app-utils-go/logging"
+	"github.com/catalystcommunity/semver-tags/core"
+	"github.com/spf13/cobra"
+)
+
+// nextExitNothing is the exit status of next when no selected target has a
+// release pending. A pending release exits with 0, and an error with 1.
+const nextExitNothing = 2
+
+var nextCmd = &cobra.Command{
+	Use:   "next [target...]",
+	Short: "Print the next version of each release target",
+	Long: `Print the next version of each release target.
+
+The command runs the same analysis as run and prints one line for each
+release target, in the run output order:
+
+  1.3.0
+
+Name targets to print only their versions, in the order of the arguments.
+Use --tag to print the full tag, such as api/v1.3.0. A target without a
+pending release prints its current version. So does a target that can not
+release, such as one with an unapproved breaking change; the command logs the
+reason.
+
+The command exits with status 0 when at least one printed target has a
+release pending, with status 2 when none has, and with status 1 on an error.
+It never writes a ref, so it does not take --fetch-tags or --deepen, and it
+prints nothing else on standard output.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := initRunConfig(cmd)
+		if err != nil {
+			logging.Log.WithError(err).Error("error resolving configuration")
+			os.Exit(1)
+		}
+		config.DryRun = true
+		config.FetchTags = false
+		config.Deepen = false
+
+		results, err := core.AnalyzeReleases(cmd.Context(), config)
+		if err != nil {
+			logging.Log.WithError(err).Error("error checking commits")
+			os.Exit(1)
+		}
+		withTag, err := cmd.Flags().GetBool("tag")
+		if err != nil {
+			logging.Log.WithError(err).Error("error resolving configuration")
+			os.Exit(1)
+		}
+		lines, pending, err := nextVersions(results, args, withTag)
+		if err != nil {
+			logging.Log.WithError(err).Error("error selecting targets")
+			os.Exit(1)
+		}
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+		if !pending {
+			os.Exit(nextExitNothing)
+		}
+	},
+}
+
+// nextVersions gives the next version or tag of each named target, or of
+// every target without names. It also tells if one of them has a release
+// pending.
+func nextVersions(results []core.DirectoryVersionInfo, names []string, withTag bool) ([]string, bool, error) {
+	selected, err := selectTargets(results, names)
+	if err != nil {
+		return nil, false, err
+	}
+
+	lines := make([]string, 0, len(selected))
+	pending := false
+	for _, result := range selected {
+		line := strings.TrimPrefix(result.NextVersion.Version.FormattedString(), "v")
+		if withTag {
+			tag, err := result.NextVersion.Tag()
+			if err != nil {
+				return nil, false, err
+			}
+			line = tag
+		}
+		lines = append(lines, line)
+		if result.Blocked != nil {
+			logging.Log.WithError(result.Blocked).Warn("The release is blocked")
+		}
+		pending = pending || result.ReleasePending()
+	}
+	return lines, pending, nil
+}
+
+func init() {
+	rootCmd.AddCommand(nextCmd)
+	shareReadOnlyAnalysisFlags(nextCmd)
+	nextCmd.Flags().Bool("tag", false, "print the full tag instead of the version")
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/catalystcommunity/semver-tags/core"
+	"github.com/catalystcommunity/semver-tags/core/gittest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextVersionsSelectsTargets(t *testing.T) {
+	repo := gittest.New()
+	first := repo.Commit("feat: initial layout", "services/api/file.txt", "services/worker/file.txt")
+	repo.Tag("api/v1.2.0", first)
+	repo.Tag("worker/v2.0.0", first)
+	repo.Commit("feat: add an endpoint", "services/api/endpoint.txt")
+	results, err := core.AnalyzeReleases(context.Background(), core.Config{
+		Repository:  repo,
+		Directories: []string{"services/api", "services/worker"},
+	})
+	require.NoError(t, err)
+
+	lines, pending, err := nextVersions(results, nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.3.0", "2.0.0"}, lines)
+	assert.True(t, pending)
+
+	lines, pending, err = nextVersions(results, []string{"worker", "api"}, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"worker/v2.0.0", "api/v1.3.0"}, lines)
+	assert.True(t, pending)
+
+	lines, pending, err = nextVersions(results, []string{"worker"}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2.0.0"}, lines)
+	assert.False(t, pending)
+
+	_, _, err = nextVersions(results, []string{"web"}, false)
+	assert.ErrorContains(t, err, `no release target is named "web"`)
+}
@@ -4,9 +4,12 @@ Copyright © 2023 Catalyst Squad <info@catalystcommunity.com>
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -26,9 +29,12 @@ Set LOG_LEVEL=ERROR when another command must parse the JSON output. Always
 check for a zero exit status before you use the output.`,
 }
 
-// Execute runs the command-line interface.
+// Execute runs the command-line interface. An interrupt or a termination
+// signal cancels the context of the command, which stops its git commands.
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
 	if err != nil {
 		os.Exit(1)
 	}
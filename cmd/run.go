@@ -4,13 +4,17 @@ Copyright © 2023 Catalyst Squad <info@catalystcommunity.com>
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"runtime"
+	"slices"
 	"strings"
 
 	"github.com/catalystcommunity/app-utils-go/logging"
 	"github.com/catalystcommunity/semver-tags/core"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -74,6 +78,64 @@ default in the next major version. Until then, the command writes a migration
 warning when neither short-version flag is set. Use --skip-short-versions to
 keep only full tags and suppress the warning.
 
+Use --tag_format to write and read tags in another form. The value is a Go
+template that reads .Package and .Version, for example release-{{.Version}}.
+
+Use --annotate to make annotated tags. The message comes from
+--annotation_template and can hold the release notes. Annotated tags will
+become the default in a future major version. Use --sign to make signed
+annotated tags with the signing settings of git. Use --trusted_signers to
+ignore version tags that no trusted signer signed, and --signed_commits to
+ignore or reject commits that no trusted signer signed.
+
+Use --breaking-approval to count a breaking change only when its commit or a
+later commit of the target has a Breaking-Approved-By trailer. Use
+--breaking-approvers to accept only some approvers.
+
+Use --git-backend=native to run without the git command, for example in an
+image that does not ship git. The native backend can not sign tags or check
+signatures.
+
+A shallow clone, such as a CI checkout with --depth 1, stops the command,
+because its missing tags and history give wrong versions. Use --deepen to
+fetch every tag and enough history from --remote instead.
+
+Before it makes tags, the command checks that HEAD is the tip of --branch,
+that the branch of each remote is in the history of HEAD, and that no remote
+holds a new tag at another commit. Use --require-clean to also stop when the
+work tree has changes.
+
+Two runs on consecutive commits can work out the same version. Use
+--fetch-tags to fetch the tags of --remote first and to check the remote for
+the new tags just before the push. Use --push-retries to calculate and push
+again when another run pushed a new tag first.
+
+To push to more than one remote, list them under remotes in the
+configuration file. The first remote is the primary remote, and the others
+are mirrors. Use --mirror-failure to decide if a failed mirror push fails the
+run.
+
+Use --release-commit to commit the new version into the version files under
+version_files in the configuration file and the release notes into the
+CHANGELOG.md of each released target, then tag that commit and push it with
+--branch. The analysis leaves out these release commits, which end with a
+Release-Commit: semver-tags trailer.
+
+List release rules under policies in the configuration file to block a
+release, make it a dry run, or warn about it, such as in a freeze window or
+for a major version.
+
+Use --explain to write a trace of each release target to standard error: the
+base tag and why, the ignored tags, what the rules read from each commit, and
+how the bump was reached. The explain command prints the same trace alone.
+
+Use --jobs to set how many release targets the command analyzes at a time.
+The default is the number of CPUs. The outputs keep the same order for every
+value. An interrupt stops the running git commands.
+
+Use --snapshot to calculate an untagged snapshot version for a build that must
+never make a tag. The describe command prints the same versions as plain text.
+
 Most output fields hold one comma-separated value for each group or target.
 The order is every --directories value first, then every --dir_group value,
 and then every --target value.`,
@@ -84,29 +146,105 @@ and then every --target value.`,
 			logging.Log.WithError(err).Error("error resolving configuration")
 			os.Exit(1)
 		}
-		runCommand(config)
+		runCommand(cmd.Context(), config)
 	},
 }
 
+// runFlags holds every run flag. It is a package value and not part of an
+// init function, so other commands can share the analysis flags in their own
+// init functions. The shared flags keep one value, which is what viper reads.
+var runFlags = newRunFlags()
+
+func newRunFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("run", pflag.ContinueOnError)
+	flags.Bool("dry_run", false, "calculate results without creating or pushing tags")
+	flags.Bool("github_action", false, "write outputs for later GitHub Actions steps")
+	flags.Bool("output_json", true, "write the results as a JSON object")
+	flags.Bool("atomic", true, "push the branch and all tags as one atomic operation")
+	flags.String("pre_release_string", "", "set the semantic version pre-release identifier; accepts a Go template such as pr.{{.Env \"PR_NUMBER\"}}")
+	flags.String("build_string", "", "set the semantic version build identifier; accepts a Go template such as g{{.ShortSHA}}")
+	flags.String("remote", "origin", "push tags to this Git remote, and fetch from it with --deepen")
+	flags.String("mirror-failure", core.MirrorFailureFail, "when a push to a mirror in the remotes list fails: fail stops the run, warn only logs it")
+	flags.String("branch", "main", "push this branch with the tags; set an empty value to push only tags")
+	flags.Bool("require-clean", false, "stop when the work tree has changes that HEAD does not hold")
+	flags.StringArray("allowed_types", []string{}, "allow only these commit types to change a version; repeat the flag or use commas; the default allows all configured types and BREAKING CHANGE")
+	flags.StringArray("patch_types", core.DefaultPatchTypes(), "make a patch release for these commit types; repeat the flag or use commas; fix is always a patch type")
+	flags.StringArray("minor_types", core.DefaultMinorTypes(), "make a minor release for these commit types; repeat the flag or use commas; feat is always a minor type")
+	flags.StringArray("major_types", core.DefaultMajorTypes(), "make a major release for these commit types; repeat the flag or use commas")
+	flags.Bool("short-versions", false, "also update mutable vMAJOR.MINOR and vMAJOR tags")
+	flags.Bool("skip-short-versions", false, "keep full version tags only and suppress the short-version migration warning")
+	flags.StringArray("directories", []string{}, "tag one path by its base name; repeat the flag for more paths")
+	flags.StringArray("dir_group", []string{}, "tag a comma-separated path group by the first path's base name; repeat the flag for more groups")
+	flags.StringArray("target", []string{}, "define a release target as name=path[,path...]; repeat the flag for more targets")
+	flags.String("tag_format", "", "render and read version tags with this Go template; the default is {{if .Package}}{{.Package}}/{{end}}v{{.Version}}")
+	flags.Bool("annotate", false, "make annotated tags with a message from --annotation_template")
+	flags.String("annotation_template", core.DefaultAnnotationTemplate, "Go template for the annotated tag message; reads .Package, .Version, .Tag, .PreviousTag, and .ReleaseNotes")
+	flags.Bool("sign", false, "make signed annotated tags with the gpg.format and user.signingkey settings of git")
+	flags.String("trusted_signers", "", "use only version tags that a trusted signer signed; name an SSH allowed-signers file or a GPG home directory")
+	flags.String("signed_commits", "", "check commit signatures against trusted_signers: ignore skips unverified commits, fail stops the run")
+	flags.Bool("breaking-approval", false, "count a breaking change only when its commit or a later one has a "+core.BreakingApprovalTrailer+" trailer; fail otherwise")
+	flags.StringArray("breaking-approvers", []string{}, "accept approval trailers only from these names or email addresses; repeat the flag or use commas")
+	flags.Bool("fetch-tags", false, "fetch every tag from --remote before calculating, and check the remote for the new tags before pushing")
+	flags.Int("push-retries", 0, "calculate and push again this many times when another run pushed a new tag first")
+	flags.Bool("deepen", false, "in a shallow clone, fetch the tags and enough history from --remote instead of stopping")
+	flags.Bool("release-commit", false, "commit the version files and changelog of each new release, then tag that commit and push it with --branch")
+	flags.String("repo-url", "", "link changelog releases and commits to this repository, such as https://github.com/org/repo; GitHub Actions defaults to the current repository")
+	flags.Bool("explain", false, "write how each release target got its version to standard error")
+	flags.Int("jobs", runtime.NumCPU(), "analyze this many release targets at a time")
+	flags.String("git-backend", core.GitBackendExec, "git backend: exec runs the git command, native reads and writes the repository in process")
+	flags.Bool("snapshot", false, "calculate an untagged snapshot version; never create or push tags")
+	flags.String("snapshot_format", core.SnapshotFormatGo, "snapshot version format: go or describe")
+	return flags
+}
+
+// analysisFlagNames names the run flags that change the calculated version or
+// how a command reads the repository.
+var analysisFlagNames = []string{
+	"pre_release_string",
+	"build_string",
+	"allowed_types",
+	"patch_types",
+	"minor_types",
+	"major_types",
+	"directories",
+	"dir_group",
+	"target",
+	"tag_format",
+	"trusted_signers",
+	"signed_commits",
+	"breaking-approval",
+	"breaking-approvers",
+	"fetch-tags",
+	"deepen",
+	"remote",
+	"jobs",
+	"git-backend",
+}
+
+// shareAnalysisFlags gives a read-only command the run flags that change the
+// calculated version.
+func shareAnalysisFlags(command *cobra.Command, extraNames ...string) {
+	for _, name := range append(slices.Clone(analysisFlagNames), extraNames...) {
+		command.Flags().AddFlag(runFlags.Lookup(name))
+	}
+}
+
+// refFlagNames names the analysis flags that fetch refs before the analysis.
+var refFlagNames = []string{"fetch-tags", "deepen"}
+
+// shareReadOnlyAnalysisFlags gives a command that never writes a ref the
+// analysis flags that do not fetch.
+func shareReadOnlyAnalysisFlags(command *cobra.Command, extraNames ...string) {
+	for _, name := range append(slices.Clone(analysisFlagNames), extraNames...) {
+		if !slices.Contains(refFlagNames, name) {
+			command.Flags().AddFlag(runFlags.Lookup(name))
+		}
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(runCmd)
-	runCmd.PersistentFlags().Bool("dry_run", false, "calculate results without creating or pushing tags")
-	runCmd.PersistentFlags().Bool("github_action", false, "write outputs for later GitHub Actions steps")
-	runCmd.PersistentFlags().Bool("output_json", true, "write the results as a JSON object")
-	runCmd.PersistentFlags().Bool("atomic", true, "push the branch and all tags as one atomic operation")
-	runCmd.PersistentFlags().String("pre_release_string", "", "set the semantic version pre-release identifier")
-	runCmd.PersistentFlags().String("build_string", "", "set the semantic version build identifier")
-	runCmd.PersistentFlags().String("remote", "origin", "push tags to this Git remote")
-	runCmd.PersistentFlags().String("branch", "main", "push this branch with the tags; set an empty value to push only tags")
-	runCmd.PersistentFlags().StringArray("allowed_types", []string{}, "allow only these commit types to change a version; repeat the flag or use commas; the default allows all configured types and BREAKING CHANGE")
-	runCmd.PersistentFlags().StringArray("patch_types", core.DefaultPatchTypes(), "make a patch release for these commit types; repeat the flag or use commas; fix is always a patch type")
-	runCmd.PersistentFlags().StringArray("minor_types", core.DefaultMinorTypes(), "make a minor release for these commit types; repeat the flag or use commas; feat is always a minor type")
-	runCmd.PersistentFlags().StringArray("major_types", core.DefaultMajorTypes(), "make a major release for these commit types; repeat the flag or use commas")
-	runCmd.PersistentFlags().Bool("short-versions", false, "also update mutable vMAJOR.MINOR and vMAJOR tags")
-	runCmd.PersistentFlags().Bool("skip-short-versions", false, "keep full version tags only and suppress the short-version migration warning")
-	runCmd.PersistentFlags().StringArray("directories", []string{}, "tag one path by its base name; repeat the flag for more paths")
-	runCmd.PersistentFlags().StringArray("dir_group", []string{}, "tag a comma-separated path group by the first path's base name; repeat the flag for more groups")
-	runCmd.PersistentFlags().StringArray("target", []string{}, "define a release target as name=path[,path...]; repeat the flag for more targets")
+	runCmd.PersistentFlags().AddFlagSet(runFlags)
 
 	err := viper.BindPFlags(runCmd.PersistentFlags())
 	if err != nil {
@@ -116,6 +254,15 @@ func init() {
 	for key, flagName := range map[string]string{
 		"short_versions":      "short-versions",
 		"skip_short_versions": "skip-short-versions",
+		"git_backend":         "git-backend",
+		"fetch_tags":          "fetch-tags",
+		"push_retries":        "push-retries",
+		"mirror_failure":      "mirror-failure",
+		"require_clean":       "require-clean",
+		"breaking_approval":   "breaking-approval",
+		"breaking_approvers":  "breaking-approvers",
+		"release_commit":      "release-commit",
+		"repo_url":            "repo-url",
 	} {
 		if err := viper.BindPFlag(key, runCmd.PersistentFlags().Lookup(flagName)); err != nil {
 			logging.Log.WithError(err).Error("error initializing configuration")
@@ -150,30 +297,114 @@ func configuredTargets(
 	return targets, nil
 }
 
+// configuredRemotes reads the remote list, which only the configuration file
+// can hold.
+func configuredRemotes(
+	unmarshalKey func(string, any, ...viper.DecoderConfigOption) error,
+) ([]core.RemoteConfig, error) {
+	var remotes []core.RemoteConfig
+	if err := unmarshalKey("remotes", &remotes); err != nil {
+		return nil, fmt.Errorf("can not read remotes from the configuration file: %w", err)
+	}
+	return remotes, nil
+}
+
+// configuredPolicies reads the release policies, which only the
+// configuration file can hold.
+func configuredPolicies(
+	unmarshalKey func(string, any, ...viper.DecoderConfigOption) error,
+) ([]core.PolicyConfig, error) {
+	var policies []core.PolicyConfig
+	if err := unmarshalKey("policies", &policies); err != nil {
+		return nil, fmt.Errorf("can not read policies from the configuration file: %w", err)
+	}
+	return policies, nil
+}
+
+// configuredVersionFiles reads the version files of every target, which
+// only the configuration file can hold.
+func configuredVersionFiles(
+	unmarshalKey func(string, any, ...viper.DecoderConfigOption) error,
+) ([]core.VersionFile, error) {
+	var files []core.VersionFile
+	if err := unmarshalKey("version_files", &files); err != nil {
+		return nil, fmt.Errorf("can not read version_files from the configuration file: %w", err)
+	}
+	return files, nil
+}
+
+// configuredRepoURL gives --repo-url, or the current repository in GitHub
+// Actions.
+func configuredRepoURL() string {
+	if repoURL := viper.GetString("repo_url"); repoURL != "" {
+		return repoURL
+	}
+	server, repository := os.Getenv("GITHUB_SERVER_URL"), os.Getenv("GITHUB_REPOSITORY")
+	if server == "" || repository == "" {
+		return ""
+	}
+	return server + "/" + repository
+}
+
 func initRunConfig(cmd *cobra.Command) (core.Config, error) {
 	targets, err := resolveTargetConfigs(cmd)
 	if err != nil {
 		return core.Config{}, err
 	}
+	remotes, err := configuredRemotes(viper.UnmarshalKey)
+	if err != nil {
+		return core.Config{}, err
+	}
+	policies, err := configuredPolicies(viper.UnmarshalKey)
+	if err != nil {
+		return core.Config{}, err
+	}
+	versionFiles, err := configuredVersionFiles(viper.UnmarshalKey)
+	if err != nil {
+		return core.Config{}, err
+	}
 
 	config := core.Config{
-		DryRun:            viper.GetBool("dry_run"),
-		GithubAction:      viper.GetBool("github_action"),
-		OutputJson:        viper.GetBool("output_json"),
-		Atomic:            viper.GetBool("atomic"),
-		PreReleaseString:  viper.GetString("pre_release_string"),
-		BuildString:       viper.GetString("build_string"),
-		Remote:            viper.GetString("remote"),
-		Branch:            viper.GetString("branch"),
-		AllowedTypes:      viper.GetStringSlice("allowed_types"),
-		PatchTypes:        viper.GetStringSlice("patch_types"),
-		MinorTypes:        viper.GetStringSlice("minor_types"),
-		MajorTypes:        viper.GetStringSlice("major_types"),
-		ShortVersions:     viper.GetBool("short_versions"),
-		SkipShortVersions: viper.GetBool("skip_short_versions"),
-		Directories:       viper.GetStringSlice("directories"),
-		DirGroups:         viper.GetStringSlice("dir_group"),
-		Targets:           targets,
+		DryRun:             viper.GetBool("dry_run"),
+		GithubAction:       viper.GetBool("github_action"),
+		OutputJson:         viper.GetBool("output_json"),
+		Atomic:             viper.GetBool("atomic"),
+		PreReleaseString:   viper.GetString("pre_release_string"),
+		BuildString:        viper.GetString("build_string"),
+		Remote:             viper.GetString("remote"),
+		Remotes:            remotes,
+		MirrorFailure:      viper.GetString("mirror_failure"),
+		Branch:             viper.GetString("branch"),
+		AllowedTypes:       viper.GetStringSlice("allowed_types"),
+		PatchTypes:         viper.GetStringSlice("patch_types"),
+		MinorTypes:         viper.GetStringSlice("minor_types"),
+		MajorTypes:         viper.GetStringSlice("major_types"),
+		ShortVersions:      viper.GetBool("short_versions"),
+		SkipShortVersions:  viper.GetBool("skip_short_versions"),
+		Directories:        viper.GetStringSlice("directories"),
+		DirGroups:          viper.GetStringSlice("dir_group"),
+		Targets:            targets,
+		Snapshot:           viper.GetBool("snapshot"),
+		SnapshotFormat:     viper.GetString("snapshot_format"),
+		TagFormat:          viper.GetString("tag_format"),
+		Annotate:           viper.GetBool("annotate"),
+		AnnotationTemplate: viper.GetString("annotation_template"),
+		Sign:               viper.GetBool("sign"),
+		TrustedSigners:     viper.GetString("trusted_signers"),
+		SignedCommits:      viper.GetString("signed_commits"),
+		BreakingApproval:   viper.GetBool("breaking_approval"),
+		BreakingApprovers:  viper.GetStringSlice("breaking_approvers"),
+		FetchTags:          viper.GetBool("fetch_tags"),
+		PushRetries:        viper.GetInt("push_retries"),
+		RequireClean:       viper.GetBool("require_clean"),
+		Deepen:             viper.GetBool("deepen"),
+		Policies:           policies,
+		ReleaseCommit:      viper.GetBool("release_commit"),
+		VersionFiles:       versionFiles,
+		RepoURL:            configuredRepoURL(),
+		Explain:            viper.GetBool("explain"),
+		Jobs:               viper.GetInt("jobs"),
+		GitBackend:         viper.GetString("git_backend"),
 	}
 
 	logging.Log.WithField("settings", fmt.Sprintf("%+v", config)).Debug("viper settings")
@@ -181,9 +412,9 @@ func initRunConfig(cmd *cobra.Command) (core.Config, error) {
 	return config, nil
 }
 
-func runCommand(config core.Config) {
+func runCommand(ctx context.Context, config core.Config) {
 	logging.Log.WithField("settings", fmt.Sprintf("%+v", config)).Info("command run with settings resolved")
-	if err := core.DoTagging(config); err != nil {
+	if err := core.DoTagging(ctx, config); err != nil {
 		logging.Log.WithError(err).Error("error checking commits")
 		os.Exit(1)
 	}
@@ -57,6 +57,85 @@ targets:
 	}}, targets)
 }
 
+func TestConfiguredRemotesFromYamlValue(t *testing.T) {
+	config := viper.New()
+	config.SetConfigType("yaml")
+	require.NoError(t, config.ReadConfig(strings.NewReader(`
+remotes:
+  - name: origin
+  - name: mirror
+    atomic: false
+    push_branch: false
+    short_tags: false
+`)))
+
+	remotes, err := configuredRemotes(config.UnmarshalKey)
+
+	require.NoError(t, err)
+	disabled := false
+	assert.Equal(t, []core.RemoteConfig{
+		{Name: "origin"},
+		{Name: "mirror", Atomic: &disabled, PushBranch: &disabled, ShortTags: &disabled},
+	}, remotes)
+}
+
+func TestConfiguredPoliciesFromYamlValue(t *testing.T) {
+	config := viper.New()
+	config.SetConfigType("yaml")
+	require.NoError(t, config.ReadConfig(strings.NewReader(`
+policies:
+  - name: year-end-freeze
+    freezes:
+      - start: "12-20"
+        end: "01-03"
+  - name: platform-fridays
+    action: dry_run
+    paths: [platform]
+    weekdays: [friday]
+    max_bump: patch
+    timezone: Europe/Berlin
+  - name: no-major-on-main
+    branches: [main]
+    max_bump: minor
+    unless_approved: true
+`)))
+
+	policies, err := configuredPolicies(config.UnmarshalKey)
+
+	require.NoError(t, err)
+	assert.Equal(t, []core.PolicyConfig{
+		{Name: "year-end-freeze", Freezes: []core.FreezeWindow{{Start: "12-20", End: "01-03"}}},
+		{
+			Name:     "platform-fridays",
+			Action:   core.PolicyDryRun,
+			Paths:    []string{"platform"},
+			Weekdays: []string{"friday"},
+			MaxBump:  core.BumpPatch,
+			Timezone: "Europe/Berlin",
+		},
+		{Name: "no-major-on-main", Branches: []string{"main"}, MaxBump: core.BumpMinor, UnlessApproved: true},
+	}, policies)
+}
+
+func TestConfiguredVersionFilesFromYamlValue(t *testing.T) {
+	config := viper.New()
+	config.SetConfigType("yaml")
+	require.NoError(t, config.ReadConfig(strings.NewReader(`
+version_files:
+  - path: package.json
+  - path: src/version.go
+    pattern: 'Version = "([^"]+)"'
+`)))
+
+	files, err := configuredVersionFiles(config.UnmarshalKey)
+
+	require.NoError(t, err)
+	assert.Equal(t, []core.VersionFile{
+		{Path: "package.json"},
+		{Path: "src/version.go", Pattern: `Version = "([^"]+)"`},
+	}, files)
+}
+
 func replaceStringArrayFlag(t *testing.T, name string, values []string) {
 	t.Helper()
 	flag := runCmd.PersistentFlags().Lookup(name)
@@ -196,3 +275,11 @@ func TestRunRejectsPositionalArguments(t *testing.T) {
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "unknown command")
 }
+
+// The describe command shares the run flag values, so the viper keys that run
+// binds also read a describe flag.
+func TestDescribeSharesTheAnalysisFlags(t *testing.T) {
+	for _, name := range append(analysisFlagNames, "snapshot_format") {
+		assert.Same(t, runCmd.PersistentFlags().Lookup(name), describeCmd.Flags().Lookup(name), name)
+	}
+}
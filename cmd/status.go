@@ -0,0 +1,110 @@
+/*
+Copyright © 2023 Catalyst Squad <info@catalystcommunity.com>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/catalystcommunity/app-utils-go/logging"
+	"github.com/catalystcommunity/semver-tags/core"
+	"github.com/spf13/cobra"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Print the release state of every release target",
+	Long: `Print the release state of every release target.
+
+The command runs the same analysis as run and prints one row for each
+release target, in the run output order: the current version and tag, the
+commit and date of that tag, the number of commits since it, the pending bump
+level, and the next version.
+
+  TARGET  VERSION  TAG         COMMIT   DATE        UNRELEASED  BUMP   NEXT
+  api     1.2.0    api/v1.2.0  abcdef1  2026-10-01  3           minor  1.3.0
+
+A target that can not release, such as one with an unapproved breaking
+change, shows "blocked" as its bump and its current version as the next
+version. The command logs the reason, and the JSON output gives it in the
+blocked field.
+
+Use --json to print the same values as a JSON array for other tools. The
+command never writes a ref, so it does not take --fetch-tags or --deepen.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := initRunConfig(cmd)
+		if err != nil {
+			logging.Log.WithError(err).Error("error resolving configuration")
+			os.Exit(1)
+		}
+		asJson, err := cmd.Flags().GetBool("json")
+		if err != nil {
+			logging.Log.WithError(err).Error("error resolving configuration")
+			os.Exit(1)
+		}
+
+		statuses, err := core.Status(cmd.Context(), config)
+		if err != nil {
+			logging.Log.WithError(err).Error("error checking commits")
+			os.Exit(1)
+		}
+		for _, status := range statuses {
+			if status.Blocked != "" {
+				logging.Log.Warn(fmt.Sprintf("The release is blocked: %s", status.Blocked))
+			}
+		}
+		if asJson {
+			err = writeStatusJson(os.Stdout, statuses)
+		} else {
+			err = writeStatusTable(os.Stdout, statuses)
+		}
+		if err != nil {
+			logging.Log.WithError(err).Error("error writing the status")
+			os.Exit(1)
+		}
+	},
+}
+
+func writeStatusJson(out io.Writer, statuses []core.TargetStatus) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(statuses)
+}
+
+// writeStatusTable writes one aligned row for each target. A target without
+// a tag shows "-" in the tag, commit, and date columns.
+func writeStatusTable(out io.Writer, statuses []core.TargetStatus) error {
+	table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "TARGET\tVERSION\tTAG\tCOMMIT\tDATE\tUNRELEASED\tBUMP\tNEXT")
+	for _, status := range statuses {
+		name := status.Package
+		if name == "" {
+			name = "."
+		}
+		tag, commit, date := "-", "-", "-"
+		if status.Tag != "" {
+			tag, commit, date = status.Tag, status.Commit[:min(7, len(status.Commit))], status.Date.Format("2006-01-02")
+		}
+		next := status.NextVersion
+		if status.Policy != "" {
+			next += " (" + status.Policy + ")"
+		}
+		fmt.Fprintf(
+			table, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			name, status.Version, tag, commit, date, strconv.Itoa(status.UnreleasedCommits), status.Bump, next,
+		)
+	}
+	return table.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+	shareReadOnlyAnalysisFlags(statusCmd)
+	statusCmd.Flags().Bool("json", false, "print a JSON array instead of a table")
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/catalystcommunity/semver-tags/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteStatusTableAlignsTheRows(t *testing.T) {
+	date := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	statuses := []core.TargetStatus{
+		{
+			Package: "api", Version: "1.2.0", Tag: "api/v1.2.0", Commit: "abcdef1234567890",
+			Date: &date, UnreleasedCommits: 3, Bump: core.BumpMinor, NextVersion: "1.3.0", Policy: core.PolicyBlock,
+		},
+		{Package: "web", Version: "0.1.0", Bump: "none", NextVersion: "0.1.0"},
+	}
+	var out bytes.Buffer
+
+	require.NoError(t, writeStatusTable(&out, statuses))
+
+	assert.Equal(t, ""+
+		"TARGET  VERSION  TAG         COMMIT   DATE        UNRELEASED  BUMP   NEXT\n"+
+		"api     1.2.0    api/v1.2.0  abcdef1  2026-10-01  3           minor  1.3.0 (block)\n"+
+		"web     0.1.0    -           -        -           0           none   0.1.0\n",
+		out.String())
+}
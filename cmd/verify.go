@@ -0,0 +1,53 @@
+/*
+Copyright © 2023 Catalyst Squad <info@catalystcommunity.com>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/catalystcommunity/app-utils-go/logging"
+	"github.com/catalystcommunity/semver-tags/core"
+	"github.com/spf13/cobra"
+)
+
+var verifyTagsCmd = &cobra.Command{
+	Use:   "verify-tags",
+	Short: "Report the signature trust state of every version tag",
+	Long: `Report the signature trust state of every version tag.
+
+The command reads the version tags of every release target and checks each
+signature against --trusted_signers. That value names an SSH allowed-signers
+file or a GPG home directory that holds the trusted keys. It prints one line
+for each tag:
+
+  api/v1.2.3 trusted
+  api/v1.2.4 untrusted
+  api/v9.0.0 unsigned
+
+A run with --trusted_signers ignores every untrusted and unsigned version tag
+when it finds the last release. The command never changes a ref.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := initRunConfig(cmd)
+		if err != nil {
+			logging.Log.WithError(err).Error("error resolving configuration")
+			os.Exit(1)
+		}
+
+		verifications, err := core.VerifyTags(cmd.Context(), config)
+		if err != nil {
+			logging.Log.WithError(err).Error("error verifying tags")
+			os.Exit(1)
+		}
+		for _, verification := range verifications {
+			fmt.Printf("%s %s\n", verification.Tag, verification.Trust)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyTagsCmd)
+	shareAnalysisFlags(verifyTagsCmd)
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// DefaultAnnotationTemplate gives the tag name, then one line for each release
+// note.
+const DefaultAnnotationTemplate = `{{.Tag}}{{if .ReleaseNotes}}
+
+{{range .ReleaseNotes}}- {{.}}
+{{end}}{{end}}`
+
+// AnnotationData holds the values that an annotation template can read.
+// Version has no "v" prefix. PreviousTag is the tag of the last release.
+type AnnotationData struct {
+	Package      string
+	Version      string
+	Tag          string
+	PreviousTag  string
+	ReleaseNotes []string
+}
+
+// annotationTemplate renders the message of an annotated tag. A nil template
+// makes lightweight tags.
+type annotationTemplate struct {
+	template *template.Template
+}
+
+func newAnnotationTemplate(config Config) (annotationTemplate, error) {
+	// A signed tag is always an annotated tag.
+	if !config.Annotate && !config.Sign {
+		return annotationTemplate{}, nil
+	}
+	text := config.AnnotationTemplate
+	if text == "" {
+		text = DefaultAnnotationTemplate
+	}
+	parsed, err := template.New("annotation_template").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return annotationTemplate{}, fmt.Errorf("can not read the annotation template: %w", err)
+	}
+	return annotationTemplate{template: parsed}, nil
+}
+
+// message gives the tag message of one release. It gives an empty message when
+// tags are not annotated. A template that renders only whitespace is an error,
+// because git does not make an annotated tag with an empty message.
+func (a annotationTemplate) message(result DirectoryVersionInfo, tag string) (string, error) {
+	if a.template == nil {
+		return "", nil
+	}
+	previousTag, err := tagFor(result.LastVersion)
+	if err != nil {
+		return "", err
+	}
+	return a.render(AnnotationData{
+		Package:      result.NextVersion.Package,
+		Version:      strings.TrimPrefix(result.NextVersion.Version.FormattedString(), "v"),
+		Tag:          tag,
+		PreviousTag:  previousTag,
+		ReleaseNotes: result.ReleaseNotes,
+	})
+}
+
+// render gives the tag message of one set of annotation values.
+func (a annotationTemplate) render(data AnnotationData) (string, error) {
+	if a.template == nil {
+		return "", nil
+	}
+	var message strings.Builder
+	if err := a.template.Execute(&message, data); err != nil {
+		return "", fmt.Errorf("can not render the annotation of %s: %w", data.Tag, err)
+	}
+	if strings.TrimSpace(message.String()) == "" {
+		return "", fmt.Errorf("the annotation template made an empty message for %s", data.Tag)
+	}
+	return message.String(), nil
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// BreakingApprovalTrailer is the commit trailer that approves the breaking
+// changes of a target when Config.BreakingApproval is set.
+const BreakingApprovalTrailer = "Breaking-Approved-By"
+
+// UnapprovedBreakingError is the error of a target whose breaking changes
+// have no approval trailer. A breaking change is approved by a trailer on its
+// own commit or on a later commit of the target. The analysis gives it as the
+// Blocked reason of the target, and DoTagging fails with it.
+type UnapprovedBreakingError struct {
+	Package string
+	// Commits lists the breaking commits without an approval, newest first.
+	Commits []Commit
+}
+
+func (e *UnapprovedBreakingError) Error() string {
+	commits := make([]string, 0, len(e.Commits))
+	for _, commit := range e.Commits {
+		commits = append(commits, commit.Hash+" "+commit.Subject)
+	}
+	return fmt.Sprintf(
+		"package %q: a breaking change needs a %s trailer on its commit or a later one: %s",
+		e.Package, BreakingApprovalTrailer, strings.Join(commits, "; "),
+	)
+}
+
+// approverList splits comma-separated approvers and removes empty values.
+func approverList(values []string) []string {
+	var approvers []string
+	for _, value := range values {
+		for _, member := range strings.Split(value, ",") {
+			if member = strings.TrimSpace(member); member != "" {
+				approvers = append(approvers, member)
+			}
+		}
+	}
+	return approvers
+}
+
+// commitTrailer is one "Key: value" line of the trailer block of a commit
+// message.
+type commitTrailer struct {
+	key   string
+	value string
+}
+
+// commitTrailers gives the trailers of a commit message. Like git
+// interpret-trailers, they are the lines of the last paragraph, which can not
+// be the subject paragraph, and every line of that paragraph must be a
+// trailer or the continuation of one. A line that starts with a space
+// continues the value of the trailer before it.
+func commitTrailers(message string) []commitTrailer {
+	paragraphs := strings.Split(strings.TrimSpace(strings.ReplaceAll(message, "\r\n", "\n")), "\n\n")
+	if len(paragraphs) < 2 {
+		return nil
+	}
+	var trailers []commitTrailer
+	for _, line := range strings.Split(strings.Trim(paragraphs[len(paragraphs)-1], "\n"), "\n") {
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			if len(trailers) == 0 {
+				return nil
+			}
+			last := &trailers[len(trailers)-1]
+			last.value = strings.TrimSpace(last.value + " " + strings.TrimSpace(line))
+			continue
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found || !validTrailerKey(key) {
+			return nil
+		}
+		trailers = append(trailers, commitTrailer{key: key, value: strings.TrimSpace(value)})
+	}
+	return trailers
+}
+
+// validTrailerKey tells if a key can start a trailer: letters, digits, and
+// hyphens, or the "BREAKING CHANGE" key of conventional commits.
+func validTrailerKey(key string) bool {
+	if key == "BREAKING CHANGE" {
+		return true
+	}
+	if key == "" {
+		return false
+	}
+	for _, character := range key {
+		if !(character == '-' ||
+			character >= '0' && character <= '9' ||
+			character >= 'A' && character <= 'Z' ||
+			character >= 'a' && character <= 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+// approvedBy tells if the trailers of the message hold an approval from one
+// of the approvers. Without approvers, any approval trailer counts. An
+// approver matches the whole trailer value, its name, or its email address.
+func approvedBy(message string, approvers []string) bool {
+	for _, trailer := range commitTrailers(message) {
+		if !strings.EqualFold(trailer.key, BreakingApprovalTrailer) || trailer.value == "" {
+			continue
+		}
+		if len(approvers) == 0 {
+			return true
+		}
+		value := trailer.value
+		name, email, _ := strings.Cut(value, "<")
+		email = strings.TrimSuffix(strings.TrimSpace(email), ">")
+		if slices.Contains(approvers, value) ||
+			slices.Contains(approvers, strings.TrimSpace(name)) ||
+			(email != "" && slices.Contains(approvers, email)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,377 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/catalystcommunity/semver-tags/core/semver"
+)
+
+// ChangelogOptions selects the releases of a changelog.
+type ChangelogOptions struct {
+	// Targets names the targets of the changelogs, in order. An empty list
+	// takes every target.
+	Targets []string
+	// From is a version tag. The changelog holds only the releases after it.
+	// Without named targets, it selects the target that owns the tag. An empty
+	// value takes the full history.
+	From string
+	// Unreleased adds the commits after the last version tag.
+	Unreleased bool
+}
+
+// Changelog holds the releases of one target, newest first.
+type Changelog struct {
+	Package  string
+	Releases []ChangelogRelease
+}
+
+// ChangelogRelease holds the commits of one release, grouped by type.
+type ChangelogRelease struct {
+	// Tag is the version tag of the release, or "" for the unreleased
+	// commits.
+	Tag     string
+	Version string
+	// PreviousTag is the version tag before the release, or "" for the first
+	// release.
+	PreviousTag string
+	// Date is the commit date of the tag. It is zero for the unreleased
+	// commits.
+	Date     time.Time
+	Sections []ChangelogSection
+}
+
+// ChangelogSection holds the commits of one type, newest first.
+type ChangelogSection struct {
+	Title   string
+	Entries []ChangelogEntry
+}
+
+// ChangelogEntry is one conventional commit of a release.
+type ChangelogEntry struct {
+	Hash        string
+	Scope       string
+	Description string
+}
+
+// breakingSection is the title of the section that holds every breaking
+// change, whatever its type.
+const breakingSection = "Breaking Changes"
+
+type sectionTitle struct {
+	commitType string
+	title      string
+}
+
+// sectionTitles gives the section titles of the common types, in the order
+// of the sections at each level.
+var sectionTitles = []sectionTitle{
+	{"feat", "Features"},
+	{"fix", "Bug Fixes"},
+	{"perf", "Performance Improvements"},
+	{"revert", "Reverts"},
+	{"refactor", "Code Refactoring"},
+	{"docs", "Documentation"},
+	{"style", "Styles"},
+	{"test", "Tests"},
+	{"build", "Build System"},
+	{"ci", "Continuous Integration"},
+	{"chore", "Chores"},
+}
+
+// Changelogs reads the releases of each target from its version tags. Each
+// release holds the conventional commits of the target after the release
+// before it, in semantic version order. A commit that is not conventional or
+// not an allowed type is left out. Like a run, the first release holds the
+// commits after the first commit.
+func Changelogs(ctx context.Context, config Config, options ChangelogOptions) ([]Changelog, error) {
+	results, run, err := prepareRun(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := run.loadTags(ctx); err != nil {
+		return nil, err
+	}
+
+	groups := results
+	if len(options.Targets) > 0 {
+		groups = make([]DirectoryVersionInfo, 0, len(options.Targets))
+		for _, name := range options.Targets {
+			idx := slices.IndexFunc(results, func(result DirectoryVersionInfo) bool {
+				return result.PackageName() == name
+			})
+			if idx < 0 {
+				return nil, fmt.Errorf("no release target is named %q", name)
+			}
+			groups = append(groups, results[idx])
+		}
+	}
+
+	changelogs := make([]Changelog, 0, len(groups))
+	for _, group := range groups {
+		tags, err := run.versionTags(ctx, group)
+		if err != nil {
+			return nil, err
+		}
+		owned := slices.ContainsFunc(tags, func(tag versionTag) bool { return tag.name == options.From })
+		if options.From != "" && !owned {
+			if len(options.Targets) == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("tag %q is not a version tag of target %q", options.From, group.PackageName())
+		}
+		changelog, err := run.changelog(ctx, group, tags, options)
+		if err != nil {
+			return nil, err
+		}
+		changelogs = append(changelogs, changelog)
+	}
+	if options.From != "" && len(changelogs) == 0 {
+		return nil, fmt.Errorf("tag %q is not a version tag of any release target", options.From)
+	}
+	return changelogs, nil
+}
+
+// versionTag is one version tag of a target.
+type versionTag struct {
+	name    string
+	version *semver.Semver
+	commit  string
+}
+
+// versionTags gives every trusted version tag of one group in semantic
+// version order. Of two tags with one version, such as under a previous
+// name, the first tag counts.
+func (t *tagger) versionTags(ctx context.Context, group DirectoryVersionInfo) ([]versionTag, error) {
+	format, err := newTagFormat(group.TagFormat)
+	if err != nil {
+		return nil, err
+	}
+	names := append([]string{group.PackageName()}, group.TagAliases...)
+
+	var tags []versionTag
+	for _, tag := range t.tags {
+		for _, name := range names {
+			version, matches := format.parse(tag.Name, name)
+			if !matches {
+				continue
+			}
+			duplicate := slices.ContainsFunc(tags, func(other versionTag) bool {
+				return other.version.Compare(version) == 0
+			})
+			if duplicate {
+				break
+			}
+			trusted, err := t.verifier.trusted(ctx, tag.Name)
+			if err != nil {
+				return nil, err
+			}
+			if trusted {
+				tags = append(tags, versionTag{name: tag.Name, version: version, commit: tag.Commit})
+			}
+			break
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].version.Compare(tags[j].version) < 0
+	})
+	return tags, nil
+}
+
+// changelog reads the releases of one group from its version tags. The From
+// tag of the options is one of the tags, or "".
+func (t *tagger) changelog(ctx context.Context, group DirectoryVersionInfo, tags []versionTag, options ChangelogOptions) (Changelog, error) {
+	changelog := Changelog{Package: group.PackageName()}
+	first := 0
+	if options.From != "" {
+		first = slices.IndexFunc(tags, func(tag versionTag) bool { return tag.name == options.From }) + 1
+	}
+
+	// The commits of a release are the commits after the tag before it that
+	// are not after its own tag.
+	paths := group.CommitPaths()
+	previousCommit, err := t.repo.FirstCommit(ctx)
+	if err != nil {
+		return Changelog{}, err
+	}
+	previous, err := t.commits(ctx, previousCommit, paths)
+	if err != nil {
+		return Changelog{}, err
+	}
+	previousTag := ""
+	for idx, tag := range tags {
+		after, err := t.commits(ctx, tag.commit, paths)
+		if err != nil {
+			return Changelog{}, err
+		}
+		if idx >= first {
+			date, err := t.repo.CommitTime(ctx, tag.commit)
+			if err != nil {
+				return Changelog{}, err
+			}
+			changelog.Releases = append(changelog.Releases, ChangelogRelease{
+				Tag:         tag.name,
+				Version:     strings.TrimPrefix(tag.version.FormattedString(), "v"),
+				PreviousTag: previousTag,
+				Date:        date,
+				Sections:    changelogSections(withoutCommits(previous, after), t.rules),
+			})
+		}
+		previous, previousTag = after, tag.name
+	}
+	if options.Unreleased && len(previous) > 0 {
+		changelog.Releases = append(changelog.Releases, ChangelogRelease{
+			PreviousTag: previousTag,
+			Sections:    changelogSections(previous, t.rules),
+		})
+	}
+	slices.Reverse(changelog.Releases)
+	return changelog, nil
+}
+
+// withoutCommits gives the commits that are not in excluded.
+func withoutCommits(commits []Commit, excluded []Commit) []Commit {
+	hashes := make(map[string]bool, len(excluded))
+	for _, commit := range excluded {
+		hashes[commit.Hash] = true
+	}
+	var kept []Commit
+	for _, commit := range commits {
+		if !hashes[commit.Hash] {
+			kept = append(kept, commit)
+		}
+	}
+	return kept
+}
+
+// changelogSections groups conventional commits by type. Breaking changes
+// come first, then the types with a higher level, then the common types in
+// the order of sectionTitles, then other types by name.
+func changelogSections(commits []Commit, rules bumpRules) []ChangelogSection {
+	entries := map[string][]ChangelogEntry{}
+	levels := map[string]semver.CommitType{}
+	for _, commit := range commits {
+		class := classifyCommit(commit.Message, rules)
+		if class.Level == semver.NotConventional {
+			continue
+		}
+		section := class.Type
+		if class.Level == semver.Major && class.Breaking != "" {
+			section = breakingSection
+		}
+		_, description, _ := strings.Cut(commit.Subject, ":")
+		entries[section] = append(entries[section], ChangelogEntry{
+			Hash:        commit.Hash,
+			Scope:       class.Scope,
+			Description: strings.TrimSpace(description),
+		})
+		levels[section] = class.Level
+	}
+
+	order := func(section string) int {
+		if section == breakingSection {
+			return -1
+		}
+		idx := slices.IndexFunc(sectionTitles, func(title sectionTitle) bool {
+			return title.commitType == section
+		})
+		if idx < 0 {
+			return len(sectionTitles)
+		}
+		return idx
+	}
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if levels[keys[i]] != levels[keys[j]] {
+			return levels[keys[i]] > levels[keys[j]]
+		}
+		if order(keys[i]) != order(keys[j]) {
+			return order(keys[i]) < order(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+
+	sections := make([]ChangelogSection, 0, len(keys))
+	for _, key := range keys {
+		title := key
+		if idx := order(key); idx >= 0 && idx < len(sectionTitles) {
+			title = sectionTitles[idx].title
+		}
+		sections = append(sections, ChangelogSection{Title: title, Entries: entries[key]})
+	}
+	return sections
+}
+
+// WriteChangelogs writes the changelogs as Markdown, one after the other.
+// With a repository URL, such as https://github.com/org/repo, the release
+// headings link to a comparison with the release before, and the entries link
+// to their commits.
+func WriteChangelogs(out io.Writer, changelogs []Changelog, repoURL string) error {
+	repoURL = strings.TrimSuffix(repoURL, "/")
+	var text strings.Builder
+	for idx, changelog := range changelogs {
+		if idx > 0 {
+			text.WriteString("\n")
+		}
+		text.WriteString(changelogTitle(changelog.Package))
+		for _, release := range changelog.Releases {
+			text.WriteString("\n")
+			writeRelease(&text, release, repoURL)
+		}
+	}
+	_, err := io.WriteString(out, text.String())
+	return err
+}
+
+// changelogTitle gives the top heading of the changelog of one target.
+func changelogTitle(packageName string) string {
+	if packageName == "" {
+		return "# Changelog\n"
+	}
+	return fmt.Sprintf("# %s Changelog\n", packageName)
+}
+
+// writeRelease writes the heading and sections of one release.
+func writeRelease(text *strings.Builder, release ChangelogRelease, repoURL string) {
+	text.WriteString(releaseHeading(release, repoURL))
+	if len(release.Sections) == 0 {
+		text.WriteString("\nNo conventional commits.\n")
+	}
+	for _, section := range release.Sections {
+		fmt.Fprintf(text, "\n### %s\n\n", section.Title)
+		for _, entry := range section.Entries {
+			text.WriteString("- ")
+			if entry.Scope != "" {
+				fmt.Fprintf(text, "**%s:** ", entry.Scope)
+			}
+			commit := shortHash(entry.Hash)
+			if repoURL != "" {
+				commit = fmt.Sprintf("[%s](%s/commit/%s)", commit, repoURL, entry.Hash)
+			}
+			fmt.Fprintf(text, "%s (%s)\n", entry.Description, commit)
+		}
+	}
+}
+
+// releaseHeading gives the Markdown heading of one release.
+func releaseHeading(release ChangelogRelease, repoURL string) string {
+	title, to := release.Version, release.Tag
+	if release.Tag == "" {
+		title, to = "Unreleased", "HEAD"
+	}
+	if repoURL != "" && release.PreviousTag != "" {
+		title = fmt.Sprintf("[%s](%s/compare/%s...%s)", title, repoURL, release.PreviousTag, to)
+	}
+	if release.Date.IsZero() {
+		return fmt.Sprintf("## %s\n", title)
+	}
+	return fmt.Sprintf("## %s (%s)\n", title, release.Date.UTC().Format("2006-01-02"))
+}
@@ -1,6 +1,8 @@
 package core
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"slices"
 	"sort"
@@ -17,6 +19,24 @@ type VersionInfo struct {
 	Package    string
 	Version    *semver.Semver
 	CommitHash string
+	format     *tagFormat
+	// initial marks a version that no tag made. It starts at the first
+	// commit.
+	initial bool
+}
+
+// tagFormat gives the tag format of the target of this version. A version
+// that no target made uses the default format.
+func (v *VersionInfo) tagFormat() *tagFormat {
+	if v.format == nil {
+		return defaultTagFormat
+	}
+	return v.format
+}
+
+// Tag gives the tag of the version in the tag format of its target.
+func (v *VersionInfo) Tag() (string, error) {
+	return tagFor(v)
 }
 
 func (v *VersionInfo) Printable() string {
@@ -154,40 +174,89 @@ func newBumpRules(config Config) (bumpRules, error) {
 	return rules, nil
 }
 
-func hasBreakingChange(message string) bool {
+// breakingMarker gives the marker that makes the message a breaking change:
+// "!" after the type, the footer key, or "" when it has none.
+func breakingMarker(message string) string {
 	subject := strings.SplitN(message, "\n", 2)[0]
 	typeAndScope, _, found := strings.Cut(subject, ":")
 	if found && strings.HasSuffix(strings.TrimSpace(typeAndScope), "!") {
-		return true
+		return "!"
 	}
 	for _, line := range strings.Split(message, "\n") {
-		if strings.HasPrefix(line, "BREAKING CHANGE: ") ||
-			strings.HasPrefix(line, "BREAKING-CHANGE: ") {
-			return true
+		for _, footer := range []string{"BREAKING CHANGE", "BREAKING-CHANGE"} {
+			if strings.HasPrefix(line, footer+": ") {
+				return footer
+			}
 		}
 	}
-	return false
+	return ""
 }
 
-func analyzeCommitMessage(message string, rules bumpRules) semver.CommitType {
-	if hasBreakingChange(message) {
-		if _, allowed := rules.allowed[BreakingChangeType]; !allowed {
-			return semver.NotConventional
-		}
-		return semver.Major
-	}
+func hasBreakingChange(message string) bool {
+	return breakingMarker(message) != ""
+}
 
+// commitClass is what the bump rules read from one commit message.
+type commitClass struct {
+	Type     string
+	Scope    string
+	Breaking string
+	Level    semver.CommitType
+	// Rule tells which rule gave the level.
+	Rule string
+}
+
+// classifyCommit reads the type, scope, and breaking marker of one message,
+// and the level that the rules give it.
+func classifyCommit(message string, rules bumpRules) commitClass {
+	var class commitClass
 	subject := strings.SplitN(message, "\n", 2)[0]
 	typeAndScope, _, found := strings.Cut(subject, ":")
+	if found {
+		typeAndScope = strings.TrimSuffix(strings.TrimSpace(typeAndScope), "!")
+		commitType, scope, _ := strings.Cut(typeAndScope, "(")
+		class.Type = strings.ToLower(strings.TrimSpace(commitType))
+		class.Scope = strings.TrimSpace(strings.TrimSuffix(scope, ")"))
+	}
+	class.Breaking = breakingMarker(message)
+
+	if class.Breaking != "" {
+		if _, allowed := rules.allowed[BreakingChangeType]; !allowed {
+			class.Rule = "a breaking marker is not an allowed type"
+			return class
+		}
+		class.Level = semver.Major
+		class.Rule = "a breaking marker makes a major release"
+		return class
+	}
 	if !found {
-		return semver.NotConventional
+		class.Rule = "the subject has no conventional type"
+		return class
 	}
-	commitType, _, _ := strings.Cut(strings.TrimSpace(typeAndScope), "(")
-	commitType = strings.ToLower(strings.TrimSpace(commitType))
-	if _, allowed := rules.allowed[commitType]; !allowed {
-		return semver.NotConventional
+	if _, allowed := rules.allowed[class.Type]; !allowed {
+		class.Rule = fmt.Sprintf("type %q is not an allowed type", class.Type)
+		return class
 	}
-	return rules.levels[commitType]
+	class.Level = rules.levels[class.Type]
+	class.Rule = fmt.Sprintf("type %q makes a %s release", class.Type, levelName(class.Level))
+	return class
+}
+
+// levelName gives the bump name of a commit level, or "none".
+func levelName(level semver.CommitType) string {
+	switch level {
+	case semver.Patch:
+		return BumpPatch
+	case semver.Minor:
+		return BumpMinor
+	case semver.Major:
+		return BumpMajor
+	}
+	return "none"
+}
+
+func analyzeCommitMessage(message string, rules bumpRules) semver.CommitType {
+	return classifyCommit(message, rules).Level
 }
 
 // AnalyzeCommitMessage gives the version part that one commit subject changes.
@@ -210,113 +279,96 @@ func ParseVersionInfo(line string) (*VersionInfo, error) {
 	}
 
 	parts := strings.Split(split[0], "/")
-	versionPart := strings.TrimPrefix(parts[len(parts)-1], "v")
 	packageName := strings.Join(parts[:len(parts)-1], "/")
-
-	versionComponents := strings.SplitN(versionPart, "-", 2)
-	version := versionComponents[0]
-
-	var preRelease, build string
-	if len(versionComponents) > 1 {
-		preRelease = versionComponents[1]
-	}
-
-	buildComponents := strings.SplitN(preRelease, "+", 2)
-	if len(buildComponents) > 1 {
-		preRelease = buildComponents[0]
-		build = buildComponents[1]
-	}
-
-	var major, minor, patch uint32
-	n, err := fmt.Sscanf(version, "%d.%d.%d", &major, &minor, &patch)
-	if err != nil || n != 3 {
-		return nil, fmt.Errorf("error parsing version: count: %d err: %w", n, err)
+	version, err := semver.Parse(strings.TrimPrefix(parts[len(parts)-1], "v"))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing version: %w", err)
 	}
 
-	info := &VersionInfo{
-		Package: packageName,
-		Version: &semver.Semver{
-			Major:      major,
-			Minor:      minor,
-			Patch:      patch,
-			PreRelease: preRelease,
-			Build:      build,
-		},
+	return &VersionInfo{
+		Package:    packageName,
+		Version:    version,
 		CommitHash: split[1],
-	}
-
-	return info, nil
+	}, nil
 }
 
 // tagger runs one tagging pass. It holds the repository tags, so it reads them
 // only one time for all of the directory groups.
 type tagger struct {
-	config     Config
-	rules      bumpRules
-	head       string
-	tags       []*VersionInfo
-	tagsLoaded bool
+	repo        Repository
+	config      Config
+	rules       bumpRules
+	identifiers identifierTemplates
+	policies    []releasePolicy
+	approvers   []string
+	headData    IdentifierData
+	verifier    *signatureVerifier
+	root        string
+	head        string
+	tags        []TagRef
+	tagsLoaded  bool
+	// shallow tells that the run works in a shallow clone that it may deepen.
+	shallow bool
+	// history holds the history of every group when the repository reads it
+	// in one pass. It is nil when each group reads its own commits.
+	history *historyIndex
 }
 
-// loadTags reads every tag one time. A tag that is not a version, such as
-// "nightly", is skipped instead of stopping the run.
-func (t *tagger) loadTags() error {
+// loadTags reads every tag one time. Each group reads the versions from these
+// tags with its own tag format.
+func (t *tagger) loadTags(ctx context.Context) error {
 	if t.tagsLoaded {
 		return nil
 	}
 
-	lines, err := repositoryTagLines()
+	tags, err := t.repo.Tags(ctx)
 	if err != nil {
 		return err
 	}
-
-	for _, line := range lines {
-		logging.Log.Info(fmt.Sprintf("Tag line found: %s", line))
-		version, err := ParseVersionInfo(line)
-		if err != nil {
-			logging.Log.Info(fmt.Sprintf("Skipping tag that is not a version: %s", line))
-			continue
-		}
-		t.tags = append(t.tags, version)
+	for _, tag := range tags {
+		logging.Log.Info(fmt.Sprintf("Tag found: %s,%s", tag.Name, tag.Commit))
 	}
-
+	t.tags = tags
 	t.tagsLoaded = true
 	return nil
 }
 
 // latestVersion gives the highest released version of one group. It uses
 // semantic version precedence, not the commit date, so a tag on an old commit
-// can not hide a higher version.
-func (t *tagger) latestVersion(group DirectoryVersionInfo) (*VersionInfo, error) {
-	if err := t.loadTags(); err != nil {
+// can not hide a higher version. The tag format of the group reads the tags,
+// so a tag that is not a version of the group, such as "nightly", is skipped.
+func (t *tagger) latestVersion(ctx context.Context, group DirectoryVersionInfo) (*VersionInfo, error) {
+	return t.versionBelow(ctx, group, nil)
+}
+
+// versionBelow gives the highest released version of one group that is
+// lower than the given version. A nil version has no limit. Without such a
+// version, the group starts at 0.1.0 on the first commit.
+func (t *tagger) versionBelow(ctx context.Context, group DirectoryVersionInfo, below *semver.Semver) (*VersionInfo, error) {
+	if err := t.loadTags(ctx); err != nil {
+		return nil, err
+	}
+	format, err := newTagFormat(group.TagFormat)
+	if err != nil {
 		return nil, err
 	}
 
 	packageName := group.PackageName()
-	var highest *VersionInfo
-	for _, tag := range t.tags {
-		matches := tag.Package == packageName
-		for _, alias := range group.TagAliases {
-			matches = matches || tag.Package == alias
-		}
-		if !matches {
-			continue
-		}
-		if highest == nil || tag.Version.Compare(highest.Version) > 0 {
-			highest = tag
-		}
+	highest, err := t.highestVersion(ctx, format, append([]string{packageName}, group.TagAliases...), below)
+	if err != nil {
+		return nil, err
 	}
-
 	if highest != nil {
 		return &VersionInfo{
 			Package:    packageName,
 			Version:    highest.Version.Clone(),
 			CommitHash: highest.CommitHash,
+			format:     format,
 		}, nil
 	}
 
 	// Start at 0.1.0 so that the first conventional commit creates a later tag.
-	commit, err := firstCommit()
+	commit, err := t.repo.FirstCommit(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -324,12 +376,53 @@ func (t *tagger) latestVersion(group DirectoryVersionInfo) (*VersionInfo, error)
 		Package:    packageName,
 		Version:    semver.NewSemver(0, 1, 0),
 		CommitHash: commit,
+		format:     format,
+		initial:    true,
 	}, nil
 }
 
+// highestVersion gives the highest version tag of any of the given package
+// names, or nil when none of them has a version tag. A version that is not
+// lower than below is skipped, and a nil below has no limit. With trusted
+// signers, it skips a tag that no trusted signer signed.
+func (t *tagger) highestVersion(ctx context.Context, format *tagFormat, names []string, below *semver.Semver) (*VersionInfo, error) {
+	var highest *VersionInfo
+	for _, tag := range t.tags {
+		for _, name := range names {
+			version, matches := format.parse(tag.Name, name)
+			if !matches {
+				continue
+			}
+			if below != nil && version.Compare(below) >= 0 {
+				break
+			}
+			if highest == nil || version.Compare(highest.Version) > 0 {
+				trusted, err := t.verifier.trusted(ctx, tag.Name)
+				if err != nil {
+					return nil, err
+				}
+				if trusted {
+					highest = &VersionInfo{Package: name, Version: version, CommitHash: tag.Commit, format: format}
+				}
+			}
+			break
+		}
+	}
+	return highest, nil
+}
+
+// commitSigners gives the trusted signers that check the commits, or an empty
+// string when the run does not check commit signatures.
+func (t *tagger) commitSigners() string {
+	if t.config.SignedCommits == "" {
+		return ""
+	}
+	return t.verifier.signers
+}
+
 // analyzeCommits reads the commits of one group since its last version, then
 // works out the next version and the release notes.
-func (t *tagger) analyzeCommits(group *DirectoryVersionInfo) error {
+func (t *tagger) analyzeCommits(ctx context.Context, group *DirectoryVersionInfo) error {
 	nextVersion := group.LastVersion.Version.Clone()
 	commitPaths := group.CommitPaths()
 
@@ -338,19 +431,51 @@ func (t *tagger) analyzeCommits(group *DirectoryVersionInfo) error {
 		group.LastVersion.Package,
 		commitPaths,
 	))
-	commits, err := commitMessages(group.LastVersion.CommitHash, commitPaths)
+	var verifier *signatureVerifier
+	if t.config.SignedCommits != "" {
+		verifier = t.verifier
+	}
+	commits, err := t.commits(ctx, group.LastVersion.CommitHash, commitPaths)
 	if err != nil {
 		return err
 	}
 
 	highest := semver.NotConventional
 	releaseNotes := []string{}
+	unverified := []string{}
+	var counted []Commit
+	// The commits come newest first, so an approval covers every commit
+	// after it in the loop.
+	approved := false
+	uncovered := 0
+	var unapproved []Commit
+	// A commit without a trusted signature blocks the release when the run
+	// fails on such commits.
+	var unverifiedBlock error
 	for _, commit := range commits {
 		logging.Log.Info(fmt.Sprintf("Analyzing Commit: %s", commit.Subject))
+		note := commit.Subject
+		if verifier != nil && !verifiedCommit(commit) {
+			if t.config.SignedCommits == SignedCommitsFail && unverifiedBlock == nil {
+				unverifiedBlock = &UnverifiedCommitError{Package: group.LastVersion.Package, Commit: commit}
+			}
+			logging.Log.Warn(fmt.Sprintf("Not counting unverified commit %s: %s", commit.Hash, commit.Subject))
+			unverified = append(unverified, commit.Hash)
+			releaseNotes = append(releaseNotes, note+unverifiedMarker)
+			continue
+		}
 		commitType := analyzeCommitMessage(commit.Message, t.rules)
+		approved = approved || approvedBy(commit.Message, t.approvers)
+		if commitType == semver.Major && !approved {
+			uncovered++
+			if t.config.BreakingApproval && hasBreakingChange(commit.Message) {
+				unapproved = append(unapproved, commit)
+			}
+		}
 		if commitType > highest {
 			highest = commitType
 		}
+		counted = append(counted, commit)
 		switch commitType {
 		case semver.NotConventional:
 			logging.Log.Info("Not a conventional commit")
@@ -361,16 +486,83 @@ func (t *tagger) analyzeCommits(group *DirectoryVersionInfo) error {
 		case semver.Major:
 			logging.Log.Info("Found Major commit")
 		}
-		releaseNotes = append(releaseNotes, commit.Subject)
+		releaseNotes = append(releaseNotes, note)
 	}
 
-	nextVersion.BumpVersion(highest, t.config.PreReleaseString, t.config.BuildString)
+	group.ReleaseNotes = releaseNotes
+	group.commits = counted
+	// A policy with unless_approved reads the approval, whether or not the
+	// run requires one.
+	group.approved = approved && uncovered == 0
+	if verifier != nil {
+		group.UnverifiedCommits = unverified
+	}
+	group.Blocked = unverifiedBlock
+	// A release at HEAD keeps the version of its tag.
+	if group.AlreadyReleased {
+		return nil
+	}
+	group.UnreleasedCommits = len(commits)
+	if len(unapproved) > 0 {
+		var block error = &UnapprovedBreakingError{Package: group.LastVersion.Package, Commits: unapproved}
+		if group.Blocked != nil {
+			block = errors.Join(group.Blocked, block)
+		}
+		group.Blocked = block
+	}
+	if group.Blocked != nil {
+		// A blocked target keeps its last version at HEAD.
+		group.NextVersion = &VersionInfo{
+			Package:    group.LastVersion.Package,
+			Version:    nextVersion,
+			CommitHash: t.head,
+			format:     group.LastVersion.format,
+		}
+		return nil
+	}
+
+	data := t.headData
+	data.Package = group.LastVersion.Package
+	data.CommitCount = len(commits)
+	preRelease, build, counter, err := t.identifiers.render(data)
+	if err != nil {
+		return fmt.Errorf("package %q: %w", group.LastVersion.Package, err)
+	}
+	if counter {
+		nextVersion.BumpCountedVersion(preRelease, build)
+	} else {
+		nextVersion.BumpVersion(highest, preRelease, build)
+	}
 
 	group.NextVersion = &VersionInfo{
 		Package:    group.LastVersion.Package,
 		Version:    nextVersion,
 		CommitHash: t.head,
+		format:     group.LastVersion.format,
 	}
-	group.ReleaseNotes = releaseNotes
+	return nil
+}
+
+// findRelease finds a group whose last version tag points at HEAD, such as
+// after a rerun of a release job. The group reports that release again: its
+// last version becomes the version before it, and its next version is the
+// release at HEAD.
+func (t *tagger) findRelease(ctx context.Context, group *DirectoryVersionInfo) error {
+	released := group.LastVersion
+	if released.initial || released.CommitHash != t.head {
+		return nil
+	}
+	previous, err := t.versionBelow(ctx, *group, released.Version)
+	if err != nil {
+		return err
+	}
+	tag, err := tagFor(released)
+	if err != nil {
+		return err
+	}
+	logging.Log.Info(fmt.Sprintf("HEAD is already released as %s", tag))
+	group.LastVersion = previous
+	group.NextVersion = released
+	group.AlreadyReleased = true
 	return nil
 }
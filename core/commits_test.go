@@ -175,3 +175,43 @@ func TestParseVersionInfoRejectsANonVersionTag(t *testing.T) {
 	_, err := ParseVersionInfo("nightly,abc123")
 	assert.Error(t, err)
 }
+
+func TestApprovedByReadsTheApprovalTrailer(t *testing.T) {
+	message := "feat!: drop the v1 client\n\nThe v1 client is gone.\n\nBreaking-Approved-By: Jane Doe <jane@example.com>"
+
+	assert.True(t, approvedBy(message, nil))
+	assert.True(t, approvedBy(message, []string{"Jane Doe"}))
+	assert.True(t, approvedBy(message, []string{"jane@example.com"}))
+	assert.True(t, approvedBy(message, []string{"Jane Doe <jane@example.com>"}))
+	assert.False(t, approvedBy(message, []string{"John Roe"}))
+	assert.True(t, approvedBy("fix: x\n\nbreaking-approved-by: ops", []string{"ops"}))
+	assert.False(t, approvedBy("feat!: drop the v1 client", nil))
+	assert.False(t, approvedBy("feat!: x\n\nBreaking-Approved-By:  ", nil))
+	assert.Equal(t, []string{"Jane Doe", "ops"}, approverList([]string{"Jane Doe, ops", ""}))
+}
+
+func TestApprovedByReadsOnlyTheTrailerBlock(t *testing.T) {
+	// Prose in the subject or the body is not a trailer.
+	assert.False(t, approvedBy("feat!: x\n\nBreaking-Approved-By: nobody yet\nwe still need one.\n\nSigned-off-by: Jo <jo@example.com>", nil))
+	assert.False(t, approvedBy("feat!: x\n\nBreaking-Approved-By: nobody yet\n\nThe v1 client is gone.", nil))
+	assert.False(t, approvedBy("Breaking-Approved-By: ops", nil))
+	assert.True(t, approvedBy("feat!: x\n\nBody.\n\nSigned-off-by: Jo <jo@example.com>\nBreaking-Approved-By: Jane\n  Doe <jane@example.com>\n", []string{"Jane Doe"}))
+}
+
+func TestClassifyCommitTellsTheRule(t *testing.T) {
+	rules, err := newBumpRules(Config{AllowedTypes: []string{"fix", "feat"}})
+	require.NoError(t, err)
+
+	assert.Equal(t, commitClass{
+		Type: "fix", Scope: "parser", Level: semver.Patch, Rule: `type "fix" makes a patch release`,
+	}, classifyCommit("fix(parser): read tabs", rules))
+	assert.Equal(t, commitClass{
+		Type: "chore", Rule: `type "chore" is not an allowed type`,
+	}, classifyCommit("chore: tidy", rules))
+	assert.Equal(t, commitClass{
+		Type: "feat", Breaking: "BREAKING CHANGE", Rule: "a breaking marker is not an allowed type",
+	}, classifyCommit("feat: move it\n\nBREAKING CHANGE: old paths fail", rules))
+	assert.Equal(t, commitClass{
+		Rule: "the subject has no conventional type",
+	}, classifyCommit("tidy things", rules))
+}
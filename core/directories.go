@@ -1,19 +1,29 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
+
+	"github.com/catalystcommunity/semver-tags/core/semver"
 )
 
 // TargetConfig separates the public release name from the paths that affect
 // the release.
 type TargetConfig struct {
-	Name  string   `mapstructure:"name" yaml:"name"`
-	Paths []string `mapstructure:"paths" yaml:"paths"`
+	Name      string   `mapstructure:"name" yaml:"name"`
+	Paths     []string `mapstructure:"paths" yaml:"paths"`
+	TagFormat string   `mapstructure:"tag_format" yaml:"tag_format,omitempty"`
+	// PreviousNames keeps the version series of a renamed target. The
+	// latest version of any of these names counts as a version of the target.
+	PreviousNames []string `mapstructure:"previous_names" yaml:"previous_names,omitempty"`
+	// VersionFiles lists the files that a release commit updates for this
+	// target. An empty list uses Config.VersionFiles.
+	VersionFiles []VersionFile `mapstructure:"version_files" yaml:"version_files,omitempty"`
 }
 
 // DirectoryVersionInfo holds one release target. Package is its public name.
@@ -29,6 +39,82 @@ type DirectoryVersionInfo struct {
 	NextVersion  *VersionInfo
 	ReleaseNotes []string
 	RootRelative bool
+	// TagFormat renders and reads the tags of this target. An empty value
+	// uses the default format.
+	TagFormat string
+	// SnapshotVersion is set only in a snapshot run. It is never tagged.
+	SnapshotVersion string
+	// SigningKey names the key that signed the new tag. It is empty when the
+	// run does not sign or the target has no new tag.
+	SigningKey string
+	// UnverifiedCommits lists the commits without a trusted signature that
+	// the run did not count. It is nil when the run does not check commits.
+	UnverifiedCommits []string
+	// AlreadyReleased tells that a version tag of this target points at
+	// HEAD, such as in a rerun of a release job. NextVersion is that release,
+	// and LastVersion is the version before it.
+	AlreadyReleased bool
+	// LostTags lists the new tags of this target that another run pushed
+	// first, in the order the run lost them.
+	LostTags []string
+	// UnreleasedCommits is the number of commits of the target after its last
+	// version. It is zero for a release at HEAD.
+	UnreleasedCommits int
+	// Policy is the strongest action of the release policies that apply to
+	// the new version, or "" when none applies.
+	Policy string
+	// PolicyRules names the policies that apply, in the configuration order.
+	PolicyRules []string
+	// Blocked is the reason that the target can not release, such as an
+	// UnapprovedBreakingError or an UnverifiedCommitError. A blocked target
+	// keeps its last version. A run fails with the reason, and the commands
+	// that only read report it.
+	Blocked error
+	// Explanation tells how the run worked out the version. It is nil unless
+	// the run explains its decisions.
+	Explanation *Explanation
+	// VersionFiles lists the files that a release commit updates for this
+	// target.
+	VersionFiles []VersionFile
+	// commits holds the commits that the version counts, newest first.
+	commits []Commit
+	// approved tells that a BreakingApprovalTrailer covers every commit of
+	// the major level.
+	approved bool
+}
+
+// home gives the first path of the target, relative to the root, where its
+// version files and changelog are.
+func (d *DirectoryVersionInfo) home() string {
+	if len(d.Directories) == 0 {
+		return ""
+	}
+	return path.Clean(d.Directories[0])
+}
+
+// hasNewVersion tells if the next version differs from the last version.
+func (d *DirectoryVersionInfo) hasNewVersion() bool {
+	return d.NextVersion != nil &&
+		d.LastVersion.Version.FormattedString() != d.NextVersion.Version.FormattedString()
+}
+
+// ReleasePending tells if a run would make a new tag for the target. A
+// release at HEAD has its tag, and a policy can block the release or make it
+// a dry run.
+func (d *DirectoryVersionInfo) ReleasePending() bool {
+	return d.hasNewVersion() && !d.AlreadyReleased && d.Policy != PolicyBlock && d.Policy != PolicyDryRun
+}
+
+// BlockedError joins the reason of every blocked target, or gives nil when
+// no target is blocked.
+func BlockedError(results []DirectoryVersionInfo) error {
+	var blocks []error
+	for _, result := range results {
+		if result.Blocked != nil {
+			blocks = append(blocks, result.Blocked)
+		}
+	}
+	return errors.Join(blocks...)
 }
 
 // PackageName gives the package part of the tag. Parsed targets store this
@@ -99,6 +185,28 @@ func splitDirectoryGroup(value string) []string {
 	return members
 }
 
+// validateTagFormat checks that the tag format of one target reads back its
+// own tags and makes tag names that git accepts.
+func validateTagFormat(group DirectoryVersionInfo) error {
+	format, err := newTagFormat(group.TagFormat)
+	if err != nil {
+		return err
+	}
+	sample := semver.NewSemver(1, 2, 3)
+	sample.PreRelease = "rc.1"
+	tag, err := format.tag(group.PackageName(), sample)
+	if err != nil {
+		return err
+	}
+	if version, matches := format.parse(tag, group.PackageName()); !matches || version.Compare(sample) != 0 {
+		return fmt.Errorf("tag format %q can not read back its own tag %q", format.text, tag)
+	}
+	if !validRefName("refs/tags/" + tag) {
+		return fmt.Errorf("tag format %q makes %q, which is not a valid Git tag", format.text, tag)
+	}
+	return nil
+}
+
 // ParseTargetSpecifications reads the compact form that the command-line and
 // environment interfaces use. A comma separates paths. This form does not
 // have an escaping syntax.
@@ -196,7 +304,7 @@ func validateTargetName(name string) error {
 			name,
 		)
 	}
-	if _, err := runGit("check-ref-format", "refs/tags/"+name+"/v0.0.0"); err != nil {
+	if !validRefName("refs/tags/" + name + "/v0.0.0") {
 		return fmt.Errorf("target name %q is not a valid Git tag prefix", name)
 	}
 	return nil
@@ -228,6 +336,7 @@ func newNamedTarget(target TargetConfig, gitRoot string) (DirectoryVersionInfo,
 		Package:      target.Name,
 		FullPath:     gitRoot,
 		RootRelative: true,
+		TagFormat:    target.TagFormat,
 	}
 	if err := validateTargetName(target.Name); err != nil {
 		return group, err
@@ -243,6 +352,23 @@ func newNamedTarget(target TargetConfig, gitRoot string) (DirectoryVersionInfo,
 		}
 		group.Directories = appendNewPath(group.Directories, normalized)
 	}
+
+	for _, previousName := range target.PreviousNames {
+		if err := validateTargetName(previousName); err != nil {
+			return group, fmt.Errorf("target %q previous name: %w", target.Name, err)
+		}
+		if previousName == target.Name {
+			return group, fmt.Errorf("target %q can not list its own name as a previous name", target.Name)
+		}
+		group.TagAliases = appendNewPath(group.TagAliases, previousName)
+	}
+
+	for _, file := range target.VersionFiles {
+		if err := validateVersionFile(file); err != nil {
+			return group, fmt.Errorf("target %q: %w", target.Name, err)
+		}
+	}
+	group.VersionFiles = target.VersionFiles
 	return group, nil
 }
 
@@ -340,5 +466,28 @@ func ParseReleaseTargets(
 		groups = append(groups, group)
 	}
 
+	// A previous name must not read the tags of another target.
+	targetForPreviousName := map[string]string{}
+	for _, group := range groups {
+		if !group.RootRelative {
+			continue
+		}
+		for _, alias := range group.TagAliases {
+			if owner, found := groupForPackage[alias]; found {
+				return nil, fmt.Errorf(
+					"target %q lists the previous name %q, which %s still uses",
+					group.PackageName(), alias, owner,
+				)
+			}
+			if owner, found := targetForPreviousName[alias]; found {
+				return nil, fmt.Errorf(
+					"targets %q and %q both list the previous name %q",
+					owner, group.PackageName(), alias,
+				)
+			}
+			targetForPreviousName[alias] = group.PackageName()
+		}
+	}
+
 	return groups, nil
 }
@@ -0,0 +1,302 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/catalystcommunity/semver-tags/core/semver"
+)
+
+// Explanation tells how a run worked out the version of one target. A run
+// fills it only when Config.Explain is set.
+type Explanation struct {
+	// BaseTag is the tag of the last version, or "" when the target has no
+	// version tag.
+	BaseTag    string
+	BaseCommit string
+	BaseReason string
+	// IgnoredTags lists the other version tags of the target, in the tag
+	// order of the repository.
+	IgnoredTags []IgnoredTag
+	// Commits lists the commits after the base, newest first.
+	Commits []CommitExplanation
+	// Bump tells how the commits gave the next version.
+	Bump string
+}
+
+// IgnoredTag is a version tag of the target that the run did not take as
+// the base, and why.
+type IgnoredTag struct {
+	Tag    string
+	Commit string
+	Reason string
+}
+
+// CommitExplanation is what the bump rules read from one commit.
+type CommitExplanation struct {
+	Hash    string
+	Subject string
+	// Paths lists the target paths that the commit changes. It is nil when
+	// the target has one path.
+	Paths    []string
+	Type     string
+	Scope    string
+	Breaking string
+	// Level is the bump name that the commit gives, or "none".
+	Level string
+	// Rule tells which rule gave the level.
+	Rule string
+	// Note tells why the run did not count the commit as the rules read it,
+	// such as a missing signature. It is "" for a counted commit.
+	Note string
+}
+
+// explain fills the explanation of each analyzed target.
+func (t *tagger) explain(ctx context.Context, results []DirectoryVersionInfo) error {
+	for idx := range results {
+		group := &results[idx]
+		explanation := &Explanation{}
+		if err := t.explainBase(group, explanation); err != nil {
+			return err
+		}
+		if err := t.explainCommits(ctx, group, explanation); err != nil {
+			return err
+		}
+		group.Explanation = explanation
+	}
+	return nil
+}
+
+// explainBase tells which tag is the base of the target, and why every
+// other version tag of the target is not.
+func (t *tagger) explainBase(group *DirectoryVersionInfo, explanation *Explanation) error {
+	base := group.LastVersion
+	format := base.tagFormat()
+	packageName := group.PackageName()
+	names := append([]string{packageName}, group.TagAliases...)
+
+	var below *semver.Semver
+	if group.AlreadyReleased {
+		below = group.NextVersion.Version
+	}
+	baseName := ""
+	for _, tag := range t.tags {
+		for _, name := range names {
+			version, matches := format.parse(tag.Name, name)
+			if !matches {
+				continue
+			}
+			if !base.initial && baseName == "" && tag.Commit == base.CommitHash &&
+				version.Compare(base.Version) == 0 {
+				explanation.BaseTag, explanation.BaseCommit, baseName = tag.Name, tag.Commit, name
+				break
+			}
+			ignored := IgnoredTag{Tag: tag.Name, Commit: tag.Commit}
+			switch {
+			case below != nil && tag.Commit == t.head && version.Compare(below) == 0:
+				ignored.Reason = "it is the release at HEAD"
+			case below != nil && version.Compare(below) > 0:
+				ignored.Reason = "it is not lower than the release at HEAD"
+			case base.initial || version.Compare(base.Version) > 0:
+				ignored.Reason = "no trusted signer signed it"
+			case version.Compare(base.Version) == 0:
+				ignored.Reason = "it has the version of the base"
+			default:
+				ignored.Reason = "it is lower than the base"
+			}
+			explanation.IgnoredTags = append(explanation.IgnoredTags, ignored)
+			break
+		}
+	}
+
+	if base.initial {
+		explanation.BaseCommit = base.CommitHash
+		explanation.BaseReason = "the target has no version tag, so it starts at 0.1.0 on the first commit"
+		return nil
+	}
+	reason := "the highest version tag of the target"
+	if baseName != packageName {
+		reason += fmt.Sprintf(", under the previous name %q", baseName)
+	}
+	if group.AlreadyReleased {
+		release, err := tagFor(group.NextVersion)
+		if err != nil {
+			return err
+		}
+		reason += " below " + release + ", which points at HEAD"
+	}
+	if t.verifier != nil {
+		reason += ", signed by a trusted signer"
+	}
+	explanation.BaseReason = reason
+	return nil
+}
+
+// explainCommits reads the commits of the target after its base again, and
+// tells what the rules read from each one and how they gave the bump.
+func (t *tagger) explainCommits(ctx context.Context, group *DirectoryVersionInfo, explanation *Explanation) error {
+	commitPaths := group.CommitPaths()
+	commits, err := t.commits(ctx, group.LastVersion.CommitHash, commitPaths)
+	if err != nil {
+		return err
+	}
+
+	// With more than one path, each path reads its own commits to tell which
+	// paths a commit changes.
+	paths := map[string][]string{}
+	if len(commitPaths) > 1 {
+		for idx, commitPath := range commitPaths {
+			pathCommits, err := t.commits(ctx, group.LastVersion.CommitHash, []string{commitPath})
+			if err != nil {
+				return err
+			}
+			for _, commit := range pathCommits {
+				paths[commit.Hash] = append(paths[commit.Hash], group.Directories[idx])
+			}
+		}
+	}
+
+	highest := semver.NotConventional
+	setBy := -1
+	approved := false
+	for _, commit := range commits {
+		class := classifyCommit(commit.Message, t.rules)
+		entry := CommitExplanation{
+			Hash:     commit.Hash,
+			Subject:  commit.Subject,
+			Paths:    paths[commit.Hash],
+			Type:     class.Type,
+			Scope:    class.Scope,
+			Breaking: class.Breaking,
+			Level:    levelName(class.Level),
+			Rule:     class.Rule,
+		}
+		counted := true
+		switch {
+		case t.config.SignedCommits != "" && !verifiedCommit(commit):
+			entry.Note = "not counted: the commit has no trusted signature"
+			counted = false
+		case t.config.BreakingApproval && class.Level == semver.Major && class.Breaking != "":
+			approved = approved || approvedBy(commit.Message, t.approvers)
+			if approved {
+				entry.Note = "the breaking change is approved"
+			} else {
+				entry.Note = "the breaking change needs a " + BreakingApprovalTrailer + " trailer"
+			}
+		case t.config.BreakingApproval:
+			approved = approved || approvedBy(commit.Message, t.approvers)
+		}
+		explanation.Commits = append(explanation.Commits, entry)
+		if counted && class.Level > highest {
+			highest = class.Level
+			setBy = len(explanation.Commits) - 1
+		}
+	}
+
+	var setByCommit *CommitExplanation
+	if setBy >= 0 {
+		setByCommit = &explanation.Commits[setBy]
+	}
+	bump, err := explainBump(group, highest, setByCommit)
+	if err != nil {
+		return err
+	}
+	explanation.Bump = bump
+	return nil
+}
+
+// explainBump tells how the highest commit level gave the next version.
+func explainBump(group *DirectoryVersionInfo, highest semver.CommitType, setBy *CommitExplanation) (string, error) {
+	if group.AlreadyReleased {
+		release, err := tagFor(group.NextVersion)
+		if err != nil {
+			return "", err
+		}
+		return "HEAD already has the release " + release + ", so the run reports it again", nil
+	}
+
+	last := strings.TrimPrefix(group.LastVersion.Version.FormattedString(), "v")
+	next := strings.TrimPrefix(group.NextVersion.Version.FormattedString(), "v")
+	var bump string
+	if setBy == nil {
+		bump = "no counted commit has a release level"
+	} else {
+		bump = fmt.Sprintf("the highest level is %s, from %s %q", levelName(highest), shortHash(setBy.Hash), setBy.Subject)
+	}
+	switch {
+	case last == next:
+		bump += fmt.Sprintf("; the version stays %s", last)
+	case group.NextVersion.Version.PreRelease != "":
+		bump += fmt.Sprintf("; the pre-release identifiers give %s -> %s", last, next)
+	default:
+		bump += fmt.Sprintf("; %s -> %s", last, next)
+	}
+	if group.Blocked != nil {
+		bump += "; the release is blocked: " + group.Blocked.Error()
+	}
+	if group.Policy != "" {
+		bump += fmt.Sprintf("; the release policies %s apply with action %s", strings.Join(group.PolicyRules, ", "), group.Policy)
+	}
+	if group.SnapshotVersion != "" {
+		bump += "; the snapshot version is " + group.SnapshotVersion
+	}
+	return bump, nil
+}
+
+// WriteExplanations writes the explanation of each target as plain text, in
+// the order of the results. A target without an explanation is skipped.
+func WriteExplanations(out io.Writer, results []DirectoryVersionInfo) error {
+	var text strings.Builder
+	for _, result := range results {
+		explanation := result.Explanation
+		if explanation == nil {
+			continue
+		}
+		name := result.PackageName()
+		if name == "" {
+			name = "."
+		}
+		fmt.Fprintf(&text, "target %s\n", name)
+		if explanation.BaseTag != "" {
+			fmt.Fprintf(&text, "  base: %s at %s\n", explanation.BaseTag, shortHash(explanation.BaseCommit))
+		} else {
+			fmt.Fprintf(&text, "  base: first commit %s\n", shortHash(explanation.BaseCommit))
+		}
+		fmt.Fprintf(&text, "    %s\n", explanation.BaseReason)
+		for _, ignored := range explanation.IgnoredTags {
+			fmt.Fprintf(&text, "  ignored: %s at %s: %s\n", ignored.Tag, shortHash(ignored.Commit), ignored.Reason)
+		}
+		if len(explanation.Commits) == 0 {
+			text.WriteString("  commits: none\n")
+		}
+		for _, commit := range explanation.Commits {
+			fmt.Fprintf(&text, "  commit %s %s\n", shortHash(commit.Hash), commit.Subject)
+			parsed := "type=" + valueOrDash(commit.Type) + " scope=" + valueOrDash(commit.Scope) +
+				" breaking=" + valueOrDash(commit.Breaking)
+			if len(commit.Paths) > 0 {
+				parsed += " paths=" + strings.Join(commit.Paths, ",")
+			}
+			fmt.Fprintf(&text, "    %s\n", parsed)
+			fmt.Fprintf(&text, "    level %s: %s\n", commit.Level, commit.Rule)
+			if commit.Note != "" {
+				fmt.Fprintf(&text, "    %s\n", commit.Note)
+			}
+		}
+		fmt.Fprintf(&text, "  bump: %s\n", explanation.Bump)
+	}
+	_, err := io.WriteString(out, text.String())
+	return err
+}
+
+func shortHash(hash string) string {
+	return hash[:min(7, len(hash))]
+}
+
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
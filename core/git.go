@@ -1,16 +1,25 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // gitError makes an error that keeps the standard error of a failed git
 // command. exec.Cmd.Output gives only the standard output, so without this the
 // error tells you nothing about the cause.
-func gitError(args []string, err error) error {
+func gitError(ctx context.Context, args []string, err error) error {
+	// A canceled command dies from a signal, which hides the cause.
+	if ctx.Err() != nil {
+		return fmt.Errorf("git %s: %w", strings.Join(args, " "), ctx.Err())
+	}
 	var exitError *exec.ExitError
 	if errors.As(err, &exitError) {
 		detail := strings.TrimSpace(string(exitError.Stderr))
@@ -21,19 +30,54 @@ func gitError(args []string, err error) error {
 	return fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
 }
 
-// runGit runs one git command and gives its standard output.
-func runGit(args ...string) (string, error) {
-	output, err := exec.Command("git", args...).Output()
+// GitRepository is the Repository that runs the git command.
+type GitRepository struct {
+	// Dir is the directory that git runs in. An empty value uses the current
+	// directory.
+	Dir string
+}
+
+// NewGitRepository gives the repository that holds dir. An empty dir uses the
+// current directory.
+func NewGitRepository(dir string) *GitRepository {
+	return &GitRepository{Dir: dir}
+}
+
+// run runs one git command and gives its standard output.
+func (r *GitRepository) run(ctx context.Context, args ...string) (string, error) {
+	return r.runWithEnv(ctx, nil, args...)
+}
+
+// runWithEnv runs one git command with more environment variables.
+func (r *GitRepository) runWithEnv(ctx context.Context, env []string, args ...string) (string, error) {
+	command := exec.CommandContext(ctx, "git", args...)
+	command.Dir = r.Dir
+	if len(env) > 0 {
+		command.Env = append(os.Environ(), env...)
+	}
+	output, err := command.Output()
 	if err != nil {
-		return "", gitError(args, err)
+		return "", gitError(ctx, args, err)
 	}
 	return string(output), nil
 }
 
-// gitLines runs one git command and gives its output as lines. It removes
-// empty lines, because git writes a last newline.
-func gitLines(args ...string) ([]string, error) {
-	output, err := runGit(args...)
+// runWithInput runs one git command that reads the given standard input.
+func (r *GitRepository) runWithInput(ctx context.Context, input string, args ...string) (string, error) {
+	command := exec.CommandContext(ctx, "git", args...)
+	command.Dir = r.Dir
+	command.Stdin = strings.NewReader(input)
+	output, err := command.Output()
+	if err != nil {
+		return "", gitError(ctx, args, err)
+	}
+	return string(output), nil
+}
+
+// lines runs one git command and gives its output as lines. It removes empty
+// lines, because git writes a last newline.
+func (r *GitRepository) lines(ctx context.Context, args ...string) ([]string, error) {
+	output, err := r.run(ctx, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -47,37 +91,184 @@ func gitLines(args ...string) ([]string, error) {
 	return lines, nil
 }
 
-// IsGitRepo tells if the current directory is in a git work tree.
-func IsGitRepo() bool {
-	output, err := runGit("rev-parse", "--is-inside-work-tree")
+// value runs one git command and gives its output without the last newline.
+func (r *GitRepository) value(ctx context.Context, args ...string) (string, error) {
+	output, err := r.run(ctx, args...)
 	if err != nil {
-		return false
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// configValue gives one git configuration value. An unset value gives an
+// empty string, because git config exits with status 1 for it.
+func (r *GitRepository) configValue(ctx context.Context, name string) (string, error) {
+	command := exec.CommandContext(ctx, "git", "config", "--get", name)
+	command.Dir = r.Dir
+	output, err := command.Output()
+	if err != nil {
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) && exitError.ExitCode() == 1 {
+			return "", nil
+		}
+		return "", gitError(ctx, []string{"config", "--get", name}, err)
 	}
-	return strings.TrimSpace(output) == "true"
+	return strings.TrimSpace(string(output)), nil
+}
+
+// IsGitRepo tells if the current directory is in a git work tree.
+func IsGitRepo() bool {
+	output, err := NewGitRepository("").value(context.Background(), "rev-parse", "--is-inside-work-tree")
+	return err == nil && output == "true"
 }
 
 // GetGitRootDir gives the top directory of the current git repository.
 func GetGitRootDir() (string, error) {
-	output, err := runGit("rev-parse", "--show-toplevel")
-	if err != nil {
+	return NewGitRepository("").Root(context.Background())
+}
+
+// Root gives the top directory of the work tree.
+func (r *GitRepository) Root(ctx context.Context) (string, error) {
+	inside, err := r.value(ctx, "rev-parse", "--is-inside-work-tree")
+	if err != nil && ctx.Err() != nil {
 		return "", err
 	}
-	return strings.TrimSpace(output), nil
+	if err != nil || inside != "true" {
+		return "", errors.New("current directory is not a git repo, nothing to do")
+	}
+	return r.value(ctx, "rev-parse", "--show-toplevel")
+}
+
+// Head gives the commit that a new tag points at.
+func (r *GitRepository) Head(ctx context.Context) (string, error) {
+	return r.value(ctx, "rev-parse", "HEAD")
+}
+
+// ShortCommit gives the unique abbreviation of one commit.
+func (r *GitRepository) ShortCommit(ctx context.Context, commit string) (string, error) {
+	return r.value(ctx, "rev-parse", "--short", commit)
+}
+
+// CurrentBranch gives the name of the checked-out branch. A detached HEAD
+// gives "HEAD".
+func (r *GitRepository) CurrentBranch(ctx context.Context) (string, error) {
+	return r.value(ctx, "rev-parse", "--abbrev-ref", "HEAD")
+}
+
+// BranchCommit gives the commit at the tip of one local branch.
+func (r *GitRepository) BranchCommit(ctx context.Context, branch string) (string, error) {
+	return r.verify(ctx, "refs/heads/"+branch+"^{commit}")
+}
+
+// verify gives the object that a revision names, or "" when it names none.
+// git rev-parse --verify --quiet exits with status 1 for a missing object.
+func (r *GitRepository) verify(ctx context.Context, revision string) (string, error) {
+	args := []string{"rev-parse", "--verify", "--quiet", revision}
+	command := exec.CommandContext(ctx, "git", args...)
+	command.Dir = r.Dir
+	output, err := command.Output()
+	if err != nil {
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) && exitError.ExitCode() == 1 {
+			return "", nil
+		}
+		return "", gitError(ctx, args, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// Changes gives the changed and untracked paths that git status lists.
+func (r *GitRepository) Changes(ctx context.Context) ([]string, error) {
+	output, err := r.run(ctx, "status", "--porcelain", "-z", "--untracked-files=all")
+	if err != nil {
+		return nil, fmt.Errorf("can not read the state of the work tree: %w", err)
+	}
+	var paths []string
+	entries := strings.Split(output, "\x00")
+	for index := 0; index < len(entries); index++ {
+		entry := entries[index]
+		if len(entry) < 4 {
+			continue
+		}
+		paths = append(paths, entry[3:])
+		// A rename or a copy gives the old path as the next entry.
+		if entry[0] == 'R' || entry[0] == 'C' {
+			index++
+		}
+	}
+	return paths, nil
+}
+
+// ReadFile reads one file of the work tree.
+func (r *GitRepository) ReadFile(ctx context.Context, path string) ([]byte, error) {
+	root, err := r.Root(ctx)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(path)))
+	if err != nil {
+		return nil, fmt.Errorf("can not read %s: %w", path, err)
+	}
+	return content, nil
 }
 
-// headCommit gives the commit that a new tag points at.
-func headCommit() (string, error) {
-	output, err := runGit("rev-parse", "HEAD")
+// CommitFiles writes and commits the files, then points the branch at the
+// new commit.
+func (r *GitRepository) CommitFiles(ctx context.Context, branch string, message string, files map[string][]byte) (string, error) {
+	root, err := r.Root(ctx)
 	if err != nil {
 		return "", err
 	}
-	return strings.TrimSpace(output), nil
+	paths, err := writeWorkTreeFiles(root, files)
+	if err != nil {
+		return "", err
+	}
+	if _, err := r.run(ctx, append([]string{"add", "--"}, paths...)...); err != nil {
+		return "", fmt.Errorf("can not add the release files: %w", err)
+	}
+	args := append([]string{"commit", "--quiet", "--message", message, "--only", "--"}, paths...)
+	if _, err := r.run(ctx, args...); err != nil {
+		return "", fmt.Errorf("can not make the release commit: %w", err)
+	}
+	commit, err := r.Head(ctx)
+	if err != nil {
+		return "", err
+	}
+	if _, err := r.run(ctx, "update-ref", "refs/heads/"+branch, commit); err != nil {
+		return "", fmt.Errorf("can not move the branch %s: %w", branch, err)
+	}
+	return commit, nil
 }
 
-// firstCommit gives the first commit that has no parent. It is the start point
+// ResetBranch moves HEAD and the branch back. It keeps the changes of the
+// work tree that the reset does not touch.
+func (r *GitRepository) ResetBranch(ctx context.Context, branch string, commit string) error {
+	if _, err := r.run(ctx, "reset", "--quiet", "--keep", commit); err != nil {
+		return fmt.Errorf("can not reset HEAD to %s: %w", commit, err)
+	}
+	if _, err := r.run(ctx, "update-ref", "refs/heads/"+branch, commit); err != nil {
+		return fmt.Errorf("can not move the branch %s: %w", branch, err)
+	}
+	return nil
+}
+
+// CommitTime gives the committer date of one commit.
+func (r *GitRepository) CommitTime(ctx context.Context, commit string) (time.Time, error) {
+	output, err := r.value(ctx, "show", "-s", "--format=%ct", commit)
+	if err != nil {
+		return time.Time{}, err
+	}
+	seconds, err := strconv.ParseInt(output, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("can not read the date of commit %s: %w", commit, err)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// FirstCommit gives the first commit that has no parent. It is the start point
 // for a package that has no tag yet.
-func firstCommit() (string, error) {
-	lines, err := gitLines("rev-list", "--max-parents=0", "HEAD")
+func (r *GitRepository) FirstCommit(ctx context.Context) (string, error) {
+	lines, err := r.lines(ctx, "rev-list", "--max-parents=0", "HEAD")
 	if err != nil {
 		return "", fmt.Errorf("can not get a parentless commit, so no root to determine: %w", err)
 	}
@@ -87,68 +278,495 @@ func firstCommit() (string, error) {
 	return lines[0], nil
 }
 
-// repositoryTagLines gives one "tag,commit" line for each tag in the
-// repository.
-func repositoryTagLines() ([]string, error) {
-	lines, err := gitLines(
+// Shallow tells if the repository is a shallow clone.
+func (r *GitRepository) Shallow(ctx context.Context) (bool, error) {
+	output, err := r.value(ctx, "rev-parse", "--is-shallow-repository")
+	if err != nil {
+		return false, err
+	}
+	return output == "true", nil
+}
+
+// Contains tells if the history of HEAD holds the commit. git merge-base
+// exits with status 1 for a commit that HEAD does not hold.
+func (r *GitRepository) Contains(ctx context.Context, commit string) (bool, error) {
+	// git merge-base fails for a commit that the repository does not hold.
+	if found, err := r.verify(ctx, commit+"^{commit}"); err != nil || found == "" {
+		return false, err
+	}
+	args := []string{"merge-base", "--is-ancestor", commit, "HEAD"}
+	command := exec.CommandContext(ctx, "git", args...)
+	command.Dir = r.Dir
+	if _, err := command.Output(); err != nil {
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) && exitError.ExitCode() == 1 {
+			return false, nil
+		}
+		return false, gitError(ctx, args, err)
+	}
+	return true, nil
+}
+
+// Fetch reads tags and history from the remote with git fetch.
+func (r *GitRepository) Fetch(ctx context.Context, remote string, options FetchOptions) error {
+	args := []string{"fetch", "--quiet"}
+	if options.Tags {
+		args = append(args, "--tags")
+	}
+	if options.Force {
+		args = append(args, "--force")
+	}
+	if options.Unshallow {
+		args = append(args, "--unshallow")
+	} else if options.Deepen > 0 {
+		args = append(args, fmt.Sprintf("--deepen=%d", options.Deepen))
+	}
+	if _, err := r.run(ctx, append(args, remote)...); err != nil {
+		return fmt.Errorf("can not fetch from %s: %w", remote, err)
+	}
+	return nil
+}
+
+// RemoteTagCommits asks the remote for the given tags with git ls-remote. The
+// remote also lists the peeled commit of an annotated tag, with a "^{}"
+// suffix, and that commit wins.
+func (r *GitRepository) RemoteTagCommits(ctx context.Context, remote string, tags []string) (map[string]string, error) {
+	commits := map[string]string{}
+	if len(tags) == 0 {
+		return commits, nil
+	}
+	args := []string{"ls-remote", "--tags", remote}
+	for _, tag := range tags {
+		args = append(args, "refs/tags/"+tag)
+	}
+	lines, err := r.lines(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("can not list the tags of %s: %w", remote, err)
+	}
+
+	wanted := map[string]bool{}
+	for _, tag := range tags {
+		wanted[tag] = true
+	}
+	peeled := map[string]bool{}
+	for _, line := range lines {
+		hash, ref, found := strings.Cut(line, "\t")
+		if !found {
+			continue
+		}
+		name, isPeeled := strings.CutSuffix(strings.TrimPrefix(ref, "refs/tags/"), "^{}")
+		// ls-remote matches the end of a ref, so it can give other refs.
+		if !wanted[name] || (peeled[name] && !isPeeled) {
+			continue
+		}
+		commits[name] = hash
+		peeled[name] = peeled[name] || isPeeled
+	}
+	return commits, nil
+}
+
+// RemoteBranchCommit gives the tip of one branch of the remote with git
+// ls-remote.
+func (r *GitRepository) RemoteBranchCommit(ctx context.Context, remote string, branch string) (string, error) {
+	ref := "refs/heads/" + branch
+	lines, err := r.lines(ctx, "ls-remote", "--heads", remote, ref)
+	if err != nil {
+		return "", fmt.Errorf("can not list the branches of %s: %w", remote, err)
+	}
+	for _, line := range lines {
+		// ls-remote matches the end of a ref, so it can give other refs.
+		if hash, name, found := strings.Cut(line, "\t"); found && name == ref {
+			return hash, nil
+		}
+	}
+	return "", nil
+}
+
+// CommitCount gives the number of commits after the given commit that HEAD
+// holds, which is the count that git describe writes.
+func (r *GitRepository) CommitCount(ctx context.Context, afterCommit string) (int, error) {
+	output, err := r.value(ctx, "rev-list", "--count", afterCommit+"..HEAD")
+	if err != nil {
+		return 0, err
+	}
+	count, err := strconv.Atoi(output)
+	if err != nil {
+		return 0, fmt.Errorf("can not read the commit count after %s: %w", afterCommit, err)
+	}
+	return count, nil
+}
+
+// Tags gives every tag in the repository. An annotated tag is peeled to the
+// commit it points at, so both kinds of tag give a commit.
+func (r *GitRepository) Tags(ctx context.Context) ([]TagRef, error) {
+	lines, err := r.lines(ctx,
 		"for-each-ref",
-		"--format", "%(refname:short),%(objectname)",
+		"--format", "%(refname:short),%(if)%(*objectname)%(then)%(*objectname)%(else)%(objectname)%(end)",
 		"refs/tags",
 	)
 	if err != nil {
 		return nil, fmt.Errorf("can not get git tags: %w", err)
 	}
-	return lines, nil
+
+	tags := make([]TagRef, 0, len(lines))
+	for _, line := range lines {
+		separator := strings.LastIndex(line, ",")
+		if separator < 0 {
+			continue
+		}
+		tags = append(tags, TagRef{Name: line[:separator], Commit: line[separator+1:]})
+	}
+	return tags, nil
 }
 
-type commitMessage struct {
-	Subject string
-	Message string
+// signerSettings gives the git arguments and environment that read
+// signatures with the trusted signers. A directory is a GPG home directory
+// with the trusted keyring. A file is an SSH allowed-signers file.
+func signerSettings(trustedSigners string) ([]string, []string, error) {
+	info, err := os.Stat(trustedSigners)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can not read the trusted signers: %w", err)
+	}
+	if info.IsDir() {
+		return nil, []string{"GNUPGHOME=" + trustedSigners}, nil
+	}
+	return []string{"-c", "gpg.ssh.allowedSignersFile=" + trustedSigners}, nil, nil
+}
+
+// trustedFingerprints gives the fingerprint of every key and subkey in a GPG
+// home directory of trusted signers. GPG gives a good signature of such a key
+// the "U" state when nobody marked the key as trusted, so a "U" signature
+// counts only when its key is one of these. It is nil for an SSH
+// allowed-signers file, where "U" is a good signature of any key that the
+// file does not list.
+func (r *GitRepository) trustedFingerprints(ctx context.Context, trustedSigners string) (map[string]bool, error) {
+	info, err := os.Stat(trustedSigners)
+	if err != nil {
+		return nil, fmt.Errorf("can not read the trusted signers: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, nil
+	}
+	program, err := r.configValue(ctx, "gpg.program")
+	if err != nil {
+		return nil, err
+	}
+	if program == "" {
+		program = "gpg"
+	}
+	command := exec.CommandContext(ctx, program, "--homedir", trustedSigners, "--with-colons", "--fingerprint", "--list-keys")
+	output, err := command.Output()
+	if err != nil {
+		return nil, fmt.Errorf("can not list the keys of the trusted signers: %w", err)
+	}
+	fingerprints := map[string]bool{}
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) > 9 && fields[0] == "fpr" {
+			fingerprints[strings.ToUpper(fields[9])] = true
+		}
+	}
+	return fingerprints, nil
 }
 
-// commitMessages gives the subject and full message of each commit after the
-// given commit that changed one of the given paths.
-func commitMessages(afterCommit string, paths []string) ([]commitMessage, error) {
-	args := []string{"log", "-z", "--pretty=format:%s%x00%B", fmt.Sprintf("%s..HEAD", afterCommit), "--"}
+// signatureFormat reads the signature state and the fingerprint of the key
+// of a commit, for commitSignature.
+const signatureFormat = "%G?%GF"
+
+// commitSignature gives the signature state of a commit from the
+// signatureFormat field. A "U" signature of a key that the trusted GPG home
+// directory holds is a good signature.
+func commitSignature(field string, trusted map[string]bool) string {
+	field = strings.TrimSpace(field)
+	if field == "" {
+		return ""
+	}
+	state, fingerprint := field[:1], strings.ToUpper(field[1:])
+	if state == "U" && fingerprint != "" && trusted[fingerprint] {
+		return "G"
+	}
+	return state
+}
+
+// Commits gives the subject and full message of each commit after the given
+// commit that changed one of the given paths. With trusted signers, it also
+// checks the signature of each commit.
+func (r *GitRepository) Commits(ctx context.Context, afterCommit string, paths []string, trustedSigners string) ([]Commit, error) {
+	fields := 3
+	format := "--pretty=format:%H%x00%s%x00%B"
+	var args, env []string
+	var trusted map[string]bool
+	if trustedSigners != "" {
+		var err error
+		if args, env, err = signerSettings(trustedSigners); err != nil {
+			return nil, err
+		}
+		if trusted, err = r.trustedFingerprints(ctx, trustedSigners); err != nil {
+			return nil, err
+		}
+		fields = 4
+		format += "%x00" + signatureFormat
+	}
+	args = append(args, "log", "-z", format, fmt.Sprintf("%s..HEAD", afterCommit), "--")
 	args = append(args, paths...)
-	output, err := runGit(args...)
+	output, err := r.runWithEnv(ctx, env, args...)
 	if err != nil {
 		return nil, fmt.Errorf("can not get git commits: %w", err)
 	}
 
 	parts := strings.Split(output, "\x00")
-	commits := make([]commitMessage, 0, len(parts)/2)
-	for index := 0; index+1 < len(parts); index += 2 {
-		subject := strings.TrimSuffix(parts[index], "\n")
-		message := strings.TrimSuffix(parts[index+1], "\n")
-		if subject == "" && message == "" {
+	commits := make([]Commit, 0, len(parts)/fields)
+	for index := 0; index+fields-1 < len(parts); index += fields {
+		commit := Commit{
+			Hash:    strings.TrimSpace(parts[index]),
+			Subject: strings.TrimSuffix(parts[index+1], "\n"),
+			Message: strings.TrimSuffix(parts[index+2], "\n"),
+		}
+		if fields == 4 {
+			commit.Signature = commitSignature(parts[index+3], trusted)
+		}
+		if commit.Hash == "" {
 			continue
 		}
-		commits = append(commits, commitMessage{Subject: subject, Message: message})
+		commits = append(commits, commit)
 	}
 	return commits, nil
 }
 
-// createTag makes one local tag at HEAD.
-func createTag(tag string) error {
-	if _, err := runGit("tag", tag); err != nil {
+// History reads the history of every target with one git log. The walk stops
+// at the merge bases of the given commits. A merge gives no files in git log,
+// so one git diff-tree reads the files of every merge against each parent.
+func (r *GitRepository) History(ctx context.Context, afterCommits []string, trustedSigners string) (History, error) {
+	dir, err := resolveDir(r.Dir)
+	if err != nil {
+		return History{}, err
+	}
+	boundary, err := r.mergeBases(ctx, afterCommits)
+	if err != nil {
+		return History{}, err
+	}
+
+	fields := 5
+	format := "--format=%x01%H%x00%P%x00%ct%x00%s%x00%B%x00"
+	var args, env []string
+	var trusted map[string]bool
+	if trustedSigners != "" {
+		if args, env, err = signerSettings(trustedSigners); err != nil {
+			return History{}, err
+		}
+		if trusted, err = r.trustedFingerprints(ctx, trustedSigners); err != nil {
+			return History{}, err
+		}
+		fields = 6
+		format += signatureFormat + "%x00"
+	}
+	// A root commit must give its files, so log.showRoot must not hide them.
+	args = append(args, "-c", "log.showRoot=true", "log", "-z", "--name-only", "--no-renames", format, "HEAD")
+	if len(boundary) > 0 {
+		args = append(append(args, "--not"), boundary...)
+	}
+	output, err := r.runWithEnv(ctx, env, args...)
+	if err != nil {
+		return History{}, fmt.Errorf("can not get git commits: %w", err)
+	}
+
+	history := History{Boundary: boundary, Dir: dir}
+	var merges []int
+	for _, record := range strings.Split(output, "\x01") {
+		parts := strings.Split(record, "\x00")
+		if len(parts) < fields || strings.TrimSpace(parts[0]) == "" {
+			continue
+		}
+		seconds, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			return History{}, fmt.Errorf("can not read the date of commit %s: %w", parts[0], err)
+		}
+		commit := HistoryCommit{
+			Commit: Commit{
+				Hash:    strings.TrimSpace(parts[0]),
+				Subject: strings.TrimSuffix(parts[3], "\n"),
+				Message: strings.TrimSuffix(parts[4], "\n"),
+			},
+			Time:    time.Unix(seconds, 0).UTC(),
+			Parents: strings.Fields(parts[1]),
+		}
+		if fields == 6 {
+			commit.Signature = commitSignature(parts[5], trusted)
+		}
+		if len(commit.Parents) > 1 {
+			merges = append(merges, len(history.Commits))
+		} else {
+			commit.Changes = [][]string{changedFiles(parts[fields:])}
+		}
+		history.Commits = append(history.Commits, commit)
+	}
+
+	if err := r.mergeChanges(ctx, history.Commits, merges); err != nil {
+		return History{}, err
+	}
+	return history, nil
+}
+
+// mergeBases gives the commits that every given commit holds in its history,
+// where the history walk can stop. Commits without a common history give
+// none, and the walk reads the full history.
+func (r *GitRepository) mergeBases(ctx context.Context, commits []string) ([]string, error) {
+	args := append([]string{"merge-base", "--octopus", "--all"}, commits...)
+	command := exec.CommandContext(ctx, "git", args...)
+	command.Dir = r.Dir
+	output, err := command.Output()
+	if err != nil {
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) && exitError.ExitCode() == 1 {
+			return nil, nil
+		}
+		return nil, gitError(ctx, args, err)
+	}
+	return strings.Fields(string(output)), nil
+}
+
+// mergeChanges reads the files of each merge against each of its parents.
+// With --always, diff-tree writes the merge hash before every diff, also an
+// empty one, so each diff keeps its place.
+func (r *GitRepository) mergeChanges(ctx context.Context, commits []HistoryCommit, merges []int) error {
+	if len(merges) == 0 {
+		return nil
+	}
+	var input strings.Builder
+	var pairs []int
+	for _, index := range merges {
+		for _, parent := range commits[index].Parents {
+			input.WriteString(commits[index].Hash + " " + parent + "\n")
+			pairs = append(pairs, index)
+		}
+	}
+	output, err := r.runWithInput(ctx,
+		input.String(),
+		"diff-tree", "--stdin", "--always", "-z", "-r", "--name-only", "--no-renames",
+	)
+	if err != nil {
+		return fmt.Errorf("can not get the files of merge commits: %w", err)
+	}
+
+	// Each header is the hash of the merge of the next pair.
+	pair := -1
+	for _, part := range strings.Split(output, "\x00") {
+		if pair+1 < len(pairs) && part == commits[pairs[pair+1]].Hash {
+			pair++
+			commits[pairs[pair]].Changes = append(commits[pairs[pair]].Changes, []string{})
+			continue
+		}
+		part = strings.TrimPrefix(part, "\n")
+		if pair < 0 || part == "" {
+			continue
+		}
+		changes := commits[pairs[pair]].Changes
+		changes[len(changes)-1] = append(changes[len(changes)-1], part)
+	}
+	if pair+1 != len(pairs) {
+		return errors.New("can not read the files of every merge commit")
+	}
+	return nil
+}
+
+// changedFiles gives the file names that git log -z writes after a commit.
+func changedFiles(parts []string) []string {
+	files := []string{}
+	for _, part := range parts {
+		part = strings.TrimPrefix(part, "\n")
+		if part != "" {
+			files = append(files, part)
+		}
+	}
+	return files
+}
+
+// TagTrust checks the signature of one tag with git verify-tag. A tag that
+// fails the check is untrusted when it has a signature and unsigned when it
+// has none.
+func (r *GitRepository) TagTrust(ctx context.Context, tag string, trustedSigners string) (TagTrust, error) {
+	objectType, err := r.value(ctx, "cat-file", "-t", "refs/tags/"+tag)
+	if err != nil {
+		return "", err
+	}
+	if objectType != "tag" {
+		return TagUnsigned, nil
+	}
+
+	args, env, err := signerSettings(trustedSigners)
+	if err != nil {
+		return "", err
+	}
+	if _, err := r.runWithEnv(ctx, env, append(args, "verify-tag", "refs/tags/"+tag)...); err == nil {
+		return TagTrusted, nil
+	}
+	signature, err := r.value(ctx, "for-each-ref", "--format=%(contents:signature)", "refs/tags/"+tag)
+	if err != nil {
+		return "", err
+	}
+	if signature == "" {
+		return TagUnsigned, nil
+	}
+	return TagUntrusted, nil
+}
+
+// tagArgs gives the git tag arguments for one tag. The whitespace cleanup
+// keeps note lines that start with "#", which the default cleanup would
+// remove as comments.
+func tagArgs(tag string, options TagOptions, extra ...string) []string {
+	args := append([]string{"tag"}, extra...)
+	if options.Sign {
+		args = append(args, "--sign")
+	} else if options.Message != "" {
+		args = append(args, "--annotate")
+	}
+	if options.Message != "" {
+		args = append(args, "--cleanup=whitespace", "--message", options.Message)
+	}
+	return append(args, tag)
+}
+
+// CreateTag makes one local tag at the given commit.
+func (r *GitRepository) CreateTag(ctx context.Context, tag string, commit string, options TagOptions) error {
+	if _, err := r.run(ctx, append(tagArgs(tag, options), commit)...); err != nil {
 		return fmt.Errorf("error tagging: %w", err)
 	}
 	return nil
 }
 
-// updateTag makes a local tag at HEAD or moves an existing local tag to HEAD.
-func updateTag(tag string) error {
-	if _, err := runGit("tag", "--force", tag); err != nil {
+// UpdateTag makes a local tag at the given commit or moves an existing local
+// tag there.
+func (r *GitRepository) UpdateTag(ctx context.Context, tag string, commit string, options TagOptions) error {
+	if _, err := r.run(ctx, append(tagArgs(tag, options, "--force"), commit)...); err != nil {
 		return fmt.Errorf("error updating tag: %w", err)
 	}
 	return nil
 }
 
-// pushTags sends the new tags to the remote. An empty branch pushes only the
+// TagObject gives the object of one local tag with git rev-parse, which
+// exits with status 1 for a tag that does not exist.
+func (r *GitRepository) TagObject(ctx context.Context, tag string) (string, error) {
+	return r.verify(ctx, "refs/tags/"+tag)
+}
+
+// RestoreTag points one local tag at an object, or removes it, with git
+// update-ref.
+func (r *GitRepository) RestoreTag(ctx context.Context, tag string, object string) error {
+	args := []string{"update-ref", "refs/tags/" + tag, object}
+	if object == "" {
+		args = []string{"update-ref", "-d", "refs/tags/" + tag}
+	}
+	if _, err := r.run(ctx, args...); err != nil {
+		return fmt.Errorf("can not restore the tag %s: %w", tag, err)
+	}
+	return nil
+}
+
+// PushTags sends the new tags to the remote. An empty branch pushes only the
 // tags, which is what a job that checked out a commit instead of a branch
 // needs. The atomic option makes the remote take all of the tags or none.
-func pushTags(
+func (r *GitRepository) PushTags(
+	ctx context.Context,
 	remote string,
 	branch string,
 	atomic bool,
@@ -168,7 +786,7 @@ func pushTags(
 		args = append(args, "+refs/tags/"+tag+":refs/tags/"+tag)
 	}
 
-	if _, err := runGit(args...); err != nil {
+	if _, err := r.run(ctx, args...); err != nil {
 		return fmt.Errorf("error pushing tags: %w", err)
 	}
 	return nil
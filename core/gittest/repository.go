@@ -0,0 +1,703 @@
+// Package gittest gives an in-memory core.Repository, so tests and other
+// tools can run semver-tags without a git binary or a work tree.
+package gittest
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/catalystcommunity/semver-tags/core"
+)
+
+// Commit is one commit of a fake history. Paths are the files that the
+// commit changes, relative to the root. Signature is the %G? state that a
+// signature check gives, and an empty value reads as "N".
+type Commit struct {
+	Message   string
+	Paths     []string
+	Signature string
+	Time      time.Time
+}
+
+// Push is one push that the fake received.
+type Push struct {
+	Remote    string
+	Branch    string
+	Atomic    bool
+	Tags      []string
+	ForceTags []string
+}
+
+type storedCommit struct {
+	Commit
+	hash string
+	// before holds the files of the work tree before CommitFiles made the
+	// commit, so ResetBranch can put them back. It is nil for other commits.
+	before map[string]string
+}
+
+type storedTag struct {
+	// object is the commit of a lightweight tag, or the tag object of an
+	// annotated tag.
+	object    string
+	commit    string
+	message   string
+	annotated bool
+	signed    bool
+	signer    string
+	trust     core.TagTrust
+}
+
+// Repository is an in-memory core.Repository with one linear history on one
+// branch. The zero value is not usable; use New. Like every Repository, its
+// methods can run concurrently, such as in a run with more than one job.
+type Repository struct {
+	// RootDir is the top directory that Root gives.
+	RootDir string
+	// Branch is the checked-out branch.
+	Branch string
+	// SigningKeyName is the key that SigningKey gives. An empty value makes
+	// signing fail like a git configuration without a key.
+	SigningKeyName string
+	// PushError makes every push fail without a change to the remote.
+	PushError error
+	// RemotePushErrors makes every push to one remote fail without a change
+	// to that remote.
+	RemotePushErrors map[string]error
+	// Pushes holds every push that reached the remote, in order.
+	Pushes []Push
+	// BeforePush runs before each push reaches the remote, so a test can
+	// change the remote like another run that pushes first.
+	BeforePush func()
+	// Depth makes the repository a shallow clone that holds only the newest
+	// Depth commits. Zero holds every commit. A fetch deepens it.
+	Depth int
+	// Fetches holds every fetch, in order.
+	Fetches []core.FetchOptions
+	// WorkTreeChanges is the paths that Changes gives.
+	WorkTreeChanges []string
+	// Files holds the content of the work tree files that ReadFile gives and
+	// CommitFiles writes, by path.
+	Files map[string]string
+
+	// mu guards the fake while one of its methods runs.
+	mu      sync.Mutex
+	commits []storedCommit
+	tags    map[string]*storedTag
+	// objects holds every annotated tag that the fake made, so RestoreTag
+	// can find one again.
+	objects map[string]*storedTag
+	remotes map[string]map[string]string
+	// remoteBranches holds the tip of each branch of each remote.
+	remoteBranches map[string]map[string]string
+}
+
+// New gives an empty repository at /repo on the main branch.
+func New() *Repository {
+	return &Repository{
+		RootDir: "/repo",
+		Branch:  "main",
+		Files:   map[string]string{},
+		tags:    map[string]*storedTag{},
+		objects: map[string]*storedTag{},
+		remotes: map[string]map[string]string{},
+
+		remoteBranches: map[string]map[string]string{},
+	}
+}
+
+var (
+	_ core.Repository    = (*Repository)(nil)
+	_ core.HistoryReader = (*Repository)(nil)
+)
+
+// Commit adds one commit that changes the given paths and gives its hash.
+func (r *Repository) Commit(message string, paths ...string) string {
+	return r.AddCommit(Commit{Message: message, Paths: paths})
+}
+
+// AddCommit adds one commit and gives its hash. A commit without a time is
+// one minute after the commit before it.
+func (r *Repository) AddCommit(commit Commit) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.addCommit(commit)
+}
+
+func (r *Repository) addCommit(commit Commit) string {
+	if commit.Time.IsZero() {
+		commit.Time = time.Date(2026, 1, 1, 0, len(r.commits), 0, 0, time.UTC)
+	}
+	sum := sha1.Sum([]byte(fmt.Sprintf("%d\x00%s", len(r.commits), commit.Message)))
+	hash := hex.EncodeToString(sum[:])
+	r.commits = append(r.commits, storedCommit{Commit: commit, hash: hash})
+	return hash
+}
+
+// Tag makes one lightweight tag.
+func (r *Repository) Tag(name string, commit string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.store(name, &storedTag{commit: commit, trust: core.TagUnsigned})
+}
+
+// SignedTag makes one signed tag that a trust check gives the given state
+// for.
+func (r *Repository) SignedTag(name string, commit string, trust core.TagTrust) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.store(name, &storedTag{commit: commit, message: name, annotated: true, signed: true, trust: trust})
+}
+
+// store sets one local tag and gives an annotated tag its own object.
+func (r *Repository) store(name string, tag *storedTag) {
+	tag.object = tag.commit
+	if tag.annotated {
+		sum := sha1.Sum([]byte(fmt.Sprintf("tag\x00%d\x00%s\x00%s", len(r.objects), name, tag.commit)))
+		tag.object = hex.EncodeToString(sum[:])
+		r.objects[tag.object] = tag
+	}
+	r.tags[name] = tag
+}
+
+// TagCommit gives the commit of one local tag.
+func (r *Repository) TagCommit(name string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tag, found := r.tags[name]
+	if !found {
+		return "", false
+	}
+	return tag.commit, true
+}
+
+// TagMessage gives the message of one local tag. A lightweight tag has none.
+func (r *Repository) TagMessage(name string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if tag, found := r.tags[name]; found {
+		return tag.message
+	}
+	return ""
+}
+
+// RemoteTags gives the tags of one remote and the commits they point at.
+func (r *Repository) RemoteTags(remote string) map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tags := map[string]string{}
+	for name, commit := range r.remotes[remote] {
+		tags[name] = commit
+	}
+	return tags
+}
+
+// RemoteTag makes one tag on a remote, like a push from another run.
+func (r *Repository) RemoteTag(remote string, name string, commit string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.remotes[remote] == nil {
+		r.remotes[remote] = map[string]string{}
+	}
+	r.remotes[remote][name] = commit
+}
+
+// RemoteBranch points one branch of a remote at a commit, like a push from
+// another clone. The commit can be one that the fake does not hold.
+func (r *Repository) RemoteBranch(remote string, name string, commit string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.remoteBranch(remote, name, commit)
+}
+
+func (r *Repository) remoteBranch(remote string, name string, commit string) {
+	if r.remoteBranches[remote] == nil {
+		r.remoteBranches[remote] = map[string]string{}
+	}
+	r.remoteBranches[remote][name] = commit
+}
+
+// RemoteBranchTip gives the commit of one branch of a remote, or "".
+func (r *Repository) RemoteBranchTip(remote string, name string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.remoteBranches[remote][name]
+}
+
+func (r *Repository) find(commit string) (int, error) {
+	for index, stored := range r.commits {
+		if stored.hash == commit {
+			return index, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown commit %s", commit)
+}
+
+// Root gives RootDir.
+func (r *Repository) Root(_ context.Context) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.RootDir, nil
+}
+
+// Head gives the newest commit.
+func (r *Repository) Head(_ context.Context) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.head()
+}
+
+func (r *Repository) head() (string, error) {
+	if len(r.commits) == 0 {
+		return "", errors.New("the repository has no commit")
+	}
+	return r.commits[len(r.commits)-1].hash, nil
+}
+
+// ShortCommit gives the first seven characters of a known commit.
+func (r *Repository) ShortCommit(_ context.Context, commit string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.find(commit); err != nil {
+		return "", err
+	}
+	return commit[:7], nil
+}
+
+// CurrentBranch gives Branch.
+func (r *Repository) CurrentBranch(_ context.Context) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.Branch, nil
+}
+
+// BranchCommit gives HEAD for the checked-out branch, which is the only
+// branch of the fake.
+func (r *Repository) BranchCommit(_ context.Context, branch string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if branch != r.Branch || len(r.commits) == 0 {
+		return "", nil
+	}
+	return r.head()
+}
+
+// Changes gives WorkTreeChanges.
+func (r *Repository) Changes(_ context.Context) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.WorkTreeChanges), nil
+}
+
+// ReadFile gives the content of one file of Files.
+func (r *Repository) ReadFile(_ context.Context, path string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	content, found := r.Files[path]
+	if !found {
+		return nil, fmt.Errorf("can not read %s: %w", path, fs.ErrNotExist)
+	}
+	return []byte(content), nil
+}
+
+// CommitFiles writes the files and adds one commit that changes them. The
+// fake has one branch, so HEAD is always its tip.
+func (r *Repository) CommitFiles(_ context.Context, branch string, message string, files map[string][]byte) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if branch != r.Branch {
+		return "", fmt.Errorf("can not move the branch %s: the fake has only %s", branch, r.Branch)
+	}
+	before := maps.Clone(r.Files)
+	paths := make([]string, 0, len(files))
+	for path, content := range files {
+		r.Files[path] = string(content)
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	hash := r.addCommit(Commit{Message: message, Paths: paths})
+	r.commits[len(r.commits)-1].before = before
+	return hash, nil
+}
+
+// ResetBranch drops the commits after the given one and puts back the files
+// that CommitFiles wrote since then.
+func (r *Repository) ResetBranch(_ context.Context, branch string, commit string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	index, err := r.find(commit)
+	if err != nil {
+		return err
+	}
+	for _, dropped := range r.commits[index+1:] {
+		if dropped.before != nil {
+			r.Files = dropped.before
+			break
+		}
+	}
+	r.commits = r.commits[:index+1]
+	return nil
+}
+
+// CommitTime gives the time of one commit in UTC.
+func (r *Repository) CommitTime(_ context.Context, commit string) (time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	index, err := r.find(commit)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return r.commits[index].Time.UTC(), nil
+}
+
+// FirstCommit gives the oldest commit, which is the shallow boundary of a
+// shallow clone.
+func (r *Repository) FirstCommit(_ context.Context) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.commits) == 0 {
+		return "", errors.New("the repository has no commit, so there is no root to determine")
+	}
+	return r.commits[r.boundary()].hash, nil
+}
+
+// boundary gives the index of the oldest commit that HEAD holds.
+func (r *Repository) boundary() int {
+	if r.Depth <= 0 || r.Depth >= len(r.commits) {
+		return 0
+	}
+	return len(r.commits) - r.Depth
+}
+
+// Shallow tells if Depth leaves out commits.
+func (r *Repository) Shallow(_ context.Context) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.boundary() > 0, nil
+}
+
+// Contains tells if a commit is in the history that a shallow clone holds.
+func (r *Repository) Contains(_ context.Context, commit string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	index, err := r.find(commit)
+	if err != nil {
+		return false, nil
+	}
+	return index >= r.boundary(), nil
+}
+
+// Fetch deepens a shallow clone. A tag fetch copies the tags of the remote
+// that are new, or every tag with Force.
+func (r *Repository) Fetch(_ context.Context, remote string, options core.FetchOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Fetches = append(r.Fetches, options)
+	if options.Tags {
+		for name, commit := range r.remotes[remote] {
+			if _, found := r.tags[name]; !found || options.Force {
+				r.store(name, &storedTag{commit: commit, trust: core.TagUnsigned})
+			}
+		}
+	}
+	switch {
+	case options.Unshallow:
+		r.Depth = 0
+	case options.Deepen > 0 && r.Depth > 0:
+		r.Depth += options.Deepen
+	}
+	return nil
+}
+
+// RemoteTagCommits gives the commits of the given tags that the remote
+// holds.
+func (r *Repository) RemoteTagCommits(_ context.Context, remote string, tags []string) (map[string]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	commits := map[string]string{}
+	for _, name := range tags {
+		if commit, found := r.remotes[remote][name]; found {
+			commits[name] = commit
+		}
+	}
+	return commits, nil
+}
+
+// RemoteBranchCommit gives the tip of one branch of a remote, or "".
+func (r *Repository) RemoteBranchCommit(_ context.Context, remote string, branch string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.remoteBranches[remote][branch], nil
+}
+
+// CommitCount gives the number of commits after the given commit.
+func (r *Repository) CommitCount(_ context.Context, afterCommit string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	index, err := r.find(afterCommit)
+	if err != nil {
+		return 0, err
+	}
+	return len(r.commits) - index - 1, nil
+}
+
+// Tags gives the tags in name order, like git for-each-ref.
+func (r *Repository) Tags(_ context.Context) ([]core.TagRef, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tags := make([]core.TagRef, 0, len(r.tags))
+	for name, tag := range r.tags {
+		tags = append(tags, core.TagRef{Name: name, Commit: tag.commit})
+	}
+	slices.SortFunc(tags, func(a, b core.TagRef) int { return strings.Compare(a.Name, b.Name) })
+	return tags, nil
+}
+
+// Commits reads the pathspecs that the runs give git with the rules of
+// core.PathspecMatcher, so a wildcard pathspec must match the whole path. A
+// plain path is relative to the root.
+func (r *Repository) Commits(_ context.Context, afterCommit string, paths []string, trustedSigners string) ([]core.Commit, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	after, err := r.find(afterCommit)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := core.PathspecMatcher(paths, r.RootDir, r.RootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []core.Commit
+	for index := len(r.commits) - 1; index > after; index-- {
+		stored := r.commits[index]
+		if !slices.ContainsFunc(stored.Paths, matches) {
+			continue
+		}
+		commits = append(commits, stored.commit(trustedSigners))
+	}
+	return commits, nil
+}
+
+// History gives the commits after the oldest of the given commits, with the
+// paths that each commit changes.
+func (r *Repository) History(_ context.Context, afterCommits []string, trustedSigners string) (core.History, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	oldest := len(r.commits) - 1
+	for _, afterCommit := range afterCommits {
+		index, err := r.find(afterCommit)
+		if err != nil {
+			return core.History{}, err
+		}
+		oldest = min(oldest, index)
+	}
+
+	history := core.History{Dir: r.RootDir}
+	if oldest < 0 {
+		return history, nil
+	}
+	history.Boundary = []string{r.commits[oldest].hash}
+	for index := len(r.commits) - 1; index > oldest; index-- {
+		stored := r.commits[index]
+		history.Commits = append(history.Commits, core.HistoryCommit{
+			Commit:  stored.commit(trustedSigners),
+			Time:    stored.Time.UTC(),
+			Parents: []string{r.commits[index-1].hash},
+			Changes: [][]string{slices.Clone(stored.Paths)},
+		})
+	}
+	return history, nil
+}
+
+// commit gives the core form of one commit. With trusted signers, an empty
+// signature reads as "N".
+func (c storedCommit) commit(trustedSigners string) core.Commit {
+	commit := core.Commit{
+		Hash:    c.hash,
+		Subject: strings.SplitN(c.Message, "\n", 2)[0],
+		Message: c.Message,
+	}
+	if trustedSigners != "" {
+		commit.Signature = c.Signature
+		if commit.Signature == "" {
+			commit.Signature = "N"
+		}
+	}
+	return commit
+}
+
+// TagTrust gives the trust state that the tag was made with. A signed tag
+// that the fake made is trusted.
+func (r *Repository) TagTrust(_ context.Context, tag string, trustedSigners string) (core.TagTrust, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, found := r.tags[tag]
+	if !found {
+		return "", fmt.Errorf("unknown tag %s", tag)
+	}
+	return stored.trust, nil
+}
+
+// SigningKey gives SigningKeyName.
+func (r *Repository) SigningKey(_ context.Context) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.SigningKeyName == "" {
+		return "", errors.New("can not sign tags: no signing key")
+	}
+	return r.SigningKeyName, nil
+}
+
+// CreateTag makes one new local tag. A tag with a message or a signature is
+// annotated.
+func (r *Repository) CreateTag(_ context.Context, tag string, commit string, options core.TagOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, found := r.tags[tag]; found {
+		return fmt.Errorf("error tagging: tag %s already exists", tag)
+	}
+	return r.updateTag(tag, commit, options)
+}
+
+// UpdateTag makes or moves one local tag.
+func (r *Repository) UpdateTag(_ context.Context, tag string, commit string, options core.TagOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.updateTag(tag, commit, options)
+}
+
+func (r *Repository) updateTag(tag string, commit string, options core.TagOptions) error {
+	if _, err := r.find(commit); err != nil {
+		return err
+	}
+	if options.Sign && r.SigningKeyName == "" {
+		return errors.New("can not sign tags: no signing key")
+	}
+	stored := &storedTag{
+		commit:    commit,
+		message:   options.Message,
+		annotated: options.Message != "" || options.Sign,
+		signed:    options.Sign,
+		trust:     core.TagUnsigned,
+	}
+	if options.Sign {
+		stored.signer = r.SigningKeyName
+		stored.trust = core.TagTrusted
+	}
+	r.store(tag, stored)
+	return nil
+}
+
+// TagSigner gives the SigningKeyName that signed the tag, or "".
+func (r *Repository) TagSigner(_ context.Context, tag string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stored, found := r.tags[tag]; found {
+		return stored.signer, nil
+	}
+	return "", fmt.Errorf("tag %s does not exist", tag)
+}
+
+// TagObject gives the object of one local tag, or "" when it does not
+// exist.
+func (r *Repository) TagObject(_ context.Context, tag string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stored, found := r.tags[tag]; found {
+		return stored.object, nil
+	}
+	return "", nil
+}
+
+// RestoreTag points a tag at an object that TagObject gave, or deletes it
+// for "".
+func (r *Repository) RestoreTag(_ context.Context, tag string, object string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if object == "" {
+		delete(r.tags, tag)
+		return nil
+	}
+	if stored, found := r.objects[object]; found {
+		r.tags[tag] = stored
+		return nil
+	}
+	if _, err := r.find(object); err != nil {
+		return fmt.Errorf("can not restore the tag %s: %w", tag, err)
+	}
+	r.store(tag, &storedTag{commit: object, trust: core.TagUnsigned})
+	return nil
+}
+
+// PushTags rejects a tag that the remote holds at another commit, like a git
+// remote. Without atomic, the other tags still reach the remote.
+func (r *Repository) PushTags(_ context.Context, remote string, branch string, atomic bool, tags []string, forceTags []string) error {
+	if r.BeforePush != nil {
+		r.BeforePush()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.PushError != nil {
+		return fmt.Errorf("error pushing tags: %w", r.PushError)
+	}
+	if err := r.RemotePushErrors[remote]; err != nil {
+		return fmt.Errorf("error pushing tags: %w", err)
+	}
+	remoteTags := r.remotes[remote]
+	if remoteTags == nil {
+		remoteTags = map[string]string{}
+		r.remotes[remote] = remoteTags
+	}
+
+	var rejected []string
+	accepted := map[string]string{}
+	for _, name := range tags {
+		local, found := r.tags[name]
+		if !found {
+			return fmt.Errorf("error pushing tags: unknown tag %s", name)
+		}
+		if existing, found := remoteTags[name]; found && existing != local.commit {
+			rejected = append(rejected, name)
+			continue
+		}
+		accepted[name] = local.commit
+	}
+	for _, name := range forceTags {
+		local, found := r.tags[name]
+		if !found {
+			return fmt.Errorf("error pushing tags: unknown tag %s", name)
+		}
+		accepted[name] = local.commit
+	}
+	if len(rejected) > 0 && atomic {
+		return fmt.Errorf("error pushing tags: the remote rejected %s", strings.Join(rejected, ", "))
+	}
+
+	for name, commit := range accepted {
+		remoteTags[name] = commit
+	}
+	if branch != "" && len(r.commits) > 0 {
+		r.remoteBranch(remote, branch, r.commits[len(r.commits)-1].hash)
+	}
+	r.Pushes = append(r.Pushes, Push{
+		Remote:    remote,
+		Branch:    branch,
+		Atomic:    atomic,
+		Tags:      slices.Clone(tags),
+		ForceTags: slices.Clone(forceTags),
+	})
+	if len(rejected) > 0 {
+		return fmt.Errorf("error pushing tags: the remote rejected %s", strings.Join(rejected, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package core
+
+import (
+	"container/heap"
+	"context"
+	"slices"
+)
+
+// historyIndex finds the commits of one History by hash.
+type historyIndex struct {
+	History
+	positions map[string]int
+}
+
+func newHistoryIndex(history History) *historyIndex {
+	index := &historyIndex{History: history, positions: make(map[string]int, len(history.Commits))}
+	for position, commit := range history.Commits {
+		index.positions[commit.Hash] = position
+	}
+	return index
+}
+
+// loadHistory reads the history of every group in one pass when the
+// repository can do that and the run has more than one group.
+func (t *tagger) loadHistory(ctx context.Context, groups []DirectoryVersionInfo) error {
+	reader, ok := t.repo.(HistoryReader)
+	if !ok || len(groups) < 2 {
+		return nil
+	}
+
+	var afterCommits []string
+	for _, group := range groups {
+		afterCommits = appendNewPath(afterCommits, group.LastVersion.CommitHash)
+	}
+	history, err := reader.History(ctx, afterCommits, t.commitSigners())
+	if err != nil {
+		return err
+	}
+	t.history = newHistoryIndex(history)
+	return nil
+}
+
+// commits gives the commits of HEAD after the given commit that changed one
+// of the paths, newest first, like Repository.Commits. It reads them from the
+// loaded history when that history holds the commit. The release commits of
+// this tool are left out.
+func (t *tagger) commits(ctx context.Context, afterCommit string, paths []string) ([]Commit, error) {
+	var commits []Commit
+	found := false
+	if t.history != nil {
+		filter, err := newPathFilter(paths, t.root, t.history.Dir)
+		if err != nil {
+			return nil, err
+		}
+		commits, found = t.history.commits(t.head, afterCommit, filter)
+	}
+	if !found {
+		var err error
+		if commits, err = t.repo.Commits(ctx, afterCommit, paths, t.commitSigners()); err != nil {
+			return nil, err
+		}
+	}
+	return slices.DeleteFunc(commits, isReleaseCommit), nil
+}
+
+// excluded gives the commits of the history that the given commit holds. It
+// is false when the history can not tell, because the commit is not in the
+// history of HEAD.
+func (h *historyIndex) excluded(afterCommit string) (map[string]bool, bool) {
+	excluded := map[string]bool{}
+	if _, found := h.positions[afterCommit]; !found {
+		// A boundary commit holds none of the commits of the history.
+		return excluded, slices.Contains(h.Boundary, afterCommit)
+	}
+	pending := []string{afterCommit}
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		position, found := h.positions[hash]
+		if !found || excluded[hash] {
+			continue
+		}
+		excluded[hash] = true
+		pending = append(pending, h.Commits[position].Parents...)
+	}
+	return excluded, true
+}
+
+// changes tells if the filter holds a file that one commit changed against
+// the parent at the given place.
+func (h *historyIndex) changes(commit *HistoryCommit, parent int, filter *pathFilter) bool {
+	for _, name := range commit.Changes[parent] {
+		if filter.matches(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// commits walks the history from HEAD like git log does with pathspecs. A
+// commit that matches one of its parents for the paths is hidden, and the
+// walk follows only that parent. It is false when the history can not give
+// the commits after the given commit.
+func (h *historyIndex) commits(head string, afterCommit string, filter *pathFilter) ([]Commit, bool) {
+	seen, ok := h.excluded(afterCommit)
+	if !ok {
+		return nil, false
+	}
+
+	commits := []Commit{}
+	queue := &historyQueue{}
+	push := func(hash string) {
+		position, found := h.positions[hash]
+		if found && !seen[hash] {
+			seen[hash] = true
+			heap.Push(queue, &h.Commits[position])
+		}
+	}
+	push(head)
+	for queue.Len() > 0 {
+		commit := heap.Pop(queue).(*HistoryCommit)
+		if len(commit.Parents) == 0 {
+			if h.changes(commit, 0, filter) {
+				commits = append(commits, commit.Commit)
+			}
+			continue
+		}
+
+		follow := commit.Parents
+		treeSame := false
+		for index, parent := range commit.Parents {
+			if !h.changes(commit, index, filter) {
+				follow = []string{parent}
+				treeSame = true
+				break
+			}
+		}
+		if !treeSame {
+			commits = append(commits, commit.Commit)
+		}
+		for _, parent := range follow {
+			push(parent)
+		}
+	}
+	return commits, true
+}
+
+// historyQueue orders a walk of a History like git rev-list: the newest
+// committer date first, then the order the commits were found in.
+type historyQueue struct {
+	commits []*HistoryCommit
+	order   []int
+	next    int
+}
+
+func (q *historyQueue) Len() int { return len(q.commits) }
+
+func (q *historyQueue) Less(i, j int) bool {
+	left, right := q.commits[i].Time, q.commits[j].Time
+	if !left.Equal(right) {
+		return left.After(right)
+	}
+	return q.order[i] < q.order[j]
+}
+
+func (q *historyQueue) Swap(i, j int) {
+	q.commits[i], q.commits[j] = q.commits[j], q.commits[i]
+	q.order[i], q.order[j] = q.order[j], q.order[i]
+}
+
+func (q *historyQueue) Push(value any) {
+	q.commits = append(q.commits, value.(*HistoryCommit))
+	q.order = append(q.order, q.next)
+	q.next++
+}
+
+func (q *historyQueue) Pop() any {
+	last := len(q.commits) - 1
+	commit := q.commits[last]
+	q.commits = q.commits[:last]
+	q.order = q.order[:last]
+	return commit
+}
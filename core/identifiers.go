@@ -0,0 +1,149 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/catalystcommunity/semver-tags/core/semver"
+)
+
+// IdentifierData holds the values that a pre-release or build template can
+// read. CommitCount counts the commits of one target since its last release.
+// Date is the committer date of HEAD in UTC, so a rerun on the same commit
+// renders the same identifier.
+type IdentifierData struct {
+	Package     string
+	SHA         string
+	ShortSHA    string
+	CommitCount int
+	Branch      string
+	Date        string
+}
+
+// Env gives the value of one environment variable. An unset variable gives an
+// empty value.
+func (d IdentifierData) Env(name string) string {
+	return os.Getenv(name)
+}
+
+var invalidIdentifierCharacters = regexp.MustCompile(`[^0-9A-Za-z-]+`)
+
+// identifierFunctions lets a template make a safe identifier from a value such
+// as a branch name, which often holds a slash.
+var identifierFunctions = template.FuncMap{
+	"identifier": func(value string) string {
+		return strings.Trim(invalidIdentifierCharacters.ReplaceAllString(value, "-"), "-")
+	},
+}
+
+// identifierTemplates renders the pre-release and build strings of a run. A
+// string without template actions renders as itself.
+type identifierTemplates struct {
+	preRelease *template.Template
+	build      *template.Template
+	usesData   bool
+}
+
+func newIdentifierTemplates(config Config) (identifierTemplates, error) {
+	preRelease, err := template.New("pre_release_string").
+		Funcs(identifierFunctions).
+		Option("missingkey=error").
+		Parse(config.PreReleaseString)
+	if err != nil {
+		return identifierTemplates{}, fmt.Errorf("can not read the pre-release template: %w", err)
+	}
+	build, err := template.New("build_string").
+		Funcs(identifierFunctions).
+		Option("missingkey=error").
+		Parse(config.BuildString)
+	if err != nil {
+		return identifierTemplates{}, fmt.Errorf("can not read the build template: %w", err)
+	}
+	return identifierTemplates{
+		preRelease: preRelease,
+		build:      build,
+		usesData: strings.Contains(config.PreReleaseString, "{{") ||
+			strings.Contains(config.BuildString, "{{"),
+	}, nil
+}
+
+// render gives the pre-release and build strings for one target. It checks
+// both against the semantic version rules before a version can use them. The
+// flag tells if the trailing number of the pre-release is the commit count,
+// as in "pr.482.{{.CommitCount}}", and not a fixed value of the template.
+func (i identifierTemplates) render(data IdentifierData) (string, string, bool, error) {
+	renderedPreRelease, err := i.renderPreRelease(data)
+	if err != nil {
+		return "", "", false, err
+	}
+	var build strings.Builder
+	if err := i.build.Execute(&build, data); err != nil {
+		return "", "", false, fmt.Errorf("can not render the build template: %w", err)
+	}
+
+	renderedBuild := strings.TrimSpace(build.String())
+	if err := semver.ValidatePreRelease(renderedPreRelease); err != nil {
+		return "", "", false, fmt.Errorf("the pre-release template made an invalid identifier: %w", err)
+	}
+	if err := semver.ValidateBuild(renderedBuild); err != nil {
+		return "", "", false, fmt.Errorf("the build template made an invalid identifier: %w", err)
+	}
+
+	// The trailing number is a counter when it follows the commit count.
+	counted := false
+	if i.usesData {
+		next := data
+		next.CommitCount++
+		nextPreRelease, err := i.renderPreRelease(next)
+		if err != nil {
+			return "", "", false, err
+		}
+		counted = renderedPreRelease == trailingCount(renderedPreRelease, data.CommitCount) &&
+			nextPreRelease == trailingCount(renderedPreRelease, next.CommitCount)
+	}
+	return renderedPreRelease, renderedBuild, counted, nil
+}
+
+func (i identifierTemplates) renderPreRelease(data IdentifierData) (string, error) {
+	var preRelease strings.Builder
+	if err := i.preRelease.Execute(&preRelease, data); err != nil {
+		return "", fmt.Errorf("can not render the pre-release template: %w", err)
+	}
+	return strings.TrimSpace(preRelease.String()), nil
+}
+
+// trailingCount replaces the last identifier of a pre-release with a count.
+// A pre-release of one identifier has no series to keep, so it gives "".
+func trailingCount(preRelease string, count int) string {
+	idx := strings.LastIndex(preRelease, ".")
+	if idx < 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s.%d", preRelease[:idx], count)
+}
+
+// headIdentifierData reads the git values that every target of a run shares.
+func headIdentifierData(ctx context.Context, repo Repository, head string) (IdentifierData, error) {
+	shortSHA, err := repo.ShortCommit(ctx, head)
+	if err != nil {
+		return IdentifierData{}, err
+	}
+	branch, err := repo.CurrentBranch(ctx)
+	if err != nil {
+		return IdentifierData{}, err
+	}
+	date, err := repo.CommitTime(ctx, head)
+	if err != nil {
+		return IdentifierData{}, err
+	}
+	return IdentifierData{
+		SHA:      head,
+		ShortSHA: shortSHA,
+		Branch:   branch,
+		Date:     date.Format("20060102"),
+	}, nil
+}
@@ -0,0 +1,146 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/catalystcommunity/app-utils-go/logging"
+	"github.com/catalystcommunity/semver-tags/core/semver"
+)
+
+// TagMigration is one tag that MigrateTags makes under the current name of a
+// target. It points at the commit of the latest version tag of a previous
+// name.
+type TagMigration struct {
+	Package  string
+	Tag      string
+	FromTag  string
+	Commit   string
+	Migrated bool
+
+	version *semver.Semver
+}
+
+// MigrateTags makes a tag under the current name of each target for the
+// latest version of each previous name. A previous name is a
+// previous_names value or the directory name of a legacy target. After the
+// migration, a target no longer needs its previous names. It skips a
+// previous name when the current name already has the same or a higher
+// version. It pushes the new tags in one push, so with atomic pushes the
+// remote takes all of them or none. Then it pushes them to each mirror. A dry
+// run makes no tag.
+func MigrateTags(ctx context.Context, config Config) ([]TagMigration, error) {
+	if err := validateRemotes(config); err != nil {
+		return nil, err
+	}
+	annotation, err := newAnnotationTemplate(config)
+	if err != nil {
+		return nil, err
+	}
+	results, run, err := prepareRun(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := run.loadTags(ctx); err != nil {
+		return nil, err
+	}
+
+	var migrations []TagMigration
+	for _, result := range results {
+		format, err := newTagFormat(result.TagFormat)
+		if err != nil {
+			return nil, err
+		}
+		packageName := result.PackageName()
+		current, err := run.highestVersion(ctx, format, []string{packageName}, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, alias := range result.TagAliases {
+			previous, err := run.highestVersion(ctx, format, []string{alias}, nil)
+			if err != nil {
+				return nil, err
+			}
+			if previous == nil {
+				continue
+			}
+			if current != nil && current.Version.Compare(previous.Version) >= 0 {
+				logging.Log.Info(fmt.Sprintf(
+					"Package %s already has a version at or above the previous name %s", packageName, alias,
+				))
+				continue
+			}
+
+			fromTag, err := tagFor(previous)
+			if err != nil {
+				return nil, err
+			}
+			tag, err := tagFor(&VersionInfo{Package: packageName, Version: previous.Version, format: format})
+			if err != nil {
+				return nil, err
+			}
+			if slices.ContainsFunc(migrations, func(migration TagMigration) bool { return migration.Tag == tag }) {
+				continue
+			}
+			migrations = append(migrations, TagMigration{
+				Package: packageName,
+				Tag:     tag,
+				FromTag: fromTag,
+				Commit:  previous.CommitHash,
+				version: previous.Version,
+			})
+		}
+	}
+
+	if config.DryRun || len(migrations) == 0 {
+		for _, migration := range migrations {
+			logging.Log.Info(fmt.Sprintf("We would be tagging %s from %s", migration.Tag, migration.FromTag))
+		}
+		return migrations, nil
+	}
+
+	if config.Sign {
+		if _, err := run.repo.SigningKey(ctx); err != nil {
+			return nil, err
+		}
+	}
+	// A failed migration restores the local tags, like a failed release.
+	journal := newTagJournal(run.repo)
+	tags := make([]string, 0, len(migrations))
+	for _, migration := range migrations {
+		logging.Log.Info(fmt.Sprintf("Tagging %s from %s", migration.Tag, migration.FromTag))
+		// The release note of a copied tag names the tag that it copies.
+		message, err := annotation.render(AnnotationData{
+			Package:      migration.Package,
+			Version:      strings.TrimPrefix(migration.version.FormattedString(), "v"),
+			Tag:          migration.Tag,
+			PreviousTag:  migration.FromTag,
+			ReleaseNotes: []string{"Copied from " + migration.FromTag},
+		})
+		if err != nil {
+			return nil, journal.fail(ctx, err)
+		}
+		options := TagOptions{Message: message, Sign: config.Sign}
+		if err := journal.record(ctx, migration.Tag); err != nil {
+			return nil, journal.fail(ctx, err)
+		}
+		if err := run.repo.CreateTag(ctx, migration.Tag, migration.Commit, options); err != nil {
+			return nil, journal.fail(ctx, err)
+		}
+		tags = append(tags, migration.Tag)
+	}
+	// Only the tags move. The branch already holds every migrated commit.
+	config.Branch = ""
+	if err := config.pushRemotes()[0].push(ctx, run.repo, config, tags, nil); err != nil {
+		return nil, journal.fail(ctx, err)
+	}
+	if err := mirrorError(config, pushMirrors(ctx, run.repo, config, tags, nil)); err != nil {
+		return nil, err
+	}
+	for index := range migrations {
+		migrations[index].Migrated = true
+	}
+	return migrations, nil
+}
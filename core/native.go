@@ -0,0 +1,987 @@
+package core
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/plumbing/transport/server"
+)
+
+const (
+	// GitBackendExec runs the git command. It is the default backend.
+	GitBackendExec = "exec"
+	// GitBackendNative reads and writes the repository in process, so it runs
+	// where git is not installed.
+	GitBackendNative = "native"
+)
+
+// errNativeSignatures is the error of every signature operation of the native
+// backend, which has no access to the GPG or SSH signing programs.
+var errNativeSignatures = errors.New("the native git backend can not make or check signatures; use --git-backend=exec")
+
+// errNativeFetch is the error of a fetch that deepens the history in the
+// native backend, which can not deepen a shallow clone.
+var errNativeFetch = errors.New("the native git backend can not deepen a shallow clone; use --git-backend=exec or fetch the full history first")
+
+// installFileTransport makes go-git serve file remotes in process. Its
+// default file transport starts git-receive-pack, which needs git.
+var installFileTransport sync.Once
+
+// NativeRepository is the Repository that reads and writes git objects in
+// process with go-git. It gives the same results as GitRepository, but it can
+// not make or check signatures.
+type NativeRepository struct {
+	// Dir is a directory in the work tree. An empty value uses the current
+	// directory.
+	Dir string
+
+	// mu runs one operation at a time, because go-git does not promise that
+	// one repository is safe for concurrent use.
+	mu   sync.Mutex
+	repo *git.Repository
+	root string
+	// abbreviations holds every object hash, which ShortCommit needs to keep
+	// an abbreviation unique.
+	abbreviations []string
+}
+
+// NewNativeRepository gives the in-process repository that holds dir. An empty
+// dir uses the current directory.
+func NewNativeRepository(dir string) *NativeRepository {
+	return &NativeRepository{Dir: dir}
+}
+
+// baseDir gives the directory that relative pathspecs start from, with its
+// symbolic links resolved like the paths that git reports.
+func (r *NativeRepository) baseDir() (string, error) {
+	return resolveDir(r.Dir)
+}
+
+func (r *NativeRepository) open() (*git.Repository, error) {
+	if r.repo != nil {
+		return r.repo, nil
+	}
+	dir, err := r.baseDir()
+	if err != nil {
+		return nil, fmt.Errorf("current directory is not a git repo, nothing to do: %w", err)
+	}
+	repo, err := git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{DetectDotGit: true, EnableDotGitCommonDir: true})
+	if err != nil {
+		return nil, fmt.Errorf("current directory is not a git repo, nothing to do: %w", err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("current directory is not a git repo, nothing to do: %w", err)
+	}
+	root, err := filepath.EvalSymlinks(worktree.Filesystem.Root())
+	if err != nil {
+		return nil, err
+	}
+	r.repo = repo
+	r.root = root
+	return repo, nil
+}
+
+// commit reads one commit from a hash or a revision such as HEAD.
+func (r *NativeRepository) commit(revision string) (*object.Commit, error) {
+	repo, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return nil, fmt.Errorf("can not resolve %s: %w", revision, err)
+	}
+	return repo.CommitObject(*hash)
+}
+
+// Root gives the top directory of the work tree.
+func (r *NativeRepository) Root(ctx context.Context) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.open(); err != nil {
+		return "", err
+	}
+	return r.root, nil
+}
+
+// Head gives the commit that a new tag points at.
+func (r *NativeRepository) Head(ctx context.Context) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	commit, err := r.commit("HEAD")
+	if err != nil {
+		return "", err
+	}
+	return commit.Hash.String(), nil
+}
+
+// ShortCommit gives the abbreviation that git gives: at least seven
+// characters, more in a large repository, and long enough to be unique.
+func (r *NativeRepository) ShortCommit(ctx context.Context, commit string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	resolved, err := r.commit(commit)
+	if err != nil {
+		return "", err
+	}
+	if r.abbreviations == nil {
+		objects, err := r.repo.Storer.IterEncodedObjects(plumbing.AnyObject)
+		if err != nil {
+			return "", err
+		}
+		err = objects.ForEach(func(object plumbing.EncodedObject) error {
+			r.abbreviations = append(r.abbreviations, object.Hash().String())
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	hash := resolved.Hash.String()
+	length := (bits.Len(uint(len(r.abbreviations))) + 1) / 2
+	if length < 7 {
+		length = 7
+	}
+	for ; length < len(hash); length++ {
+		unique := true
+		for _, other := range r.abbreviations {
+			if other != hash && strings.HasPrefix(other, hash[:length]) {
+				unique = false
+				break
+			}
+		}
+		if unique {
+			break
+		}
+	}
+	return hash[:length], nil
+}
+
+// CurrentBranch gives the name of the checked-out branch. A detached HEAD
+// gives "HEAD".
+func (r *NativeRepository) CurrentBranch(ctx context.Context) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo, err := r.open()
+	if err != nil {
+		return "", err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", err
+	}
+	if head.Name().IsBranch() {
+		return head.Name().Short(), nil
+	}
+	return "HEAD", nil
+}
+
+// BranchCommit gives the commit at the tip of one local branch.
+func (r *NativeRepository) BranchCommit(ctx context.Context, branch string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo, err := r.open()
+	if err != nil {
+		return "", err
+	}
+	ref, err := repo.Storer.Reference(plumbing.NewBranchReferenceName(branch))
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("can not read the branch %s: %w", branch, err)
+	}
+	return ref.Hash().String(), nil
+}
+
+// Changes gives the changed and untracked paths of the work tree status.
+func (r *NativeRepository) Changes(ctx context.Context) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("can not read the state of the work tree: %w", err)
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		return nil, fmt.Errorf("can not read the state of the work tree: %w", err)
+	}
+	var paths []string
+	for path, file := range status {
+		if file.Staging != git.Unmodified || file.Worktree != git.Unmodified {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// ReadFile reads one file of the work tree.
+func (r *NativeRepository) ReadFile(ctx context.Context, path string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.open(); err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(filepath.Join(r.root, filepath.FromSlash(path)))
+	if err != nil {
+		return nil, fmt.Errorf("can not read %s: %w", path, err)
+	}
+	return content, nil
+}
+
+// CommitFiles writes and commits the files, then points the branch at the
+// new commit. The author comes from the git configuration.
+func (r *NativeRepository) CommitFiles(ctx context.Context, branch string, message string, files map[string][]byte) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo, err := r.open()
+	if err != nil {
+		return "", err
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return "", fmt.Errorf("can not make the release commit: %w", err)
+	}
+	paths, err := writeWorkTreeFiles(r.root, files)
+	if err != nil {
+		return "", err
+	}
+	for _, path := range paths {
+		if _, err := worktree.Add(path); err != nil {
+			return "", fmt.Errorf("can not add the release file %s: %w", path, err)
+		}
+	}
+	hash, err := worktree.Commit(message, &git.CommitOptions{})
+	if err != nil {
+		return "", fmt.Errorf("can not make the release commit: %w", err)
+	}
+	reference := plumbing.NewHashReference(plumbing.NewBranchReferenceName(branch), hash)
+	if err := repo.Storer.SetReference(reference); err != nil {
+		return "", fmt.Errorf("can not move the branch %s: %w", branch, err)
+	}
+	return hash.String(), nil
+}
+
+// ResetBranch moves HEAD and the branch back with a hard reset. A release
+// commit needs a clean work tree, so the reset loses no change.
+func (r *NativeRepository) ResetBranch(ctx context.Context, branch string, commit string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo, err := r.open()
+	if err != nil {
+		return err
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("can not reset HEAD to %s: %w", commit, err)
+	}
+	hash := plumbing.NewHash(commit)
+	if err := worktree.Reset(&git.ResetOptions{Commit: hash, Mode: git.HardReset}); err != nil {
+		return fmt.Errorf("can not reset HEAD to %s: %w", commit, err)
+	}
+	reference := plumbing.NewHashReference(plumbing.NewBranchReferenceName(branch), hash)
+	if err := repo.Storer.SetReference(reference); err != nil {
+		return fmt.Errorf("can not move the branch %s: %w", branch, err)
+	}
+	return nil
+}
+
+// CommitTime gives the committer date of one commit.
+func (r *NativeRepository) CommitTime(ctx context.Context, commit string) (time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	resolved, err := r.commit(commit)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(resolved.Committer.When.Unix(), 0).UTC(), nil
+}
+
+// commitQueue orders a history walk like git rev-list: the newest committer
+// date first, then the order the commits were found in.
+type commitQueue struct {
+	commits []*object.Commit
+	order   []int
+	next    int
+}
+
+func (q *commitQueue) Len() int { return len(q.commits) }
+
+func (q *commitQueue) Less(i, j int) bool {
+	left, right := q.commits[i].Committer.When, q.commits[j].Committer.When
+	if !left.Equal(right) {
+		return left.After(right)
+	}
+	return q.order[i] < q.order[j]
+}
+
+func (q *commitQueue) Swap(i, j int) {
+	q.commits[i], q.commits[j] = q.commits[j], q.commits[i]
+	q.order[i], q.order[j] = q.order[j], q.order[i]
+}
+
+func (q *commitQueue) Push(value any) {
+	q.commits = append(q.commits, value.(*object.Commit))
+	q.order = append(q.order, q.next)
+	q.next++
+}
+
+func (q *commitQueue) Pop() any {
+	last := len(q.commits) - 1
+	commit := q.commits[last]
+	q.commits = q.commits[:last]
+	q.order = q.order[:last]
+	return commit
+}
+
+// walk visits the commits of HEAD that are not in the history of the
+// excluded commit. The visit gives the parents to follow; a nil value follows
+// every parent.
+func (r *NativeRepository) walk(ctx context.Context, exclude string, visit func(*object.Commit) ([]*object.Commit, error)) error {
+	head, err := r.commit("HEAD")
+	if err != nil {
+		return err
+	}
+
+	seen := map[plumbing.Hash]bool{}
+	if exclude != "" {
+		excluded, err := r.commit(exclude)
+		if err != nil {
+			return err
+		}
+		err = object.NewCommitPreorderIter(excluded, nil, nil).ForEach(func(commit *object.Commit) error {
+			seen[commit.Hash] = true
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	queue := &commitQueue{}
+	if !seen[head.Hash] {
+		seen[head.Hash] = true
+		heap.Push(queue, head)
+	}
+	for queue.Len() > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		commit := heap.Pop(queue).(*object.Commit)
+		follow, err := visit(commit)
+		if err != nil {
+			return err
+		}
+		if follow == nil {
+			if follow, err = parents(commit); err != nil {
+				return err
+			}
+		}
+		for _, parent := range follow {
+			if !seen[parent.Hash] {
+				seen[parent.Hash] = true
+				heap.Push(queue, parent)
+			}
+		}
+	}
+	return nil
+}
+
+func parents(commit *object.Commit) ([]*object.Commit, error) {
+	var found []*object.Commit
+	err := commit.Parents().ForEach(func(parent *object.Commit) error {
+		found = append(found, parent)
+		return nil
+	})
+	return found, err
+}
+
+// FirstCommit gives the first commit without a parent in the order of git
+// rev-list.
+func (r *NativeRepository) FirstCommit(ctx context.Context) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var first string
+	err := r.walk(ctx, "", func(commit *object.Commit) ([]*object.Commit, error) {
+		if first == "" && commit.NumParents() == 0 {
+			first = commit.Hash.String()
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("can not get a parentless commit, so no root to determine: %w", err)
+	}
+	if first == "" {
+		return "", errors.New("the repository has no commit, so there is no root to determine")
+	}
+	return first, nil
+}
+
+// Shallow tells if the repository is a shallow clone.
+func (r *NativeRepository) Shallow(ctx context.Context) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo, err := r.open()
+	if err != nil {
+		return false, err
+	}
+	shallow, err := repo.Storer.Shallow()
+	if err != nil {
+		return false, err
+	}
+	return len(shallow) > 0, nil
+}
+
+// Contains tells if the history of HEAD holds the commit. The walk ends at a
+// parent that the shallow clone does not have.
+func (r *NativeRepository) Contains(ctx context.Context, commit string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	target, err := r.commit(commit)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) || errors.Is(err, plumbing.ErrObjectNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	head, err := r.commit("HEAD")
+	if err != nil {
+		return false, err
+	}
+
+	seen := map[plumbing.Hash]bool{head.Hash: true}
+	pending := []*object.Commit{head}
+	for len(pending) > 0 {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if current.Hash == target.Hash {
+			return true, nil
+		}
+		for _, hash := range current.ParentHashes {
+			if seen[hash] {
+				continue
+			}
+			seen[hash] = true
+			parent, err := r.repo.CommitObject(hash)
+			if errors.Is(err, plumbing.ErrObjectNotFound) {
+				continue
+			}
+			if err != nil {
+				return false, err
+			}
+			pending = append(pending, parent)
+		}
+	}
+	return false, nil
+}
+
+// Fetch reads the tags of the remote in process. It fails for a fetch that
+// deepens the history, because go-git can not deepen a shallow clone.
+func (r *NativeRepository) Fetch(ctx context.Context, remote string, options FetchOptions) error {
+	if options.Deepen > 0 || options.Unshallow {
+		return errNativeFetch
+	}
+	if !options.Tags {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	target, err := r.remote(remote)
+	if err != nil {
+		return fmt.Errorf("can not fetch from %s: %w", remote, err)
+	}
+	refSpec := "refs/tags/*:refs/tags/*"
+	if options.Force {
+		refSpec = "+" + refSpec
+	}
+	err = target.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: remote,
+		RefSpecs:   []config.RefSpec{config.RefSpec(refSpec)},
+		Tags:       git.NoTags,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("can not fetch from %s: %w", remote, err)
+	}
+	return nil
+}
+
+// RemoteTagCommits lists the refs of the remote in process. The list also
+// holds the peeled commit of an annotated tag, with a "^{}" suffix, and that
+// commit wins.
+func (r *NativeRepository) RemoteTagCommits(ctx context.Context, remote string, tags []string) (map[string]string, error) {
+	commits := map[string]string{}
+	if len(tags) == 0 {
+		return commits, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	target, err := r.remote(remote)
+	if err != nil {
+		return nil, fmt.Errorf("can not list the tags of %s: %w", remote, err)
+	}
+	refs, err := target.ListContext(ctx, &git.ListOptions{PeelingOption: git.AppendPeeled})
+	if errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		return commits, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can not list the tags of %s: %w", remote, err)
+	}
+
+	wanted := map[string]bool{}
+	for _, tag := range tags {
+		wanted[tag] = true
+	}
+	peeled := map[string]bool{}
+	for _, ref := range refs {
+		if !ref.Name().IsTag() {
+			continue
+		}
+		name, isPeeled := strings.CutSuffix(ref.Name().Short(), "^{}")
+		if !wanted[name] || (peeled[name] && !isPeeled) {
+			continue
+		}
+		commits[name] = ref.Hash().String()
+		peeled[name] = peeled[name] || isPeeled
+	}
+	return commits, nil
+}
+
+// RemoteBranchCommit gives the tip of one branch of the remote from its ref
+// list.
+func (r *NativeRepository) RemoteBranchCommit(ctx context.Context, remote string, branch string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	target, err := r.remote(remote)
+	if err != nil {
+		return "", fmt.Errorf("can not list the branches of %s: %w", remote, err)
+	}
+	refs, err := target.ListContext(ctx, &git.ListOptions{})
+	if errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("can not list the branches of %s: %w", remote, err)
+	}
+	name := plumbing.NewBranchReferenceName(branch)
+	for _, ref := range refs {
+		if ref.Name() == name {
+			return ref.Hash().String(), nil
+		}
+	}
+	return "", nil
+}
+
+// CommitCount gives the number of commits after the given commit that HEAD
+// holds.
+func (r *NativeRepository) CommitCount(ctx context.Context, afterCommit string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := 0
+	err := r.walk(ctx, afterCommit, func(*object.Commit) ([]*object.Commit, error) {
+		count++
+		return nil, nil
+	})
+	return count, err
+}
+
+// Tags gives every tag in ref name order. An annotated tag gives the object
+// it points at, like %(*objectname) of git for-each-ref.
+func (r *NativeRepository) Tags(ctx context.Context) ([]TagRef, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	refs, err := repo.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("can not get git tags: %w", err)
+	}
+
+	var tags []TagRef
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		commit := ref.Hash()
+		if tag, err := repo.TagObject(ref.Hash()); err == nil {
+			commit = tag.Target
+		} else if !errors.Is(err, plumbing.ErrObjectNotFound) {
+			return err
+		}
+		tags = append(tags, TagRef{Name: ref.Name().Short(), Commit: commit.String()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can not get git tags: %w", err)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
+// entryHash gives the hash of the tree entry at one path, or the zero hash
+// when the tree has no entry there.
+func entryHash(tree *object.Tree, prefix string) (plumbing.Hash, error) {
+	if tree == nil {
+		return plumbing.ZeroHash, nil
+	}
+	entry, err := tree.FindEntry(prefix)
+	if errors.Is(err, object.ErrEntryNotFound) || errors.Is(err, object.ErrDirectoryNotFound) {
+		return plumbing.ZeroHash, nil
+	}
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return entry.Hash, nil
+}
+
+// changes tells if the filter sees a difference between two trees. A nil
+// tree is the empty tree of a commit without a parent.
+func (f *pathFilter) changes(from *object.Tree, to *object.Tree) (bool, error) {
+	if f == nil {
+		if from == nil || to == nil {
+			return from != to, nil
+		}
+		return from.Hash != to.Hash, nil
+	}
+	for _, prefix := range f.prefixes {
+		before, err := entryHash(from, prefix)
+		if err != nil {
+			return false, err
+		}
+		after, err := entryHash(to, prefix)
+		if err != nil {
+			return false, err
+		}
+		if before != after {
+			return true, nil
+		}
+	}
+	if len(f.globs) == 0 {
+		return false, nil
+	}
+
+	changes, err := object.DiffTree(from, to)
+	if err != nil {
+		return false, err
+	}
+	globs := &pathFilter{globs: f.globs}
+	for _, change := range changes {
+		for _, name := range []string{change.From.Name, change.To.Name} {
+			if name != "" && globs.matches(name) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// Commits gives the commits after the given commit that changed one of the
+// paths, with the default history simplification of git log: a commit that
+// matches one of its parents for the paths is hidden, and the walk follows
+// only that parent.
+func (r *NativeRepository) Commits(ctx context.Context, afterCommit string, paths []string, trustedSigners string) ([]Commit, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if trustedSigners != "" {
+		return nil, errNativeSignatures
+	}
+	if _, err := r.open(); err != nil {
+		return nil, err
+	}
+	base, err := r.baseDir()
+	if err != nil {
+		return nil, err
+	}
+	filter, err := newPathFilter(paths, r.root, base)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []Commit
+	err = r.walk(ctx, afterCommit, func(commit *object.Commit) ([]*object.Commit, error) {
+		tree, err := commit.Tree()
+		if err != nil {
+			return nil, err
+		}
+		commitParents, err := parents(commit)
+		if err != nil {
+			return nil, err
+		}
+
+		changed := true
+		if len(commitParents) == 0 {
+			if changed, err = filter.changes(nil, tree); err != nil {
+				return nil, err
+			}
+		}
+		for _, parent := range commitParents {
+			parentTree, err := parent.Tree()
+			if err != nil {
+				return nil, err
+			}
+			parentChanged, err := filter.changes(parentTree, tree)
+			if err != nil {
+				return nil, err
+			}
+			if !parentChanged {
+				return []*object.Commit{parent}, nil
+			}
+		}
+		if changed {
+			message := strings.TrimSuffix(commit.Message, "\n")
+			commits = append(commits, Commit{
+				Hash:    commit.Hash.String(),
+				Subject: subjectOf(message),
+				Message: message,
+			})
+		}
+		return commitParents, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can not get git commits: %w", err)
+	}
+	return commits, nil
+}
+
+// subjectOf gives the first paragraph of a message on one line, like the %s
+// placeholder of git log.
+func subjectOf(message string) string {
+	paragraph, _, _ := strings.Cut(strings.TrimLeft(message, "\n"), "\n\n")
+	return strings.Join(strings.Fields(strings.ReplaceAll(paragraph, "\n", " ")), " ")
+}
+
+// TagTrust can tell only that a tag is unsigned. The native backend can not
+// check a signature.
+func (r *NativeRepository) TagTrust(ctx context.Context, tag string, trustedSigners string) (TagTrust, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo, err := r.open()
+	if err != nil {
+		return "", err
+	}
+	ref, err := repo.Tag(tag)
+	if err != nil {
+		return "", err
+	}
+	tagObject, err := repo.TagObject(ref.Hash())
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		return TagUnsigned, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if tagObject.PGPSignature == "" {
+		return TagUnsigned, nil
+	}
+	return "", errNativeSignatures
+}
+
+// TagSigner reads the key of the signature of one tag. The native backend
+// can not sign tags, but it can read the key of a signature that git made.
+func (r *NativeRepository) TagSigner(ctx context.Context, tag string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo, err := r.open()
+	if err != nil {
+		return "", err
+	}
+	ref, err := repo.Tag(tag)
+	if err != nil {
+		return "", err
+	}
+	tagObject, err := repo.TagObject(ref.Hash())
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return signatureKey(tagObject.PGPSignature)
+}
+
+// SigningKey always fails, because the native backend can not sign tags.
+func (r *NativeRepository) SigningKey(ctx context.Context) (string, error) {
+	return "", errNativeSignatures
+}
+
+// cleanupMessage applies the whitespace cleanup of git tag: it removes the
+// spaces at the end of each line, joins runs of empty lines, and removes the
+// empty lines at the start and the end.
+func cleanupMessage(message string) string {
+	var lines []string
+	empty := 0
+	for _, line := range strings.Split(message, "\n") {
+		line = strings.TrimRight(line, " \t\r\v\f")
+		if line == "" {
+			empty++
+			continue
+		}
+		if empty > 0 && len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		empty = 0
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// CreateTag makes one local tag at the given commit.
+func (r *NativeRepository) CreateTag(ctx context.Context, tag string, commit string, options TagOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.createTag(tag, commit, options)
+}
+
+func (r *NativeRepository) createTag(tag string, commit string, options TagOptions) error {
+	if options.Sign {
+		return errNativeSignatures
+	}
+	resolved, err := r.commit(commit)
+	if err != nil {
+		return fmt.Errorf("error tagging: %w", err)
+	}
+	var tagOptions *git.CreateTagOptions
+	if options.Message != "" {
+		tagOptions = &git.CreateTagOptions{Message: cleanupMessage(options.Message)}
+	}
+	if _, err := r.repo.CreateTag(tag, resolved.Hash, tagOptions); err != nil {
+		return fmt.Errorf("error tagging %s: %w", tag, err)
+	}
+	return nil
+}
+
+// UpdateTag makes a local tag at the given commit or moves an existing local
+// tag there.
+func (r *NativeRepository) UpdateTag(ctx context.Context, tag string, commit string, options TagOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if options.Sign {
+		return errNativeSignatures
+	}
+	repo, err := r.open()
+	if err != nil {
+		return err
+	}
+	if err := repo.DeleteTag(tag); err != nil && !errors.Is(err, git.ErrTagNotFound) {
+		return fmt.Errorf("error updating tag: %w", err)
+	}
+	if err := r.createTag(tag, commit, options); err != nil {
+		return fmt.Errorf("error updating tag: %w", err)
+	}
+	return nil
+}
+
+// TagObject gives the object of one local tag.
+func (r *NativeRepository) TagObject(ctx context.Context, tag string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo, err := r.open()
+	if err != nil {
+		return "", err
+	}
+	ref, err := repo.Storer.Reference(plumbing.NewTagReferenceName(tag))
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("can not read the tag %s: %w", tag, err)
+	}
+	return ref.Hash().String(), nil
+}
+
+// RestoreTag points one local tag at an object, or removes it.
+func (r *NativeRepository) RestoreTag(ctx context.Context, tag string, object string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo, err := r.open()
+	if err != nil {
+		return err
+	}
+	name := plumbing.NewTagReferenceName(tag)
+	if object == "" {
+		err = repo.Storer.RemoveReference(name)
+	} else {
+		err = repo.Storer.SetReference(plumbing.NewHashReference(name, plumbing.NewHash(object)))
+	}
+	if err != nil {
+		return fmt.Errorf("can not restore the tag %s: %w", tag, err)
+	}
+	return nil
+}
+
+// remote gives a configured remote by name, or a remote for a URL. It makes
+// go-git serve file remotes in process.
+func (r *NativeRepository) remote(name string) (*git.Remote, error) {
+	repo, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	installFileTransport.Do(func() {
+		client.InstallProtocol("file", server.DefaultServer)
+	})
+
+	target, err := repo.Remote(name)
+	if errors.Is(err, git.ErrRemoteNotFound) {
+		return git.NewRemote(repo.Storer, &config.RemoteConfig{Name: name, URLs: []string{name}}), nil
+	}
+	return target, err
+}
+
+// PushTags sends the new tags to the remote in process. The remote is a
+// configured remote name or a URL. A file remote does not take an atomic
+// push, but the push checks every ref before it sends any of them.
+func (r *NativeRepository) PushTags(
+	ctx context.Context,
+	remote string,
+	branch string,
+	atomic bool,
+	tags []string,
+	forceTags []string,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	target, err := r.remote(remote)
+	if err != nil {
+		return fmt.Errorf("error pushing tags: %w", err)
+	}
+
+	var refSpecs []config.RefSpec
+	if branch != "" {
+		refSpecs = append(refSpecs, config.RefSpec("refs/heads/"+branch+":refs/heads/"+branch))
+	}
+	for _, tag := range tags {
+		refSpecs = append(refSpecs, config.RefSpec("refs/tags/"+tag+":refs/tags/"+tag))
+	}
+	for _, tag := range forceTags {
+		refSpecs = append(refSpecs, config.RefSpec("+refs/tags/"+tag+":refs/tags/"+tag))
+	}
+
+	err = target.PushContext(ctx, &git.PushOptions{RemoteName: remote, RefSpecs: refSpecs, Atomic: atomic})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("error pushing tags: %w", err)
+	}
+	return nil
+}
@@ -27,6 +27,36 @@ type Outputs struct {
 	LastReleaseVersion     string `json:"Last_release_version"`
 	LastReleaseGitHead     string `json:"Last_release_git_head"`
 	LastReleaseGitTag      string `json:"Last_release_git_tag"`
+	// SnapshotVersion is set only in a snapshot run, so other runs keep the
+	// same JSON object.
+	SnapshotVersion string `json:"Snapshot_version,omitempty"`
+	// NewReleaseSigningKey is set only in a signed run that makes a tag. It
+	// names the key of each signature. A target without a new tag has an
+	// empty value.
+	NewReleaseSigningKey string `json:"New_release_signing_key,omitempty"`
+	// NewReleaseUnverifiedCommits lists the commits of each target that a
+	// signed_commits run did not count, separated by spaces. It is empty
+	// when every commit has a trusted signature.
+	NewReleaseUnverifiedCommits string `json:"New_release_unverified_commits,omitempty"`
+	// NewReleaseAlreadyReleased tells for each target if its new tag pointed
+	// at HEAD before the run. It is set only when a target was already
+	// released, so other runs keep the same JSON object.
+	NewReleaseAlreadyReleased string `json:"New_release_already_released,omitempty"`
+	// NewReleaseRemotePushes gives the result of the push to each remote,
+	// such as "origin=pushed,backup=failed". It is set only when the run
+	// lists remotes and pushes tags.
+	NewReleaseRemotePushes string `json:"New_release_remote_pushes,omitempty"`
+	// NewReleaseLostTags lists the tags of each target that another run
+	// pushed first, separated by spaces. It is empty when no push lost a
+	// race.
+	NewReleaseLostTags string `json:"New_release_lost_tags,omitempty"`
+	// NewReleasePolicy gives for each target the strongest action of the
+	// release policies that apply to it, or "none". It is set only when a
+	// policy applies to a target.
+	NewReleasePolicy string `json:"New_release_policy,omitempty"`
+	// NewReleasePolicyRules lists the policies that apply to each target,
+	// separated by spaces.
+	NewReleasePolicyRules string `json:"New_release_policy_rules,omitempty"`
 }
 
 // joinValues makes the separated output of one field. It removes the
@@ -39,26 +69,18 @@ func joinValues(values []string, separator string) string {
 	return strings.TrimRight(joined, separator)
 }
 
-// tagFor makes the tag text of one version. The package name is a prefix, and
-// the whole repository has no package name.
-func tagFor(version *VersionInfo) string {
-	if version.Package == "" {
-		return version.Version.FormattedString()
-	}
-	return version.Package + "/" + version.Version.FormattedString()
+// tagFor makes the tag text of one version with the tag format of its
+// target. The default format uses the package name as a prefix, and the whole
+// repository has no package name.
+func tagFor(version *VersionInfo) (string, error) {
+	return version.tagFormat().tag(version.Package, version.Version)
 }
 
 // shortTagsFor gives the mutable major and minor tags for one full release
-// tag. These tags point to the same commit as the full release tag.
-func shortTagsFor(version *VersionInfo) []string {
-	prefix := ""
-	if version.Package != "" {
-		prefix = version.Package + "/"
-	}
-	return []string{
-		fmt.Sprintf("%sv%d.%d", prefix, version.Version.Major, version.Version.Minor),
-		fmt.Sprintf("%sv%d", prefix, version.Version.Major),
-	}
+// tag. These tags point to the same commit as the full release tag, and they
+// use the same tag format.
+func shortTagsFor(version *VersionInfo) ([]string, error) {
+	return version.tagFormat().shortTags(version.Package, version.Version)
 }
 
 // releaseNotesJson makes a JSON object with the notes of each package. It
@@ -110,12 +132,23 @@ func GenerateOutputs(results []DirectoryVersionInfo, dryRun bool) (Outputs, erro
 	lastVersions := make([]string, 0, count)
 	lastHeads := make([]string, 0, count)
 	lastTags := make([]string, 0, count)
+	snapshots := make([]string, 0, count)
+	signingKeys := make([]string, 0, count)
+	unverifiedCommits := make([]string, 0, count)
+	lostTags := make([]string, 0, count)
+	alreadyReleased := make([]string, 0, count)
+	anyReleased := false
+	policies := make([]string, 0, count)
+	policyRules := make([]string, 0, count)
+	anyPolicy := false
 
 	for _, result := range results {
 		next := result.NextVersion
 		last := result.LastVersion
 
-		changed := next.Version.FormattedString() != last.Version.FormattedString()
+		// A release that a policy blocks or makes a dry run gets no tag.
+		changed := next.Version.FormattedString() != last.Version.FormattedString() &&
+			result.Policy != PolicyBlock
 		published = append(published, strconv.FormatBool(changed))
 
 		packages = append(packages, next.Package)
@@ -127,35 +160,71 @@ func GenerateOutputs(results []DirectoryVersionInfo, dryRun bool) (Outputs, erro
 		patchVersions = append(patchVersions, fmt.Sprintf("%d", next.Version.Patch))
 		newHeads = append(newHeads, next.CommitHash)
 		notes = append(notes, strings.Join(result.ReleaseNotes, "\n"))
-		dryRuns = append(dryRuns, strconv.FormatBool(dryRun))
-		newTags = append(newTags, tagFor(next))
+		dryRuns = append(dryRuns, strconv.FormatBool(dryRun || result.Policy == PolicyDryRun))
+		newTag, err := tagFor(next)
+		if err != nil {
+			return Outputs{}, err
+		}
+		newTags = append(newTags, newTag)
 		lastVersions = append(lastVersions, fmt.Sprintf(
 			"%d.%d.%d", last.Version.Major, last.Version.Minor, last.Version.Patch,
 		))
 		lastHeads = append(lastHeads, last.CommitHash)
-		lastTags = append(lastTags, tagFor(last))
+		lastTag, err := tagFor(last)
+		if err != nil {
+			return Outputs{}, err
+		}
+		lastTags = append(lastTags, lastTag)
+		if result.SnapshotVersion != "" {
+			snapshots = append(snapshots, result.SnapshotVersion)
+		}
+		signingKeys = append(signingKeys, result.SigningKey)
+		unverifiedCommits = append(unverifiedCommits, strings.Join(result.UnverifiedCommits, " "))
+		lostTags = append(lostTags, strings.Join(result.LostTags, " "))
+		alreadyReleased = append(alreadyReleased, strconv.FormatBool(result.AlreadyReleased))
+		anyReleased = anyReleased || result.AlreadyReleased
+		policy := result.Policy
+		if policy == "" {
+			policy = "none"
+		}
+		policies = append(policies, policy)
+		policyRules = append(policyRules, strings.Join(result.PolicyRules, " "))
+		anyPolicy = anyPolicy || result.Policy != ""
 	}
 
 	notesJson, err := releaseNotesJson(results)
 	if err != nil {
 		return Outputs{}, err
 	}
+	if !anyReleased {
+		alreadyReleased = nil
+	}
+	if !anyPolicy {
+		policies = nil
+	}
 
 	return Outputs{
-		NewReleasePublished:    joinValues(published, ","),
-		NewReleaseVersion:      joinValues(versions, ","),
-		NewReleaseMajorVersion: joinValues(majorVersions, ","),
-		NewReleaseMinorVersion: joinValues(minorVersions, ","),
-		NewReleasePatchVersion: joinValues(patchVersions, ","),
-		NewReleaseGitHead:      joinValues(newHeads, ","),
-		NewReleaseNotes:        joinValues(notes, ",\n"),
-		NewReleaseNotesJson:    notesJson,
-		DryRun:                 joinValues(dryRuns, ","),
-		ReleasePackage:         joinValues(packages, ","),
-		NewReleaseGitTag:       joinValues(newTags, ","),
-		LastReleaseVersion:     joinValues(lastVersions, ","),
-		LastReleaseGitHead:     joinValues(lastHeads, ","),
-		LastReleaseGitTag:      joinValues(lastTags, ","),
+		NewReleasePublished:         joinValues(published, ","),
+		NewReleaseVersion:           joinValues(versions, ","),
+		NewReleaseMajorVersion:      joinValues(majorVersions, ","),
+		NewReleaseMinorVersion:      joinValues(minorVersions, ","),
+		NewReleasePatchVersion:      joinValues(patchVersions, ","),
+		NewReleaseGitHead:           joinValues(newHeads, ","),
+		NewReleaseNotes:             joinValues(notes, ",\n"),
+		NewReleaseNotesJson:         notesJson,
+		DryRun:                      joinValues(dryRuns, ","),
+		ReleasePackage:              joinValues(packages, ","),
+		NewReleaseGitTag:            joinValues(newTags, ","),
+		LastReleaseVersion:          joinValues(lastVersions, ","),
+		LastReleaseGitHead:          joinValues(lastHeads, ","),
+		LastReleaseGitTag:           joinValues(lastTags, ","),
+		SnapshotVersion:             joinValues(snapshots, ","),
+		NewReleaseSigningKey:        joinValues(signingKeys, ","),
+		NewReleaseUnverifiedCommits: joinValues(unverifiedCommits, ","),
+		NewReleaseAlreadyReleased:   joinValues(alreadyReleased, ","),
+		NewReleaseLostTags:          joinValues(lostTags, ","),
+		NewReleasePolicy:            joinValues(policies, ","),
+		NewReleasePolicyRules:       joinValues(policyRules, ","),
 	}, nil
 }
 
@@ -175,4 +244,28 @@ func SetGithubActionOutputs(results Outputs) {
 	gha.SetOutput("last_release_version", results.LastReleaseVersion)
 	gha.SetOutput("last_release_git_head", results.LastReleaseGitHead)
 	gha.SetOutput("last_release_git_tag", results.LastReleaseGitTag)
+	if results.SnapshotVersion != "" {
+		gha.SetOutput("snapshot_version", results.SnapshotVersion)
+	}
+	if results.NewReleaseSigningKey != "" {
+		gha.SetOutput("new_release_signing_key", results.NewReleaseSigningKey)
+	}
+	if results.NewReleaseUnverifiedCommits != "" {
+		gha.SetOutput("new_release_unverified_commits", results.NewReleaseUnverifiedCommits)
+	}
+	if results.NewReleaseAlreadyReleased != "" {
+		gha.SetOutput("new_release_already_released", results.NewReleaseAlreadyReleased)
+	}
+	if results.NewReleaseRemotePushes != "" {
+		gha.SetOutput("new_release_remote_pushes", results.NewReleaseRemotePushes)
+	}
+	if results.NewReleaseLostTags != "" {
+		gha.SetOutput("new_release_lost_tags", results.NewReleaseLostTags)
+	}
+	if results.NewReleasePolicy != "" {
+		gha.SetOutput("new_release_policy", results.NewReleasePolicy)
+	}
+	if results.NewReleasePolicyRules != "" {
+		gha.SetOutput("new_release_policy_rules", results.NewReleasePolicyRules)
+	}
 }
@@ -57,14 +57,18 @@ func TestShortTagsForPackageVersion(t *testing.T) {
 	info, err := ParseVersionInfo("api/v1.3.7,hash")
 	require.NoError(t, err)
 
-	assert.Equal(t, []string{"api/v1.3", "api/v1"}, shortTagsFor(info))
+	shortTags, err := shortTagsFor(info)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"api/v1.3", "api/v1"}, shortTags)
 }
 
 func TestShortTagsForWholeRepositoryVersion(t *testing.T) {
 	info, err := ParseVersionInfo("v1.3.7,hash")
 	require.NoError(t, err)
 
-	assert.Equal(t, []string{"v1.3", "v1"}, shortTagsFor(info))
+	shortTags, err := shortTagsFor(info)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1.3", "v1"}, shortTags)
 }
 
 func TestGenerateOutputsJoinsGroupsInOrder(t *testing.T) {
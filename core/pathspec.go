@@ -0,0 +1,164 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// resolveDir gives the absolute form of a directory with its symbolic links
+// resolved, like the paths that git reports. An empty dir is the current
+// directory.
+func resolveDir(dir string) (string, error) {
+	if dir == "" {
+		var err error
+		if dir, err = os.Getwd(); err != nil {
+			return "", err
+		}
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(dir)
+}
+
+// pathFilter is a list of pathspecs relative to the root. A nil filter
+// matches every path.
+type pathFilter struct {
+	prefixes []string
+	globs    []*regexp.Regexp
+}
+
+// newPathFilter reads the pathspecs that a run gives git. A plain path is
+// relative to the base directory, and a path with a wildcard is a glob that
+// must match the whole path, as globPattern reads it. The root and the base
+// directory are absolute paths with their symbolic links resolved.
+func newPathFilter(pathspecs []string, root string, base string) (*pathFilter, error) {
+	filter := &pathFilter{}
+	for _, pathspec := range pathspecs {
+		literal := false
+		switch {
+		case pathspec == ":(top)":
+			return nil, nil
+		case strings.HasPrefix(pathspec, ":(top,literal)"):
+			pathspec = strings.TrimPrefix(pathspec, ":(top,literal)")
+			literal = true
+		default:
+			if !filepath.IsAbs(pathspec) {
+				pathspec = filepath.Join(base, pathspec)
+			}
+			relative, err := filepath.Rel(root, filepath.Clean(pathspec))
+			if err != nil {
+				return nil, err
+			}
+			pathspec = filepath.ToSlash(relative)
+		}
+
+		if pathspec == "." || pathspec == "" {
+			return nil, nil
+		}
+		if pathspec == ".." || strings.HasPrefix(pathspec, "../") {
+			continue
+		}
+		if !literal && strings.ContainsAny(pathspec, "*?[") {
+			glob, err := regexp.Compile("^" + globPattern(pathspec) + "$")
+			if err != nil {
+				return nil, fmt.Errorf("can not read the pathspec %q: %w", pathspec, err)
+			}
+			filter.globs = append(filter.globs, glob)
+			continue
+		}
+		filter.prefixes = append(filter.prefixes, strings.TrimSuffix(pathspec, "/"))
+	}
+	return filter, nil
+}
+
+// globPattern gives the regular expression of a wildcard pathspec. Like git,
+// the glob must match the whole path, "*" and "?" also match "/", and "[!a]"
+// and "[^a]" match any character but "a". A "\" makes the next character
+// literal, and a "[" without a "]" is literal.
+func globPattern(pathspec string) string {
+	var pattern strings.Builder
+	for i := 0; i < len(pathspec); i++ {
+		switch pathspec[i] {
+		case '*':
+			pattern.WriteString(".*")
+		case '?':
+			pattern.WriteString(".")
+		case '\\':
+			if i+1 < len(pathspec) {
+				i++
+			}
+			pattern.WriteString(regexp.QuoteMeta(pathspec[i : i+1]))
+		case '[':
+			end := i + 1
+			if end < len(pathspec) && (pathspec[end] == '!' || pathspec[end] == '^') {
+				end++
+			}
+			if end < len(pathspec) && pathspec[end] == ']' {
+				end++
+			}
+			for end < len(pathspec) && pathspec[end] != ']' {
+				end++
+			}
+			if end >= len(pathspec) {
+				pattern.WriteString(`\[`)
+				continue
+			}
+			class := pathspec[i+1 : end]
+			pattern.WriteString("[")
+			if rest, found := strings.CutPrefix(class, "!"); found {
+				class = rest
+				pattern.WriteString("^")
+			} else if rest, found := strings.CutPrefix(class, "^"); found {
+				class = rest
+				pattern.WriteString("^")
+			}
+			for _, character := range class {
+				if strings.ContainsRune(`\[]^`, character) {
+					pattern.WriteString(`\`)
+				}
+				pattern.WriteRune(character)
+			}
+			pattern.WriteString("]")
+			i = end
+		default:
+			pattern.WriteString(regexp.QuoteMeta(pathspec[i : i+1]))
+		}
+	}
+	return pattern.String()
+}
+
+// PathspecMatcher gives a function that tells if a path relative to the root
+// matches one of the pathspecs that a run gives git, with the rules of
+// newPathFilter. It lets a Repository without git, such as the gittest fake,
+// select the commits of a target like git does.
+func PathspecMatcher(pathspecs []string, root string, base string) (func(name string) bool, error) {
+	filter, err := newPathFilter(pathspecs, root, base)
+	if err != nil {
+		return nil, err
+	}
+	return filter.matches, nil
+}
+
+// matches tells if the filter holds one path relative to the root. A path
+// matches a prefix that is the path itself or one of its directories.
+func (f *pathFilter) matches(name string) bool {
+	if f == nil {
+		return true
+	}
+	for _, prefix := range f.prefixes {
+		if name == prefix || strings.HasPrefix(name, prefix+"/") {
+			return true
+		}
+	}
+	for _, glob := range f.globs {
+		if glob.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,324 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/catalystcommunity/app-utils-go/logging"
+)
+
+// Release policy actions, from the weakest to the strongest.
+const (
+	// PolicyWarn logs a warning and keeps the release.
+	PolicyWarn = "warn"
+	// PolicyDryRun reports the release like a dry run and makes no tag for it.
+	PolicyDryRun = "dry_run"
+	// PolicyBlock makes no tag for the release and fails the run after the
+	// other targets release. It is the default action.
+	PolicyBlock = "block"
+)
+
+// Version bump levels, from the smallest to the largest. A prerelease bump
+// keeps the major, minor, and patch numbers.
+const (
+	BumpPrerelease = "prerelease"
+	BumpPatch      = "patch"
+	BumpMinor      = "minor"
+	BumpMajor      = "major"
+)
+
+var (
+	policyActions = []string{PolicyWarn, PolicyDryRun, PolicyBlock}
+	bumpLevels    = []string{BumpPrerelease, BumpPatch, BumpMinor, BumpMajor}
+)
+
+// PolicyConfig is one release rule. The rule applies to a new version when
+// every condition that it sets holds. A rule without conditions applies to
+// every release.
+type PolicyConfig struct {
+	Name string `mapstructure:"name" yaml:"name"`
+	// Action is PolicyBlock, PolicyDryRun, or PolicyWarn. An empty value is
+	// PolicyBlock.
+	Action string `mapstructure:"action" yaml:"action,omitempty"`
+	// Targets holds path.Match patterns for the target names.
+	Targets []string `mapstructure:"targets" yaml:"targets,omitempty"`
+	// Paths holds path.Match patterns for the paths of a target. A pattern
+	// also covers every path below a path that it matches.
+	Paths []string `mapstructure:"paths" yaml:"paths,omitempty"`
+	// Branches holds path.Match patterns for the checked-out branch. With a
+	// detached HEAD, as in many CI checkouts, the branch is Config.Branch.
+	// When neither names a branch, a rule with branches applies.
+	Branches []string `mapstructure:"branches" yaml:"branches,omitempty"`
+	// Weekdays names the days that the rule applies on, such as "friday".
+	Weekdays []string `mapstructure:"weekdays" yaml:"weekdays,omitempty"`
+	// Freezes holds the windows that the rule applies in.
+	Freezes []FreezeWindow `mapstructure:"freezes" yaml:"freezes,omitempty"`
+	// MaxBump is the largest bump that the rule allows. The rule applies
+	// only to a larger bump. An empty value applies to every bump.
+	MaxBump string `mapstructure:"max_bump" yaml:"max_bump,omitempty"`
+	// Timezone is the IANA time zone of Weekdays and Freezes. An empty value
+	// is UTC.
+	Timezone string `mapstructure:"timezone" yaml:"timezone,omitempty"`
+	// UnlessApproved makes the rule skip a release whose commits of the
+	// major level all have an approval, a BreakingApprovalTrailer on the
+	// commit or a later one from one of Config.BreakingApprovers.
+	UnlessApproved bool `mapstructure:"unless_approved" yaml:"unless_approved,omitempty"`
+}
+
+// FreezeWindow is a window of days, both days included. Each day is a
+// MM-DD day of every year, or a YYYY-MM-DD date. A yearly window with a start
+// after its end goes over the new year.
+type FreezeWindow struct {
+	Start string `mapstructure:"start" yaml:"start"`
+	End   string `mapstructure:"end" yaml:"end"`
+}
+
+// BlockedRelease is one release that a policy blocked.
+type BlockedRelease struct {
+	Package string
+	Rules   []string
+}
+
+// PolicyError is the error of a run in which a release policy blocked at
+// least one release. The other targets of the run still release.
+type PolicyError struct {
+	Releases []BlockedRelease
+}
+
+func (e *PolicyError) Error() string {
+	blocked := make([]string, 0, len(e.Releases))
+	for _, release := range e.Releases {
+		blocked = append(blocked, fmt.Sprintf("%s (%s)", release.Package, strings.Join(release.Rules, ", ")))
+	}
+	return "a release policy blocked " + strings.Join(blocked, ", ")
+}
+
+// releasePolicy is one checked PolicyConfig.
+type releasePolicy struct {
+	PolicyConfig
+	location *time.Location
+	weekdays []time.Weekday
+}
+
+// newReleasePolicies checks the policies of a run.
+func newReleasePolicies(config Config) ([]releasePolicy, error) {
+	policies := make([]releasePolicy, 0, len(config.Policies))
+	seen := map[string]bool{}
+	for _, policyConfig := range config.Policies {
+		policy, err := newReleasePolicy(policyConfig)
+		if err != nil {
+			return nil, fmt.Errorf("policy %q: %w", policyConfig.Name, err)
+		}
+		if seen[policy.Name] {
+			return nil, fmt.Errorf("policy %q is listed more than one time", policy.Name)
+		}
+		seen[policy.Name] = true
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+func newReleasePolicy(config PolicyConfig) (releasePolicy, error) {
+	policy := releasePolicy{PolicyConfig: config, location: time.UTC}
+	if strings.TrimSpace(config.Name) == "" {
+		return policy, errors.New("every policy needs a name")
+	}
+	if policy.Action == "" {
+		policy.Action = PolicyBlock
+	}
+	if !slices.Contains(policyActions, policy.Action) {
+		return policy, fmt.Errorf("action %q is not one of %s", policy.Action, strings.Join(policyActions, ", "))
+	}
+	if policy.MaxBump != "" && !slices.Contains(bumpLevels, policy.MaxBump) {
+		return policy, fmt.Errorf("max_bump %q is not one of %s", policy.MaxBump, strings.Join(bumpLevels, ", "))
+	}
+	for _, pattern := range slices.Concat(config.Targets, config.Paths, config.Branches) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return policy, fmt.Errorf("pattern %q: %w", pattern, err)
+		}
+	}
+	for _, name := range config.Weekdays {
+		weekday, err := parseWeekday(name)
+		if err != nil {
+			return policy, err
+		}
+		policy.weekdays = append(policy.weekdays, weekday)
+	}
+	for _, window := range config.Freezes {
+		if _, err := window.contains(time.Time{}); err != nil {
+			return policy, err
+		}
+	}
+	if config.Timezone != "" {
+		location, err := time.LoadLocation(config.Timezone)
+		if err != nil {
+			return policy, fmt.Errorf("timezone %q: %w", config.Timezone, err)
+		}
+		policy.location = location
+	}
+	return policy, nil
+}
+
+func parseWeekday(name string) (time.Weekday, error) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(name, day.String()) {
+			return day, nil
+		}
+	}
+	return 0, fmt.Errorf("weekday %q is not the English name of a day", name)
+}
+
+// contains tells if the day of the time is in the window.
+func (w FreezeWindow) contains(now time.Time) (bool, error) {
+	if len(w.Start) != len(w.End) {
+		return false, fmt.Errorf("freeze %s to %s mixes a yearly day and a date", w.Start, w.End)
+	}
+	layout := "2006-01-02"
+	if len(w.Start) == len("01-02") {
+		layout = "01-02"
+	}
+	start, err := time.Parse(layout, w.Start)
+	if err != nil {
+		return false, fmt.Errorf("freeze start %q is not MM-DD or YYYY-MM-DD: %w", w.Start, err)
+	}
+	end, err := time.Parse(layout, w.End)
+	if err != nil {
+		return false, fmt.Errorf("freeze end %q is not MM-DD or YYYY-MM-DD: %w", w.End, err)
+	}
+	day := now.Format(layout)
+	first, last := start.Format(layout), end.Format(layout)
+	if first > last && layout == "01-02" {
+		return day >= first || day <= last, nil
+	}
+	return day >= first && day <= last, nil
+}
+
+// applies tells if the policy applies to the release of one target.
+func (p releasePolicy) applies(group DirectoryVersionInfo, branch string, now time.Time) bool {
+	if len(p.Targets) > 0 && !matchesAny(p.Targets, group.PackageName()) {
+		return false
+	}
+	if len(p.Paths) > 0 && !slices.ContainsFunc(group.Directories, func(directory string) bool {
+		return pathCovered(p.Paths, directory)
+	}) {
+		return false
+	}
+	if len(p.Branches) > 0 && branch != "" && !matchesAny(p.Branches, branch) {
+		return false
+	}
+	if p.UnlessApproved && group.approved {
+		return false
+	}
+	local := now.In(p.location)
+	if len(p.weekdays) > 0 && !slices.Contains(p.weekdays, local.Weekday()) {
+		return false
+	}
+	if len(p.Freezes) > 0 && !slices.ContainsFunc(p.Freezes, func(window FreezeWindow) bool {
+		frozen, _ := window.contains(local)
+		return frozen
+	}) {
+		return false
+	}
+	if p.MaxBump != "" {
+		bump := bumpLevel(group.LastVersion, group.NextVersion)
+		return slices.Index(bumpLevels, bump) > slices.Index(bumpLevels, p.MaxBump)
+	}
+	return true
+}
+
+func matchesAny(patterns []string, value string) bool {
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		matched, _ := path.Match(pattern, value)
+		return matched
+	})
+}
+
+// pathCovered tells if a pattern matches the path or a directory above it.
+func pathCovered(patterns []string, value string) bool {
+	for current := path.Clean(value); ; current = path.Dir(current) {
+		if matchesAny(patterns, current) {
+			return true
+		}
+		if current == "." || current == "/" {
+			return false
+		}
+	}
+}
+
+// bumpLevel gives the largest version number that changed from the last
+// version to the next one.
+func bumpLevel(last *VersionInfo, next *VersionInfo) string {
+	switch {
+	case next.Version.Major != last.Version.Major:
+		return BumpMajor
+	case next.Version.Minor != last.Version.Minor:
+		return BumpMinor
+	case next.Version.Patch != last.Version.Patch:
+		return BumpPatch
+	default:
+		return BumpPrerelease
+	}
+}
+
+// applyPolicies gives each target with a new version the strongest action
+// of the policies that apply to it. A release at HEAD passed the policies
+// of the run that made it, so no policy applies to it. A detached HEAD is on
+// the branch that the run pushes; without one, the branch is unknown and
+// every rule with branches applies.
+func (t *tagger) applyPolicies(ctx context.Context, results []DirectoryVersionInfo) error {
+	if len(t.policies) == 0 {
+		return nil
+	}
+	branch, err := t.repo.CurrentBranch(ctx)
+	if err != nil {
+		return err
+	}
+	if branch == "HEAD" {
+		branch = t.config.Branch
+	}
+	if branch == "" && slices.ContainsFunc(t.policies, func(policy releasePolicy) bool { return len(policy.Branches) > 0 }) {
+		logging.Log.Warn("HEAD is detached and no branch is set, so every policy with branches applies")
+	}
+	now := t.config.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	for idx := range results {
+		group := &results[idx]
+		if group.AlreadyReleased || !group.hasNewVersion() {
+			continue
+		}
+		for _, policy := range t.policies {
+			if !policy.applies(*group, branch, now) {
+				continue
+			}
+			logging.Log.Warn(fmt.Sprintf(
+				"Policy %s applies to %s: %s", policy.Name, group.NextVersion.Package, policy.Action,
+			))
+			group.PolicyRules = append(group.PolicyRules, policy.Name)
+			if slices.Index(policyActions, policy.Action) > slices.Index(policyActions, group.Policy) {
+				group.Policy = policy.Action
+			}
+		}
+	}
+	return nil
+}
+
+// policyError gives the error of the releases that a policy blocked.
+func policyError(results []DirectoryVersionInfo) error {
+	var blocked []BlockedRelease
+	for _, result := range results {
+		if result.Policy == PolicyBlock {
+			blocked = append(blocked, BlockedRelease{Package: result.NextVersion.Package, Rules: result.PolicyRules})
+		}
+	}
+	if len(blocked) == 0 {
+		return nil
+	}
+	return &PolicyError{Releases: blocked}
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreezeWindowContainsItsDays(t *testing.T) {
+	yearEnd := FreezeWindow{Start: "12-20", End: "01-03"}
+	summer := FreezeWindow{Start: "2026-07-01", End: "2026-07-15"}
+	cases := []struct {
+		window   FreezeWindow
+		day      string
+		expected bool
+	}{
+		{yearEnd, "2026-12-19", false},
+		{yearEnd, "2026-12-20", true},
+		{yearEnd, "2027-01-01", true},
+		{yearEnd, "2027-01-03", true},
+		{yearEnd, "2027-01-04", false},
+		{summer, "2026-07-15", true},
+		{summer, "2027-07-10", false},
+	}
+
+	for _, testCase := range cases {
+		day, err := time.Parse("2006-01-02", testCase.day)
+		require.NoError(t, err)
+		contains, err := testCase.window.contains(day)
+		require.NoError(t, err)
+		assert.Equal(t, testCase.expected, contains, "%v on %s", testCase.window, testCase.day)
+	}
+}
+
+func TestReleasePoliciesRejectBadRules(t *testing.T) {
+	cases := map[string]PolicyConfig{
+		"needs a name":       {},
+		"is not one of":      {Name: "action", Action: "stop"},
+		"max_bump":           {Name: "bump", MaxBump: "huge"},
+		"English name":       {Name: "day", Weekdays: []string{"freitag"}},
+		"mixes a yearly day": {Name: "mixed", Freezes: []FreezeWindow{{Start: "12-20", End: "2027-01-03"}}},
+		"is not MM-DD":       {Name: "date", Freezes: []FreezeWindow{{Start: "13-40", End: "01-03"}}},
+		"timezone":           {Name: "zone", Timezone: "Mars/Olympus"},
+		"syntax error":       {Name: "pattern", Targets: []string{"[api"}},
+		"more than one time": {Name: "twice"},
+	}
+
+	for message, policy := range cases {
+		config := Config{Policies: []PolicyConfig{policy}}
+		if message == "more than one time" {
+			config.Policies = append(config.Policies, policy)
+		}
+		_, err := newReleasePolicies(config)
+		assert.ErrorContains(t, err, message)
+	}
+}
+
+func TestPolicyPathsCoverTheDirectoriesBelow(t *testing.T) {
+	assert.True(t, pathCovered([]string{"platform"}, "platform/network/dns"))
+	assert.True(t, pathCovered([]string{"platform/*"}, "platform/network/dns"))
+	assert.False(t, pathCovered([]string{"platform"}, "services/platform"))
+	assert.False(t, pathCovered([]string{"platform/*"}, "platform"))
+}
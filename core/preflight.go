@@ -0,0 +1,127 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/catalystcommunity/app-utils-go/logging"
+)
+
+// BranchMismatchError is the error of a run whose HEAD is not the tip of the
+// branch that it pushes. A detached HEAD on another commit, or a local branch
+// that is behind, would push a branch state that the release does not hold.
+type BranchMismatchError struct {
+	Branch string
+	// BranchCommit is the tip of the local branch. It is empty when the
+	// branch does not exist.
+	BranchCommit string
+	Head         string
+}
+
+func (e *BranchMismatchError) Error() string {
+	if e.BranchCommit == "" {
+		return fmt.Sprintf(
+			"HEAD is at %s, but there is no local branch %s to push; set the branch to \"\" to push only the tags",
+			e.Head, e.Branch,
+		)
+	}
+	return fmt.Sprintf(
+		"HEAD is at %s, but the branch %s is at %s; check out the branch, or set the branch to \"\" to push only the tags",
+		e.Head, e.Branch, e.BranchCommit,
+	)
+}
+
+// DirtyWorkTreeError is the error of a run that requires a clean work tree
+// and finds changes that HEAD does not hold.
+type DirtyWorkTreeError struct {
+	Paths []string
+}
+
+func (e *DirtyWorkTreeError) Error() string {
+	return fmt.Sprintf("the work tree has changes that HEAD does not hold: %s", strings.Join(e.Paths, ", "))
+}
+
+// DivergedBranchError is the error of a remote whose branch is not in the
+// history of HEAD. The push of the branch would fail, or the release would
+// miss the commits that the remote holds.
+type DivergedBranchError struct {
+	Remote       string
+	Branch       string
+	RemoteCommit string
+}
+
+func (e *DivergedBranchError) Error() string {
+	return fmt.Sprintf(
+		"the branch %s of %s is at %s, which is not in the history of HEAD; pull the branch first",
+		e.Branch, e.Remote, e.RemoteCommit,
+	)
+}
+
+// preflight checks the repository and every remote before a run makes its
+// tags. A remote that holds one of the new tags at another commit gives a
+// TagRaceError.
+func (r releaseTags) preflight(ctx context.Context, repo Repository, config Config) error {
+	head, err := repo.Head(ctx)
+	if err != nil {
+		return err
+	}
+	remotes := config.pushRemotes()
+	pushesBranch := false
+	for _, remote := range remotes {
+		pushesBranch = pushesBranch || remote.branch(config) != ""
+	}
+	if pushesBranch {
+		tip, err := repo.BranchCommit(ctx, config.Branch)
+		if err != nil {
+			return err
+		}
+		if tip != head {
+			return &BranchMismatchError{Branch: config.Branch, BranchCommit: tip, Head: head}
+		}
+	}
+	if config.RequireClean || config.ReleaseCommit {
+		paths, err := repo.Changes(ctx)
+		if err != nil {
+			return err
+		}
+		if len(paths) > 0 {
+			return &DirtyWorkTreeError{Paths: paths}
+		}
+	}
+
+	for idx, remote := range remotes {
+		err := r.checkPushRemote(ctx, repo, config, remote)
+		if err != nil && idx > 0 && config.MirrorFailure == MirrorFailureWarn {
+			// The push to the mirror fails or not on its own, like a mirror
+			// that the check can not reach.
+			logging.Log.WithError(err).Warn(fmt.Sprintf("The check of the mirror %s failed", remote.Name))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPushRemote checks that the branch of the remote is in the history of
+// HEAD, and that the remote holds no new tag at another commit.
+func (r releaseTags) checkPushRemote(ctx context.Context, repo Repository, config Config, remote RemoteConfig) error {
+	if branch := remote.branch(config); branch != "" {
+		commit, err := repo.RemoteBranchCommit(ctx, remote.Name, branch)
+		if err != nil {
+			return err
+		}
+		if commit != "" {
+			contains, err := repo.Contains(ctx, commit)
+			if err != nil {
+				return err
+			}
+			if !contains {
+				return &DivergedBranchError{Remote: remote.Name, Branch: branch, RemoteCommit: commit}
+			}
+		}
+	}
+	return r.checkRemote(ctx, repo, remote.Name, nil)
+}
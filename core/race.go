@@ -0,0 +1,136 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/catalystcommunity/app-utils-go/logging"
+)
+
+// TagRaceError is the error of a release whose version tags another run
+// pushed first, at another commit. Two runs on consecutive commits can both
+// work out the same next version, and only one of them can push it.
+type TagRaceError struct {
+	Remote string
+	// Tags holds the new tags that the remote holds at another commit.
+	Tags []string
+	// Err is the error of the rejected push. It is nil when a check before
+	// the push found the tags.
+	Err error
+}
+
+func (e *TagRaceError) Error() string {
+	message := fmt.Sprintf("another release pushed %s to %s first", strings.Join(e.Tags, ", "), e.Remote)
+	if e.Err != nil {
+		message += ": " + e.Err.Error()
+	}
+	return message
+}
+
+func (e *TagRaceError) Unwrap() error {
+	return e.Err
+}
+
+// fetchTags replaces the local tags with the tags of the remote, so the run
+// builds on the releases that other runs pushed.
+func (t *tagger) fetchTags(ctx context.Context) error {
+	remote := t.config.primaryRemote()
+	logging.Log.Info(fmt.Sprintf("Fetching every tag from %s", remote))
+	return t.repo.Fetch(ctx, remote, FetchOptions{Tags: true, Force: true})
+}
+
+// checksRemote tells if a run asks the primary remote for its new tags before
+// and after the push.
+func (c Config) checksRemote() bool {
+	return c.FetchTags || c.PushRetries > 0
+}
+
+// releaseTags is every tag that one attempt of a run makes.
+type releaseTags struct {
+	// targets maps the index of each released target to its new tag.
+	targets map[int]string
+	// commits maps each new tag to its commit.
+	commits   map[string]string
+	newTags   []string
+	shortTags []string
+	// changes holds every local tag that the attempt makes or moves.
+	changes []tagChange
+}
+
+// tagChange is one local tag that a release makes, or moves for a short
+// version tag.
+type tagChange struct {
+	tag     string
+	commit  string
+	options TagOptions
+	short   bool
+}
+
+// lostRace tells if the error is a TagRaceError of the primary remote that
+// the run can retry. It logs the retry and records the lost tags of each
+// target.
+func (r releaseTags) lostRace(err error, config Config, attempt int, lostTags map[int][]string) bool {
+	var race *TagRaceError
+	if !errors.As(err, &race) || race.Remote != config.primaryRemote() || attempt >= config.PushRetries {
+		return false
+	}
+	logging.Log.Warn(fmt.Sprintf(
+		"%s; fetching the tags and working out the versions again, retry %d of %d",
+		race.Error(), attempt+1, config.PushRetries,
+	))
+	for idx, tag := range r.targets {
+		if slices.Contains(race.Tags, tag) {
+			lostTags[idx] = append(lostTags[idx], tag)
+		}
+	}
+	return true
+}
+
+// push sends the tags of one attempt to the primary remote and then to each
+// mirror. A run that checks the remote asks the primary remote for the new
+// tags just before the push, and again when the push fails, so a tag that
+// another run pushed first gives a TagRaceError. The error is the error of
+// the primary push; the result of each push is in the list.
+func (r releaseTags) push(ctx context.Context, repo Repository, config Config) ([]remotePush, error) {
+	primary := config.pushRemotes()[0]
+	if config.checksRemote() {
+		if err := r.checkRemote(ctx, repo, primary.Name, nil); err != nil {
+			return nil, err
+		}
+	}
+	err := primary.push(ctx, repo, config, r.newTags, r.shortTags)
+	if err != nil && config.checksRemote() {
+		// The remote can not tell why it rejected the push, so a failed check
+		// keeps the error of the push.
+		if raceErr, ok := r.checkRemote(ctx, repo, primary.Name, err).(*TagRaceError); ok {
+			return nil, raceErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	pushes := []remotePush{{remote: primary.Name}}
+	return append(pushes, pushMirrors(ctx, repo, config, r.newTags, r.shortTags)...), nil
+}
+
+// checkRemote gives a TagRaceError when the remote holds one of the new tags
+// at another commit. A tag at the same commit is no conflict.
+func (r releaseTags) checkRemote(ctx context.Context, repo Repository, remote string, pushErr error) error {
+	remoteCommits, err := repo.RemoteTagCommits(ctx, remote, r.newTags)
+	if err != nil {
+		return err
+	}
+	var taken []string
+	for _, tag := range r.newTags {
+		if commit, found := remoteCommits[tag]; found && commit != r.commits[tag] {
+			taken = append(taken, tag)
+		}
+	}
+	if len(taken) > 0 {
+		return &TagRaceError{Remote: remote, Tags: taken, Err: pushErr}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package core
+
+import "strings"
+
+// validRefName tells if git accepts a full ref name, with the rules of git
+// check-ref-format. It runs without a git binary, so any Repository can use
+// it.
+func validRefName(name string) bool {
+	if name == "" || name == "@" ||
+		strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") ||
+		strings.HasSuffix(name, ".") ||
+		strings.Contains(name, "..") || strings.Contains(name, "@{") {
+		return false
+	}
+	// A ref needs a category, such as refs/tags, before its last component.
+	if !strings.Contains(name, "/") {
+		return false
+	}
+	for _, character := range name {
+		if character < 0x20 || character == 0x7f || strings.ContainsRune(" ~^:?*[\\", character) {
+			return false
+		}
+	}
+	for _, component := range strings.Split(name, "/") {
+		if component == "" || strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return false
+		}
+	}
+	return true
+}
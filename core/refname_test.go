@@ -0,0 +1,38 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidRefNameFollowsCheckRefFormat(t *testing.T) {
+	cases := map[string]bool{
+		"refs/tags/v1.2.3":              true,
+		"refs/tags/api/v1.2.3-rc.1+b.5": true,
+		"refs/tags/release-1.2.3":       true,
+		"v1.2.3":                        false,
+		"refs/tags/":                    false,
+		"/refs/tags/v1":                 false,
+		"refs//tags/v1":                 false,
+		"refs/tags/v1.":                 false,
+		"refs/tags/.v1":                 false,
+		"refs/tags/v1.lock":             false,
+		"refs/tags/v1..2":               false,
+		"refs/tags/v1@{2}":              false,
+		"refs/tags/v 1":                 false,
+		"refs/tags/v~1":                 false,
+		"refs/tags/v^1":                 false,
+		"refs/tags/v:1":                 false,
+		"refs/tags/v?1":                 false,
+		"refs/tags/v*1":                 false,
+		"refs/tags/v[1":                 false,
+		"refs/tags/v\\1":                false,
+		"refs/tags/v\x011":              false,
+		"@":                             false,
+	}
+
+	for name, expected := range cases {
+		assert.Equal(t, expected, validRefName(name), name)
+	}
+}
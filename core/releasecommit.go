@@ -0,0 +1,386 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/catalystcommunity/app-utils-go/logging"
+)
+
+// ReleaseCommitPrefix starts the subject of every release commit.
+const ReleaseCommitPrefix = "chore(release): "
+
+// ReleaseCommitTrailer is the commit trailer that marks a release commit. The
+// analysis leaves out the commits with this trailer, so a release commit
+// never makes a release or shows in a changelog. A commit that only shares
+// the subject prefix still counts.
+const ReleaseCommitTrailer = "Release-Commit"
+
+// releaseCommitMarker is the value of the ReleaseCommitTrailer.
+const releaseCommitMarker = "semver-tags"
+
+// ChangelogFile is the file in the first path of each target that a release
+// commit adds the release notes to.
+const ChangelogFile = "CHANGELOG.md"
+
+// VersionFile is one file that holds the version of a target. The path is
+// relative to the first path of the target. Without a pattern, the file name
+// selects a built-in updater: package.json, Chart.yaml, Cargo.toml,
+// pyproject.toml, or VERSION.
+type VersionFile struct {
+	Path string `mapstructure:"path" yaml:"path"`
+	// Pattern is a regular expression whose first group is the version. A
+	// release replaces that group in every match.
+	Pattern string `mapstructure:"pattern" yaml:"pattern,omitempty"`
+}
+
+// versionUpdaters gives the built-in updater of each file name.
+var versionUpdaters = map[string]func(content []byte, version string) ([]byte, error){
+	"package.json": updateJsonVersion,
+	"Chart.yaml": func(content []byte, version string) ([]byte, error) {
+		return replaceVersionGroup(content, chartVersionPattern, version, false)
+	},
+	"Cargo.toml": func(content []byte, version string) ([]byte, error) {
+		return updateTomlVersion(content, version, "package", "workspace.package")
+	},
+	"pyproject.toml": func(content []byte, version string) ([]byte, error) {
+		return updateTomlVersion(content, version, "project", "tool.poetry")
+	},
+	"VERSION": updatePlainVersion,
+}
+
+var (
+	chartVersionPattern = regexp.MustCompile(`(?m)^version:[ \t]*["']?([^"'\s#]+)`)
+	tomlTablePattern    = regexp.MustCompile(`^\s*\[([^\[\]]+)\]\s*(#.*)?$`)
+	tomlVersionPattern  = regexp.MustCompile(`^\s*version\s*=\s*"([^"]*)"`)
+)
+
+// validateVersionFile checks that a release can update the file.
+func validateVersionFile(file VersionFile) error {
+	if file.Path == "" {
+		return errors.New("a version file must have a path")
+	}
+	if _, err := normalizeTargetPath(file.Path); err != nil {
+		return fmt.Errorf("version file: %w", err)
+	}
+	if file.Pattern != "" {
+		_, err := versionPattern(file.Pattern)
+		return err
+	}
+	if _, found := versionUpdaters[path.Base(file.Path)]; !found {
+		return fmt.Errorf("version file %q has no built-in updater, so it needs a pattern", file.Path)
+	}
+	return nil
+}
+
+func versionPattern(pattern string) (*regexp.Regexp, error) {
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("can not read the version pattern %q: %w", pattern, err)
+	}
+	if compiled.NumSubexp() < 1 {
+		return nil, fmt.Errorf("the version pattern %q needs a group that matches the version", pattern)
+	}
+	return compiled, nil
+}
+
+// updateVersionFile gives the content of one version file with the new
+// version.
+func updateVersionFile(file VersionFile, content []byte, version string) ([]byte, error) {
+	if file.Pattern != "" {
+		pattern, err := versionPattern(file.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		return replaceVersionGroup(content, pattern, version, true)
+	}
+	return versionUpdaters[path.Base(file.Path)](content, version)
+}
+
+// replaceVersionGroup replaces the first group of the first match, or of
+// every match with all.
+func replaceVersionGroup(content []byte, pattern *regexp.Regexp, version string, all bool) ([]byte, error) {
+	limit := 1
+	if all {
+		limit = -1
+	}
+	matches := pattern.FindAllSubmatchIndex(content, limit)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("the pattern %q does not match", pattern)
+	}
+	var updated bytes.Buffer
+	last := 0
+	for _, match := range matches {
+		updated.Write(content[last:match[2]])
+		updated.WriteString(version)
+		last = match[3]
+	}
+	updated.Write(content[last:])
+	return updated.Bytes(), nil
+}
+
+// updateJsonVersion replaces the top-level version of a JSON object, and
+// keeps the rest of the file as it is.
+func updateJsonVersion(content []byte, version string) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil, errors.New("the file is not a JSON object")
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("can not read the JSON object: %w", err)
+		}
+		if key != "version" {
+			var skipped json.RawMessage
+			if err := decoder.Decode(&skipped); err != nil {
+				return nil, fmt.Errorf("can not read the JSON object: %w", err)
+			}
+			continue
+		}
+		var current string
+		if err := decoder.Decode(&current); err != nil {
+			return nil, fmt.Errorf("the version is not a string: %w", err)
+		}
+		// A version has no escaped quote, so the value starts after the last
+		// quote before its closing quote.
+		end := int(decoder.InputOffset()) - 1
+		start := bytes.LastIndexByte(content[:end], '"') + 1
+		return slices.Concat(content[:start], []byte(version), content[end:]), nil
+	}
+	return nil, errors.New("the JSON object has no version")
+}
+
+// updateTomlVersion replaces the version key of the first of the tables that
+// the file has.
+func updateTomlVersion(content []byte, version string, tables ...string) ([]byte, error) {
+	lines := strings.SplitAfter(string(content), "\n")
+	table := ""
+	for idx, line := range lines {
+		if match := tomlTablePattern.FindStringSubmatch(line); match != nil {
+			table = strings.TrimSpace(match[1])
+			continue
+		}
+		if !slices.Contains(tables, table) {
+			continue
+		}
+		if match := tomlVersionPattern.FindStringSubmatchIndex(line); match != nil {
+			lines[idx] = line[:match[2]] + version + line[match[3]:]
+			return []byte(strings.Join(lines, "")), nil
+		}
+	}
+	return nil, fmt.Errorf("no version in the [%s] table", strings.Join(tables, "] or ["))
+}
+
+// updatePlainVersion replaces a file that holds only the version.
+func updatePlainVersion(content []byte, version string) ([]byte, error) {
+	trimmed := bytes.TrimRight(content, " \t\r\n")
+	return slices.Concat([]byte(version), content[len(trimmed):]), nil
+}
+
+// prependChangelog adds the release to the top of a changelog, below its
+// title. An empty changelog gets a title first.
+func prependChangelog(content []byte, packageName string, release ChangelogRelease, repoURL string) []byte {
+	var text strings.Builder
+	writeRelease(&text, release, repoURL)
+	title, rest := changelogTitle(packageName), string(content)
+	if strings.HasPrefix(rest, "# ") {
+		title, rest, _ = strings.Cut(rest, "\n")
+		title += "\n"
+	}
+	rest = strings.TrimLeft(rest, "\n")
+	if rest == "" {
+		return []byte(title + "\n" + text.String())
+	}
+	return []byte(title + "\n" + text.String() + "\n" + rest)
+}
+
+// validateReleaseCommit checks the release commit settings of a run.
+func validateReleaseCommit(config Config) error {
+	for _, file := range config.VersionFiles {
+		if err := validateVersionFile(file); err != nil {
+			return err
+		}
+	}
+	if !config.ReleaseCommit || config.DryRun {
+		return nil
+	}
+	if config.Branch == "" {
+		return errors.New("a release commit needs a branch to push")
+	}
+	if !config.Atomic {
+		return errors.New("a release commit pushes the branch and the tags atomically, so atomic must be true")
+	}
+	return nil
+}
+
+// releaseFiles gives the version files and changelogs of every target with
+// a new tag, with the new version in each.
+func releaseFiles(ctx context.Context, repo Repository, config Config, results []DirectoryVersionInfo, release releaseTags) (map[string][]byte, error) {
+	rules, err := newBumpRules(config)
+	if err != nil {
+		return nil, err
+	}
+	now := config.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	files := map[string][]byte{}
+	// read gives a file that an earlier target updated, such as a shared
+	// changelog, or else the file of the work tree.
+	read := func(name string) ([]byte, error) {
+		if content, found := files[name]; found {
+			return content, nil
+		}
+		return repo.ReadFile(ctx, name)
+	}
+	for idx, result := range results {
+		tag, found := release.targets[idx]
+		if !found || result.AlreadyReleased {
+			continue
+		}
+		home := result.home()
+		version := strings.TrimPrefix(result.NextVersion.Version.FormattedString(), "v")
+
+		versionFiles := result.VersionFiles
+		if len(versionFiles) == 0 {
+			versionFiles = config.VersionFiles
+		}
+		for _, file := range versionFiles {
+			name := path.Join(home, file.Path)
+			content, err := read(name)
+			if err != nil {
+				return nil, fmt.Errorf("target %q: %w", result.PackageName(), err)
+			}
+			if files[name], err = updateVersionFile(file, content, version); err != nil {
+				return nil, fmt.Errorf("target %q: version file %s: %w", result.PackageName(), name, err)
+			}
+		}
+
+		name := path.Join(home, ChangelogFile)
+		content, err := read(name)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		notes := ChangelogRelease{
+			Tag:      tag,
+			Version:  version,
+			Date:     now,
+			Sections: changelogSections(result.commits, rules),
+		}
+		if !result.LastVersion.initial {
+			if notes.PreviousTag, err = tagFor(result.LastVersion); err != nil {
+				return nil, err
+			}
+		}
+		files[name] = prependChangelog(content, result.PackageName(), notes, strings.TrimSuffix(config.RepoURL, "/"))
+	}
+	return files, nil
+}
+
+// releaseCommitMessage names the new version of every target with a new
+// tag, such as "chore(release): api v1.3.0", and ends with the
+// ReleaseCommitTrailer.
+func releaseCommitMessage(results []DirectoryVersionInfo, release releaseTags) string {
+	var names []string
+	for idx, result := range results {
+		if _, found := release.targets[idx]; !found || result.AlreadyReleased {
+			continue
+		}
+		name := result.NextVersion.Version.FormattedString()
+		if result.PackageName() != "" {
+			name = result.PackageName() + " " + name
+		}
+		names = append(names, name)
+	}
+	return fmt.Sprintf("%s%s\n\n%s: %s", ReleaseCommitPrefix, strings.Join(names, ", "), ReleaseCommitTrailer, releaseCommitMarker)
+}
+
+// commitRelease makes the release commit of a run and points the new tags
+// at it. The journal records the commit before it, so a failed run can put
+// the branch back. A dry run only logs the files it would commit.
+func commitRelease(
+	ctx context.Context,
+	repo Repository,
+	config Config,
+	journal *tagJournal,
+	results []DirectoryVersionInfo,
+	release *releaseTags,
+) error {
+	if len(release.changes) == 0 {
+		return nil
+	}
+	files, err := releaseFiles(ctx, repo, config, results, *release)
+	if err != nil {
+		return err
+	}
+	message := releaseCommitMessage(results, *release)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	if config.DryRun {
+		logging.Log.Info(fmt.Sprintf("We would be committing %s: %s", strings.Join(names, ", "), message))
+		return nil
+	}
+
+	head := release.changes[0].commit
+	logging.Log.Info(fmt.Sprintf("Committing %s: %s", strings.Join(names, ", "), message))
+	commit, err := repo.CommitFiles(ctx, config.Branch, message, files)
+	if err != nil {
+		return err
+	}
+	journal.recordCommit(config.Branch, head)
+
+	for idx := range release.changes {
+		release.changes[idx].commit = commit
+	}
+	for tag := range release.commits {
+		release.commits[tag] = commit
+	}
+	for idx := range release.targets {
+		if !results[idx].AlreadyReleased {
+			results[idx].NextVersion.CommitHash = commit
+		}
+	}
+	return nil
+}
+
+// writeWorkTreeFiles writes files below the root of a work tree, and gives
+// their paths in order.
+func writeWorkTreeFiles(root string, files map[string][]byte) ([]string, error) {
+	paths := make([]string, 0, len(files))
+	for name, content := range files {
+		target := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return nil, fmt.Errorf("can not write %s: %w", name, err)
+		}
+		if err := os.WriteFile(target, content, 0o644); err != nil {
+			return nil, fmt.Errorf("can not write %s: %w", name, err)
+		}
+		paths = append(paths, name)
+	}
+	slices.Sort(paths)
+	return paths, nil
+}
+
+// isReleaseCommit tells if the trailers of a commit mark it as a release
+// commit of this tool.
+func isReleaseCommit(commit Commit) bool {
+	return slices.ContainsFunc(commitTrailers(commit.Message), func(trailer commitTrailer) bool {
+		return strings.EqualFold(trailer.key, ReleaseCommitTrailer) && trailer.value == releaseCommitMarker
+	})
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/catalystcommunity/semver-tags/core/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuiltInVersionFilesKeepTheirLayout(t *testing.T) {
+	for _, test := range []struct {
+		path     string
+		content  string
+		expected string
+	}{
+		{
+			path:     "package.json",
+			content:  "{\n  \"name\": \"api\",\n  \"config\": {\"version\": \"9\"},\n  \"version\": \"1.2.0\"\n}\n",
+			expected: "{\n  \"name\": \"api\",\n  \"config\": {\"version\": \"9\"},\n  \"version\": \"1.3.0\"\n}\n",
+		},
+		{
+			path:     "Chart.yaml",
+			content:  "apiVersion: v2\nname: api\nversion: 1.2.0 # the chart\nappVersion: \"1.2.0\"\n",
+			expected: "apiVersion: v2\nname: api\nversion: 1.3.0 # the chart\nappVersion: \"1.2.0\"\n",
+		},
+		{
+			path:     "Cargo.toml",
+			content:  "[package]\nname = \"api\"\nversion = \"1.2.0\"\n\n[dependencies]\nserde = { version = \"1\" }\n",
+			expected: "[package]\nname = \"api\"\nversion = \"1.3.0\"\n\n[dependencies]\nserde = { version = \"1\" }\n",
+		},
+		{
+			path:     "pyproject.toml",
+			content:  "[build-system]\nrequires = [\"hatchling\"]\n\n[project]\nname = \"api\"\nversion = \"1.2.0\"\n",
+			expected: "[build-system]\nrequires = [\"hatchling\"]\n\n[project]\nname = \"api\"\nversion = \"1.3.0\"\n",
+		},
+		{path: "VERSION", content: "1.2.0\n", expected: "1.3.0\n"},
+	} {
+		t.Run(test.path, func(t *testing.T) {
+			file := VersionFile{Path: test.path}
+			require.NoError(t, validateVersionFile(file))
+
+			updated, err := updateVersionFile(file, []byte(test.content), "1.3.0")
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, string(updated))
+		})
+	}
+}
+
+func TestPatternVersionFileReplacesEveryMatch(t *testing.T) {
+	file := VersionFile{Path: "src/version.go", Pattern: `Version = "([^"]+)"`}
+	require.NoError(t, validateVersionFile(file))
+
+	updated, err := updateVersionFile(file, []byte("const Version = \"1.2.0\"\nconst Other = 1\n"), "1.3.0-rc.1")
+
+	require.NoError(t, err)
+	assert.Equal(t, "const Version = \"1.3.0-rc.1\"\nconst Other = 1\n", string(updated))
+
+	_, err = updateVersionFile(file, []byte("package version\n"), "1.3.0")
+	assert.ErrorContains(t, err, "does not match")
+}
+
+func TestVersionFilesNeedAnUpdater(t *testing.T) {
+	assert.ErrorContains(t, validateVersionFile(VersionFile{Path: "setup.cfg"}), "needs a pattern")
+	assert.ErrorContains(t, validateVersionFile(VersionFile{Path: "VERSION", Pattern: "v.*"}), "needs a group")
+	assert.Error(t, validateVersionFile(VersionFile{Path: "../VERSION"}))
+
+	_, err := updateVersionFile(VersionFile{Path: "pyproject.toml"}, []byte("[project]\ndynamic = [\"version\"]\n"), "1.3.0")
+	assert.ErrorContains(t, err, "no version in the [project] or [tool.poetry] table")
+}
+
+func TestPrependChangelogKeepsTheTitle(t *testing.T) {
+	release := ChangelogRelease{Version: "1.1.0", Tag: "api/v1.1.0", Sections: []ChangelogSection{
+		{Title: "Features", Entries: []ChangelogEntry{{Hash: "abcdef1234", Description: "add it"}}},
+	}}
+
+	assert.Equal(
+		t,
+		"# api Changelog\n\n## 1.1.0\n\n### Features\n\n- add it (abcdef1)\n",
+		string(prependChangelog(nil, "api", release, "")),
+	)
+	assert.Equal(
+		t,
+		"# Our Changes\n\n## 1.1.0\n\n### Features\n\n- add it (abcdef1)\n\n## 1.0.0\n\nFirst.\n",
+		string(prependChangelog([]byte("# Our Changes\n\n## 1.0.0\n\nFirst.\n"), "api", release, "")),
+	)
+}
+
+func TestIsReleaseCommitReadsTheTrailer(t *testing.T) {
+	message := releaseCommitMessage(
+		[]DirectoryVersionInfo{{Package: "api", NextVersion: &VersionInfo{Version: semver.NewSemver(1, 3, 0)}}},
+		releaseTags{targets: map[int]string{0: "api/v1.3.0"}},
+	)
+
+	assert.Equal(t, "chore(release): api v1.3.0\n\nRelease-Commit: semver-tags", message)
+	assert.True(t, isReleaseCommit(Commit{Subject: "chore(release): api v1.3.0", Message: message}))
+	assert.False(t, isReleaseCommit(Commit{Subject: "chore(release): api v1.3.0", Message: "chore(release): api v1.3.0"}))
+	assert.False(t, isReleaseCommit(Commit{Subject: "fix: it", Message: "fix: it\n\nRelease-Commit: someone else"}))
+}
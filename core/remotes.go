@@ -0,0 +1,141 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/catalystcommunity/app-utils-go/logging"
+)
+
+// Mirror failure policies. A mirror is every remote after the first.
+const (
+	// MirrorFailureFail makes a failed push to a mirror fail the run. It is
+	// the default.
+	MirrorFailureFail = "fail"
+	// MirrorFailureWarn makes a failed push to a mirror only log a warning.
+	MirrorFailureWarn = "warn"
+)
+
+// RemoteConfig is one remote that a run pushes to. A nil option uses the
+// setting of the run.
+type RemoteConfig struct {
+	Name string `mapstructure:"name" yaml:"name"`
+	// Atomic makes the remote take the branch and all of the tags, or none
+	// of them. A nil value uses Config.Atomic.
+	Atomic *bool `mapstructure:"atomic" yaml:"atomic,omitempty"`
+	// PushBranch pushes Config.Branch with the tags. A nil value pushes it.
+	PushBranch *bool `mapstructure:"push_branch" yaml:"push_branch,omitempty"`
+	// ShortTags pushes the short version tags. A nil value pushes them.
+	ShortTags *bool `mapstructure:"short_tags" yaml:"short_tags,omitempty"`
+}
+
+// pushRemotes gives every remote of a run, the primary remote first. Without
+// Remotes, the run pushes only to Remote.
+func (c Config) pushRemotes() []RemoteConfig {
+	if len(c.Remotes) == 0 {
+		return []RemoteConfig{{Name: c.Remote}}
+	}
+	return c.Remotes
+}
+
+// primaryRemote gives the remote that a run fetches from and checks for
+// tags that other runs pushed.
+func (c Config) primaryRemote() string {
+	return c.pushRemotes()[0].Name
+}
+
+// validateRemotes checks the remote list and the mirror failure policy.
+func validateRemotes(config Config) error {
+	switch config.MirrorFailure {
+	case "", MirrorFailureFail, MirrorFailureWarn:
+	default:
+		return fmt.Errorf("mirror_failure %q is not %q or %q", config.MirrorFailure, MirrorFailureFail, MirrorFailureWarn)
+	}
+	seen := map[string]bool{}
+	for _, remote := range config.Remotes {
+		if strings.TrimSpace(remote.Name) == "" {
+			return errors.New("every remote needs a name")
+		}
+		if seen[remote.Name] {
+			return fmt.Errorf("remote %q is listed more than one time", remote.Name)
+		}
+		seen[remote.Name] = true
+	}
+	return nil
+}
+
+// push sends the tags to this remote with its options.
+func (r RemoteConfig) push(ctx context.Context, repo Repository, config Config, tags []string, shortTags []string) error {
+	atomic := config.Atomic
+	if r.Atomic != nil {
+		atomic = *r.Atomic
+	}
+	if r.ShortTags != nil && !*r.ShortTags {
+		shortTags = nil
+	}
+	return repo.PushTags(ctx, r.Name, r.branch(config), atomic, tags, shortTags)
+}
+
+// branch gives the branch that a push to this remote sends, or "" for only
+// the tags.
+func (r RemoteConfig) branch(config Config) string {
+	if r.PushBranch != nil && !*r.PushBranch {
+		return ""
+	}
+	return config.Branch
+}
+
+// remotePush is the result of the push to one remote.
+type remotePush struct {
+	remote string
+	err    error
+}
+
+// pushMirrors sends the tags to every remote after the primary remote. A
+// failed push does not stop the pushes to the other mirrors.
+func pushMirrors(ctx context.Context, repo Repository, config Config, tags []string, shortTags []string) []remotePush {
+	var pushes []remotePush
+	for _, remote := range config.pushRemotes()[1:] {
+		err := remote.push(ctx, repo, config, tags, shortTags)
+		if err != nil {
+			logging.Log.WithError(err).Warn(fmt.Sprintf("Push to the mirror %s failed", remote.Name))
+		}
+		pushes = append(pushes, remotePush{remote: remote.Name, err: err})
+	}
+	return pushes
+}
+
+// mirrorError gives the error of the failed mirror pushes when the mirror
+// failure policy fails the run.
+func mirrorError(config Config, pushes []remotePush) error {
+	if config.MirrorFailure == MirrorFailureWarn {
+		return nil
+	}
+	var errs []error
+	for _, push := range pushes {
+		if push.err != nil {
+			errs = append(errs, fmt.Errorf("can not push to the mirror %s: %w", push.remote, push.err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// remotePushesOutput gives the result of each push, such as
+// "origin=pushed,backup=failed". It is empty for a run without Remotes, so
+// that run keeps the same outputs.
+func remotePushesOutput(config Config, pushes []remotePush) string {
+	if len(config.Remotes) == 0 {
+		return ""
+	}
+	values := make([]string, 0, len(pushes))
+	for _, push := range pushes {
+		result := "pushed"
+		if push.err != nil {
+			result = "failed"
+		}
+		values = append(values, push.remote+"="+result)
+	}
+	return strings.Join(values, ",")
+}
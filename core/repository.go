@@ -0,0 +1,177 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Repository is every git operation that a run needs. GitRepository, which
+// runs the git command, is the default. Another implementation lets a Go
+// program or a test run semver-tags without a work tree. Each method stops
+// when its context ends, and a run can call the methods from more than one
+// goroutine at a time.
+type Repository interface {
+	// Root gives the top directory of the work tree. It fails when the
+	// repository does not exist.
+	Root(ctx context.Context) (string, error)
+	// Head gives the full hash of the commit that new tags point at.
+	Head(ctx context.Context) (string, error)
+	// ShortCommit gives the unique abbreviation of one commit.
+	ShortCommit(ctx context.Context, commit string) (string, error)
+	// CurrentBranch gives the checked-out branch, or "HEAD" when HEAD is
+	// detached.
+	CurrentBranch(ctx context.Context) (string, error)
+	// BranchCommit gives the commit at the tip of one local branch. It is
+	// empty when the branch does not exist.
+	BranchCommit(ctx context.Context, branch string) (string, error)
+	// Changes gives the paths of the work tree that differ from HEAD,
+	// untracked files included. Ignored files are not changes.
+	Changes(ctx context.Context) ([]string, error)
+	// ReadFile gives one file of the work tree. The path is relative to the
+	// top directory. A missing file gives an error that wraps fs.ErrNotExist.
+	ReadFile(ctx context.Context, path string) ([]byte, error)
+	// CommitFiles writes the files into the work tree, with paths relative
+	// to the top directory, and commits only them on HEAD. It moves the
+	// branch to the new commit too, because a checkout can detach HEAD at the
+	// tip of the branch. It gives the new commit.
+	CommitFiles(ctx context.Context, branch string, message string, files map[string][]byte) (string, error)
+	// ResetBranch moves HEAD and the branch back to the commit, and gives the
+	// files that changed since then their content at that commit. It undoes
+	// CommitFiles.
+	ResetBranch(ctx context.Context, branch string, commit string) error
+	// CommitTime gives the committer date of one commit in UTC.
+	CommitTime(ctx context.Context, commit string) (time.Time, error)
+	// FirstCommit gives a commit of HEAD that has no parent.
+	FirstCommit(ctx context.Context) (string, error)
+	// Shallow tells if the repository is a shallow clone, whose history stops
+	// before the first commit.
+	Shallow(ctx context.Context) (bool, error)
+	// Contains tells if the history of HEAD holds the commit. In a shallow
+	// clone, a commit behind the shallow boundary is not in the history, and
+	// neither is a commit that the repository does not hold.
+	Contains(ctx context.Context, commit string) (bool, error)
+	// Fetch reads tags and history from the remote.
+	Fetch(ctx context.Context, remote string, options FetchOptions) error
+	// RemoteTagCommits gives the commit that each of the given tags points
+	// at on the remote. A tag that the remote does not hold is not in the
+	// map. An annotated tag gives the commit it points at.
+	RemoteTagCommits(ctx context.Context, remote string, tags []string) (map[string]string, error)
+	// RemoteBranchCommit gives the commit at the tip of one branch of the
+	// remote. It is empty when the remote does not hold the branch.
+	RemoteBranchCommit(ctx context.Context, remote string, branch string) (string, error)
+	// CommitCount gives the number of commits of HEAD after the given commit.
+	CommitCount(ctx context.Context, afterCommit string) (int, error)
+	// Tags gives every tag. An annotated tag gives the commit it points at.
+	Tags(ctx context.Context) ([]TagRef, error)
+	// Commits gives the commits of HEAD after the given commit that changed
+	// one of the paths, newest first. The paths are git pathspecs. With
+	// trusted signers, each commit also gives its signature state.
+	Commits(ctx context.Context, afterCommit string, paths []string, trustedSigners string) ([]Commit, error)
+	// TagTrust checks the signature of one tag against the trusted signers.
+	TagTrust(ctx context.Context, tag string, trustedSigners string) (TagTrust, error)
+	// SigningKey checks that the repository can sign tags and gives the key
+	// that signs them.
+	SigningKey(ctx context.Context) (string, error)
+	// TagSigner gives the key that signed one tag. It is empty when the tag
+	// is not signed, or the backend can not tell the key of its signature.
+	TagSigner(ctx context.Context, tag string) (string, error)
+	// CreateTag makes one local tag at the given commit. It fails when the
+	// tag exists.
+	CreateTag(ctx context.Context, tag string, commit string, options TagOptions) error
+	// UpdateTag makes one local tag at the given commit, or moves it there.
+	UpdateTag(ctx context.Context, tag string, commit string, options TagOptions) error
+	// TagObject gives the object that one local tag points at, which is a
+	// tag object for an annotated tag. It is empty when the tag does not
+	// exist.
+	TagObject(ctx context.Context, tag string) (string, error)
+	// RestoreTag points one local tag at an object that TagObject gave. An
+	// empty object removes the tag.
+	RestoreTag(ctx context.Context, tag string, object string) error
+	// PushTags sends the tags to the remote. An empty branch pushes only the
+	// tags. Atomic makes the remote take all of the refs or none. The force
+	// tags replace the remote tags of the same name.
+	PushTags(ctx context.Context, remote string, branch string, atomic bool, tags []string, forceTags []string) error
+}
+
+// HistoryReader is a Repository that can read the history of every target in
+// one pass. A run with more than one target reads the commits of each target
+// from this history. A Repository without it gives the commits of each target
+// from Commits.
+type HistoryReader interface {
+	// History gives the commits of HEAD after the given commits, newest
+	// first, with the files that each commit changed. It leaves out only the
+	// history that every given commit holds. With trusted signers, each
+	// commit also gives its signature state.
+	History(ctx context.Context, afterCommits []string, trustedSigners string) (History, error)
+}
+
+// History is the history of HEAD that a run needs.
+type History struct {
+	// Commits holds the commits, newest first.
+	Commits []HistoryCommit
+	// Boundary holds the commits whose history was left out. Each given
+	// commit holds the history of every boundary commit.
+	Boundary []string
+	// Dir is the absolute directory that relative pathspecs start from.
+	Dir string
+}
+
+// HistoryCommit is one commit of a History. Changes holds the files, relative
+// to the root, that differ from each parent, in the order of Parents. A commit
+// without a parent has one list, against the empty tree.
+type HistoryCommit struct {
+	Commit
+	Time    time.Time
+	Parents []string
+	Changes [][]string
+}
+
+// TagRef is one tag and the commit it points at.
+type TagRef struct {
+	Name   string
+	Commit string
+}
+
+// Commit is one commit of a release. Signature is the %G? state of git, and
+// it is empty when the signatures were not read.
+type Commit struct {
+	Hash      string
+	Subject   string
+	Message   string
+	Signature string
+}
+
+// FetchOptions selects what a fetch reads. Tags reads every tag of the
+// remote, and Force lets a remote tag replace a local tag of the same name.
+// Deepen reads that many more commits behind the shallow boundary. Unshallow
+// reads the full history.
+type FetchOptions struct {
+	Tags      bool
+	Force     bool
+	Deepen    int
+	Unshallow bool
+}
+
+// TagOptions selects the kind of tag to make. A message makes an annotated
+// tag. Sign makes a signed annotated tag.
+type TagOptions struct {
+	Message string
+	Sign    bool
+}
+
+// repository gives the repository of a run. Without one, the run uses the
+// selected backend in the current directory.
+func (c Config) repository() (Repository, error) {
+	if c.Repository != nil {
+		return c.Repository, nil
+	}
+	switch c.GitBackend {
+	case "", GitBackendExec:
+		return NewGitRepository(""), nil
+	case GitBackendNative:
+		return NewNativeRepository(""), nil
+	default:
+		return nil, fmt.Errorf("git backend %q is not %q or %q", c.GitBackend, GitBackendExec, GitBackendNative)
+	}
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/catalystcommunity/app-utils-go/logging"
+)
+
+// tagJournal records each local tag before a run changes it, so a run that
+// fails before its push can put every tag back. Without that, a rerun in the
+// same work tree would read the unpublished version as the last release. It
+// also records the branch before a release commit, so the rollback removes
+// that commit.
+type tagJournal struct {
+	repo Repository
+	// previous maps each changed tag to the object it pointed at. An empty
+	// object means that the tag did not exist.
+	previous map[string]string
+	// order holds the changed tags in the order of their first change.
+	order []string
+	// branch and base are the branch of a release commit and the commit
+	// before it. They are empty without a release commit.
+	branch string
+	base   string
+}
+
+func newTagJournal(repo Repository) *tagJournal {
+	return &tagJournal{repo: repo, previous: map[string]string{}}
+}
+
+// record reads the state of one tag before its first change.
+func (j *tagJournal) record(ctx context.Context, tag string) error {
+	if _, found := j.previous[tag]; found {
+		return nil
+	}
+	object, err := j.repo.TagObject(ctx, tag)
+	if err != nil {
+		return err
+	}
+	j.previous[tag] = object
+	j.order = append(j.order, tag)
+	return nil
+}
+
+// recordCommit records the commit that a branch pointed at before the
+// release commit.
+func (j *tagJournal) recordCommit(branch string, base string) {
+	j.branch, j.base = branch, base
+}
+
+// rollback puts every recorded tag back, the last change first, and forgets
+// the records. It runs even when ctx has ended, because a canceled run must
+// not leave its tags behind.
+func (j *tagJournal) rollback(ctx context.Context) error {
+	ctx = context.WithoutCancel(ctx)
+	var errs []error
+	if len(j.order) > 0 {
+		logging.Log.Info("Restoring the local tags that the run changed")
+	}
+	for idx := len(j.order) - 1; idx >= 0; idx-- {
+		tag := j.order[idx]
+		if err := j.repo.RestoreTag(ctx, tag, j.previous[tag]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if j.base != "" {
+		logging.Log.Info(fmt.Sprintf("Removing the release commit from %s", j.branch))
+		if err := j.repo.ResetBranch(ctx, j.branch, j.base); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	j.previous = map[string]string{}
+	j.order = nil
+	j.branch, j.base = "", ""
+	return errors.Join(errs...)
+}
+
+// fail rolls the tags back after the given error and gives that error. A
+// failed rollback adds its error.
+func (j *tagJournal) fail(ctx context.Context, err error) error {
+	if rollbackErr := j.rollback(ctx); rollbackErr != nil {
+		return fmt.Errorf("%w; can not restore the local tags: %w", err, rollbackErr)
+	}
+	return err
+}
@@ -0,0 +1,897 @@
+package core_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/catalystcommunity/semver-tags/core"
+	"github.com/catalystcommunity/semver-tags/core/gittest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newScenario gives a fake repository with one api release and one worker
+// release on the first commit.
+func newScenario() *gittest.Repository {
+	repo := gittest.New()
+	first := repo.Commit("feat: initial layout", "services/api/file.txt", "services/worker/file.txt")
+	repo.Tag("api/v1.0.0", first)
+	repo.Tag("worker/v2.0.0", first)
+	return repo
+}
+
+func analyze(t *testing.T, config core.Config) core.Outputs {
+	t.Helper()
+	results, err := core.AnalyzeReleases(context.Background(), config)
+	require.NoError(t, err)
+	outputs, err := core.GenerateOutputs(results, config.DryRun)
+	require.NoError(t, err)
+	return outputs
+}
+
+func TestScenarioReleasesOnlyChangedTargets(t *testing.T) {
+	repo := newScenario()
+	repo.Commit("feat: add an endpoint", "services/api/endpoint.txt")
+
+	outputs := analyze(t, core.Config{
+		Repository: repo,
+		Targets: []core.TargetConfig{
+			{Name: "api", Paths: []string{"services/api"}},
+			{Name: "worker", Paths: []string{"services/worker"}},
+		},
+	})
+
+	assert.Equal(t, "true,false", outputs.NewReleasePublished)
+	assert.Equal(t, "api/v1.1.0,worker/v2.0.0", outputs.NewReleaseGitTag)
+	assert.Equal(t, "feat: add an endpoint", outputs.NewReleaseNotes)
+}
+
+func TestScenarioTagsAndPushesThroughTheRepository(t *testing.T) {
+	repo := newScenario()
+	head := repo.Commit("fix: repair the worker", "services/worker/file.txt")
+
+	err := core.DoTagging(context.Background(), core.Config{
+		Repository:    repo,
+		Remote:        "origin",
+		Atomic:        true,
+		ShortVersions: true,
+		Annotate:      true,
+		Directories:   []string{"services/api", "services/worker"},
+	})
+
+	require.NoError(t, err)
+	commit, found := repo.TagCommit("worker/v2.0.1")
+	require.True(t, found)
+	assert.Equal(t, head, commit)
+	assert.Equal(t, "worker/v2.0.1\n\n- fix: repair the worker\n", repo.TagMessage("worker/v2.0.1"))
+	assert.Equal(t, []gittest.Push{{
+		Remote:    "origin",
+		Atomic:    true,
+		Tags:      []string{"worker/v2.0.1"},
+		ForceTags: []string{"worker/v2.0", "worker/v2"},
+	}}, repo.Pushes)
+	assert.Equal(t, map[string]string{
+		"worker/v2.0.1": head,
+		"worker/v2":     head,
+		"worker/v2.0":   head,
+	}, repo.RemoteTags("origin"))
+}
+
+func TestScenarioPushFailureLeavesTheRemoteUnchanged(t *testing.T) {
+	repo := newScenario()
+	repo.Commit("fix: repair the api", "services/api/file.txt")
+	repo.PushError = assert.AnError
+
+	err := core.DoTagging(context.Background(), core.Config{
+		Repository:        repo,
+		Remote:            "origin",
+		SkipShortVersions: true,
+		Directories:       []string{"services/api"},
+	})
+
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Empty(t, repo.RemoteTags("origin"))
+}
+
+func TestScenarioPushFailureRestoresTheLocalTags(t *testing.T) {
+	repo := newScenario()
+	first, _ := repo.TagCommit("api/v1.0.0")
+	repo.SignedTag("api/v1", first, core.TagTrusted)
+	repo.Commit("fix: repair the api", "services/api/file.txt")
+	repo.PushError = assert.AnError
+
+	err := core.DoTagging(context.Background(), core.Config{
+		Repository:    repo,
+		Remote:        "origin",
+		ShortVersions: true,
+		Directories:   []string{"services/api"},
+	})
+
+	require.ErrorIs(t, err, assert.AnError)
+	for _, tag := range []string{"api/v1.0.1", "api/v1.0"} {
+		_, found := repo.TagCommit(tag)
+		assert.False(t, found, tag)
+	}
+	commit, found := repo.TagCommit("api/v1")
+	require.True(t, found)
+	assert.Equal(t, first, commit)
+	assert.Equal(t, "api/v1", repo.TagMessage("api/v1"))
+}
+
+func TestScenarioSigningNeedsAKey(t *testing.T) {
+	repo := newScenario()
+	repo.Commit("fix: repair the api", "services/api/file.txt")
+
+	err := core.DoTagging(context.Background(), core.Config{
+		Repository:        repo,
+		Sign:              true,
+		SkipShortVersions: true,
+		Directories:       []string{"services/api"},
+	})
+
+	require.Error(t, err)
+	_, found := repo.TagCommit("api/v1.0.1")
+	assert.False(t, found)
+}
+
+func TestScenarioFirstReleaseStartsAtTheFirstCommit(t *testing.T) {
+	repo := gittest.New()
+	repo.Commit("chore: start")
+	repo.Commit("feat: first feature", "lib/file.txt")
+
+	outputs := analyze(t, core.Config{Repository: repo})
+
+	assert.Equal(t, "v0.2.0", outputs.NewReleaseGitTag)
+	assert.Equal(t, "v0.1.0", outputs.LastReleaseGitTag)
+}
+
+func TestScenarioTargetsWithDifferentLastVersionsShareOneHistory(t *testing.T) {
+	repo := newScenario()
+	repo.Commit("feat: add an endpoint", "services/api/endpoint.txt")
+	released := repo.Commit("fix: repair the api", "services/api/file.txt")
+	repo.Tag("api/v1.1.1", released)
+	repo.Commit("fix: repair the worker", "services/worker/file.txt")
+	repo.Commit("docs: describe the api", "services/api/README.md")
+
+	outputs := analyze(t, core.Config{
+		Repository: repo,
+		Targets: []core.TargetConfig{
+			{Name: "api", Paths: []string{"services/api"}},
+			{Name: "worker", Paths: []string{"services/worker"}},
+			{Name: "docs", Paths: []string{"services/api/README.md"}},
+		},
+	})
+
+	assert.Equal(t, "api/v1.1.2,worker/v2.0.1,docs/v0.1.1", outputs.NewReleaseGitTag)
+	assert.Equal(t, "docs: describe the api,\nfix: repair the worker,\ndocs: describe the api", outputs.NewReleaseNotes)
+}
+
+func TestScenarioDeepenDoublesEachFetchUntilTheLastVersionIsFound(t *testing.T) {
+	repo := newScenario()
+	for range 100 {
+		repo.Commit("chore: filler")
+	}
+	repo.Commit("fix: repair the api", "services/api/file.txt")
+	repo.Depth = 1
+
+	outputs := analyze(t, core.Config{
+		Repository:  repo,
+		Remote:      "origin",
+		Deepen:      true,
+		Directories: []string{"services/api", "services/worker"},
+	})
+
+	assert.Equal(t, "api/v1.0.1,worker/v2.0.0", outputs.NewReleaseGitTag)
+	assert.Equal(t, []core.FetchOptions{{Tags: true}, {Deepen: 64}, {Deepen: 128}}, repo.Fetches)
+}
+
+func TestScenarioDeepenFetchesEverythingForAnUntaggedTarget(t *testing.T) {
+	repo := newScenario()
+	repo.Commit("fix: repair the library", "libs/shared/file.txt")
+	repo.Commit("fix: repair the api", "services/api/file.txt")
+	repo.Depth = 1
+
+	outputs := analyze(t, core.Config{
+		Repository:  repo,
+		Remote:      "origin",
+		Deepen:      true,
+		Directories: []string{"services/api", "libs/shared"},
+	})
+
+	assert.Equal(t, "api/v1.0.1,shared/v0.1.1", outputs.NewReleaseGitTag)
+	assert.Equal(t, []core.FetchOptions{{Tags: true}, {Unshallow: true}}, repo.Fetches)
+}
+
+func TestScenarioShallowCloneIsAnErrorWithoutDeepen(t *testing.T) {
+	repo := newScenario()
+	repo.Commit("fix: repair the api", "services/api/file.txt")
+	repo.Depth = 1
+
+	_, err := core.AnalyzeReleases(context.Background(), core.Config{
+		Repository:  repo,
+		Directories: []string{"services/api"},
+	})
+
+	require.ErrorContains(t, err, "git fetch --unshallow --tags")
+	assert.Empty(t, repo.Fetches)
+}
+
+func TestScenarioPushRetriesBuildOnTheReleaseOfAnotherRun(t *testing.T) {
+	repo := newScenario()
+	other := repo.Commit("feat: add an endpoint", "services/api/endpoint.txt")
+	head := repo.Commit("fix: repair the api and the worker", "services/api/file.txt", "services/worker/file.txt")
+	repo.RemoteTag("origin", "api/v1.1.0", other)
+
+	err := core.DoTagging(context.Background(), core.Config{
+		Repository:        repo,
+		Remote:            "origin",
+		Atomic:            true,
+		SkipShortVersions: true,
+		PushRetries:       1,
+		Directories:       []string{"services/api", "services/worker"},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"api/v1.1.0":    other,
+		"api/v1.1.1":    head,
+		"worker/v2.0.1": head,
+	}, repo.RemoteTags("origin"))
+	assert.Equal(t, []gittest.Push{{
+		Remote: "origin",
+		Atomic: true,
+		Tags:   []string{"api/v1.1.1", "worker/v2.0.1"},
+	}}, repo.Pushes)
+	commit, found := repo.TagCommit("api/v1.1.0")
+	require.True(t, found)
+	assert.Equal(t, other, commit)
+}
+
+func TestScenarioLostPushRaceNamesTheTags(t *testing.T) {
+	repo := newScenario()
+	other := repo.Commit("feat: add an endpoint", "services/api/endpoint.txt")
+	repo.Commit("fix: repair the api", "services/api/file.txt")
+	repo.BeforePush = func() {
+		repo.RemoteTag("origin", "api/v1.1.0", other)
+	}
+
+	err := core.DoTagging(context.Background(), core.Config{
+		Repository:        repo,
+		Remote:            "origin",
+		Atomic:            true,
+		SkipShortVersions: true,
+		FetchTags:         true,
+		Directories:       []string{"services/api"},
+	})
+
+	var race *core.TagRaceError
+	require.ErrorAs(t, err, &race)
+	assert.Equal(t, "origin", race.Remote)
+	assert.Equal(t, []string{"api/v1.1.0"}, race.Tags)
+	require.Error(t, race.Err)
+	assert.Empty(t, repo.Pushes)
+}
+
+func TestScenarioRerunReportsTheReleaseAtHead(t *testing.T) {
+	repo := newScenario()
+	head := repo.Commit("fix: repair the api", "services/api/file.txt")
+	config := core.Config{
+		Repository:        repo,
+		Remote:            "origin",
+		Atomic:            true,
+		SkipShortVersions: true,
+		Directories:       []string{"services/api", "services/worker"},
+	}
+	first := analyze(t, config)
+	require.NoError(t, core.DoTagging(context.Background(), config))
+
+	rerun := analyze(t, config)
+
+	assert.Empty(t, first.NewReleaseAlreadyReleased)
+	assert.Equal(t, "true,false", rerun.NewReleaseAlreadyReleased)
+	assert.Equal(t, first.NewReleasePublished, rerun.NewReleasePublished)
+	assert.Equal(t, first.NewReleaseGitTag, rerun.NewReleaseGitTag)
+	assert.Equal(t, first.LastReleaseGitTag, rerun.LastReleaseGitTag)
+	assert.Equal(t, first.NewReleaseNotes, rerun.NewReleaseNotes)
+
+	require.NoError(t, core.DoTagging(context.Background(), config))
+	require.Len(t, repo.Pushes, 2)
+	assert.Equal(t, []string{"api/v1.0.1"}, repo.Pushes[1].Tags)
+	commit, found := repo.TagCommit("api/v1.0.1")
+	require.True(t, found)
+	assert.Equal(t, head, commit)
+}
+
+func TestScenarioRemotesUseTheirOwnPushOptions(t *testing.T) {
+	repo := newScenario()
+	repo.Commit("fix: repair the api", "services/api/file.txt")
+	disabled := false
+
+	err := core.DoTagging(context.Background(), core.Config{
+		Repository:    repo,
+		Branch:        "main",
+		Atomic:        true,
+		ShortVersions: true,
+		Remotes: []core.RemoteConfig{
+			{Name: "origin"},
+			{Name: "mirror", Atomic: &disabled, PushBranch: &disabled, ShortTags: &disabled},
+		},
+		Directories: []string{"services/api"},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []gittest.Push{
+		{
+			Remote:    "origin",
+			Branch:    "main",
+			Atomic:    true,
+			Tags:      []string{"api/v1.0.1"},
+			ForceTags: []string{"api/v1.0", "api/v1"},
+		},
+		{Remote: "mirror", Tags: []string{"api/v1.0.1"}},
+	}, repo.Pushes)
+}
+
+func TestScenarioMirrorFailurePolicy(t *testing.T) {
+	for _, test := range []struct {
+		policy string
+		fails  bool
+	}{
+		{policy: "", fails: true},
+		{policy: core.MirrorFailureFail, fails: true},
+		{policy: core.MirrorFailureWarn, fails: false},
+	} {
+		t.Run(test.policy, func(t *testing.T) {
+			repo := newScenario()
+			head := repo.Commit("fix: repair the api", "services/api/file.txt")
+			repo.RemotePushErrors = map[string]error{"mirror": assert.AnError}
+
+			err := core.DoTagging(context.Background(), core.Config{
+				Repository:        repo,
+				SkipShortVersions: true,
+				Remotes:           []core.RemoteConfig{{Name: "origin"}, {Name: "mirror"}, {Name: "backup"}},
+				MirrorFailure:     test.policy,
+				Directories:       []string{"services/api"},
+			})
+
+			if test.fails {
+				require.ErrorIs(t, err, assert.AnError)
+				assert.ErrorContains(t, err, "mirror")
+			} else {
+				require.NoError(t, err)
+			}
+			// The primary and the other mirror hold the release, so the
+			// local tag stays.
+			assert.Equal(t, map[string]string{"api/v1.0.1": head}, repo.RemoteTags("origin"))
+			assert.Equal(t, map[string]string{"api/v1.0.1": head}, repo.RemoteTags("backup"))
+			commit, found := repo.TagCommit("api/v1.0.1")
+			require.True(t, found)
+			assert.Equal(t, head, commit)
+		})
+	}
+}
+
+func TestScenarioPrimaryRemoteFailureSkipsTheMirrors(t *testing.T) {
+	repo := newScenario()
+	repo.Commit("fix: repair the api", "services/api/file.txt")
+	repo.RemotePushErrors = map[string]error{"origin": assert.AnError}
+
+	err := core.DoTagging(context.Background(), core.Config{
+		Repository:        repo,
+		SkipShortVersions: true,
+		Remotes:           []core.RemoteConfig{{Name: "origin"}, {Name: "mirror"}},
+		MirrorFailure:     core.MirrorFailureWarn,
+		Directories:       []string{"services/api"},
+	})
+
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Empty(t, repo.Pushes)
+	_, found := repo.TagCommit("api/v1.0.1")
+	assert.False(t, found)
+}
+
+func TestScenarioPreflightFindsTheTagOfAnotherRun(t *testing.T) {
+	repo := newScenario()
+	other := repo.Commit("fix: repair the api elsewhere", "services/api/other.txt")
+	repo.Commit("fix: repair the api", "services/api/file.txt")
+	repo.RemoteTag("origin", "api/v1.0.1", other)
+
+	err := core.DoTagging(context.Background(), core.Config{
+		Repository:        repo,
+		Remote:            "origin",
+		Branch:            "main",
+		SkipShortVersions: true,
+		Directories:       []string{"services/api"},
+	})
+
+	var race *core.TagRaceError
+	require.ErrorAs(t, err, &race)
+	assert.Equal(t, []string{"api/v1.0.1"}, race.Tags)
+	assert.NoError(t, race.Err)
+	assert.Empty(t, repo.Pushes)
+	_, found := repo.TagCommit("api/v1.0.1")
+	assert.False(t, found)
+}
+
+func TestScenarioPreflightChecksTheBranch(t *testing.T) {
+	repo := newScenario()
+	repo.Commit("fix: repair the api", "services/api/file.txt")
+	repo.Branch = "feature"
+
+	err := core.DoTagging(context.Background(), core.Config{
+		Repository:        repo,
+		Remote:            "origin",
+		Branch:            "main",
+		SkipShortVersions: true,
+		Directories:       []string{"services/api"},
+	})
+
+	var mismatch *core.BranchMismatchError
+	require.ErrorAs(t, err, &mismatch)
+	assert.Empty(t, mismatch.BranchCommit)
+	assert.Empty(t, repo.Pushes)
+
+	// A run that pushes only the tags does not check the branch.
+	err = core.DoTagging(context.Background(), core.Config{
+		Repository:        repo,
+		Remote:            "origin",
+		SkipShortVersions: true,
+		Directories:       []string{"services/api"},
+	})
+
+	require.NoError(t, err)
+	assert.Len(t, repo.Pushes, 1)
+}
+
+func TestScenarioPreflightChecksTheBranchOfEachRemote(t *testing.T) {
+	repo := newScenario()
+	head := repo.Commit("fix: repair the api", "services/api/file.txt")
+	// Another clone pushed a commit to the mirror that this clone does not hold.
+	repo.RemoteBranch("mirror", "main", "0123456789abcdef0123456789abcdef01234567")
+	config := core.Config{
+		Repository:        repo,
+		Branch:            "main",
+		SkipShortVersions: true,
+		Remotes:           []core.RemoteConfig{{Name: "origin"}, {Name: "mirror"}},
+		Directories:       []string{"services/api"},
+	}
+
+	err := core.DoTagging(context.Background(), config)
+
+	var diverged *core.DivergedBranchError
+	require.ErrorAs(t, err, &diverged)
+	assert.Equal(t, "mirror", diverged.Remote)
+	assert.Empty(t, repo.Pushes)
+
+	// With the warn policy, the check of a mirror only logs a warning.
+	config.MirrorFailure = core.MirrorFailureWarn
+	err = core.DoTagging(context.Background(), config)
+
+	require.NoError(t, err)
+	assert.Equal(t, head, repo.RemoteTags("origin")["api/v1.0.1"])
+	assert.Equal(t, head, repo.RemoteBranchTip("origin", "main"))
+}
+
+func TestScenarioRequireCleanNamesTheChanges(t *testing.T) {
+	repo := newScenario()
+	repo.Commit("fix: repair the api", "services/api/file.txt")
+	repo.WorkTreeChanges = []string{"services/api/notes.txt"}
+
+	err := core.DoTagging(context.Background(), core.Config{
+		Repository:        repo,
+		Remote:            "origin",
+		Branch:            "main",
+		RequireClean:      true,
+		SkipShortVersions: true,
+		Directories:       []string{"services/api"},
+	})
+
+	var dirty *core.DirtyWorkTreeError
+	require.ErrorAs(t, err, &dirty)
+	assert.Equal(t, []string{"services/api/notes.txt"}, dirty.Paths)
+	assert.Empty(t, repo.Pushes)
+}
+
+func TestScenarioFreezeBlocksEveryRelease(t *testing.T) {
+	repo := newScenario()
+	repo.Commit("fix: repair the api", "services/api/file.txt")
+	config := core.Config{
+		Repository:        repo,
+		Remote:            "origin",
+		SkipShortVersions: true,
+		Directories:       []string{"services/api", "services/worker"},
+		Policies: []core.PolicyConfig{{
+			Name:    "year-end",
+			Freezes: []core.FreezeWindow{{Start: "12-20", End: "01-03"}},
+		}},
+		Now: time.Date(2026, 12, 24, 12, 0, 0, 0, time.UTC),
+	}
+
+	outputs := analyze(t, config)
+	err := core.DoTagging(context.Background(), config)
+
+	assert.Equal(t, "false,false", outputs.NewReleasePublished)
+	assert.Equal(t, "block,none", outputs.NewReleasePolicy)
+	assert.Equal(t, "year-end", outputs.NewReleasePolicyRules)
+	var blocked *core.PolicyError
+	require.ErrorAs(t, err, &blocked)
+	assert.Equal(t, []core.BlockedRelease{{Package: "api", Rules: []string{"year-end"}}}, blocked.Releases)
+	assert.Empty(t, repo.Pushes)
+	_, found := repo.TagCommit("api/v1.0.1")
+	assert.False(t, found)
+
+	// After the freeze, the same run releases.
+	config.Now = time.Date(2027, 1, 4, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, core.DoTagging(context.Background(), config))
+	assert.Contains(t, repo.RemoteTags("origin"), "api/v1.0.1")
+}
+
+func TestScenarioPoliciesCapTheBumpOfSomeTargets(t *testing.T) {
+	repo := newScenario()
+	repo.Commit("feat!: replace the api", "services/api/file.txt")
+	repo.Commit("feat: schedule the worker", "services/worker/file.txt")
+	config := core.Config{
+		Repository:        repo,
+		Remote:            "origin",
+		SkipShortVersions: true,
+		Directories:       []string{"services/api", "services/worker"},
+		Policies: []core.PolicyConfig{
+			{Name: "no-major-on-main", Branches: []string{"main"}, MaxBump: core.BumpMinor},
+			{Name: "worker-fridays", Action: core.PolicyDryRun, Targets: []string{"worker"}, Weekdays: []string{"Friday"}, MaxBump: core.BumpPatch},
+			{Name: "api-notice", Action: core.PolicyWarn, Paths: []string{"services/api"}},
+		},
+		// A Friday.
+		Now: time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC),
+	}
+
+	outputs := analyze(t, config)
+	err := core.DoTagging(context.Background(), config)
+
+	assert.Equal(t, "false,true", outputs.NewReleasePublished)
+	assert.Equal(t, "false,true", outputs.DryRun)
+	assert.Equal(t, "block,dry_run", outputs.NewReleasePolicy)
+	assert.Equal(t, "no-major-on-main api-notice,worker-fridays", outputs.NewReleasePolicyRules)
+	require.ErrorAs(t, err, new(*core.PolicyError))
+	assert.Empty(t, repo.Pushes)
+
+	// On a Thursday, the minor worker release is not capped.
+	config.Now = config.Now.AddDate(0, 0, -1)
+	err = core.DoTagging(context.Background(), config)
+
+	require.ErrorAs(t, err, new(*core.PolicyError))
+	assert.Contains(t, repo.RemoteTags("origin"), "worker/v2.1.0")
+	assert.NotContains(t, repo.RemoteTags("origin"), "api/v2.0.0")
+}
+
+func TestScenarioPoliciesReadTheBranchOfADetachedHead(t *testing.T) {
+	repo := newScenario()
+	repo.Commit("feat!: replace the api", "services/api/file.txt")
+	repo.Branch = "HEAD"
+	config := core.Config{
+		Repository:  repo,
+		DryRun:      true,
+		Branch:      "main",
+		Directories: []string{"services/api"},
+		Policies: []core.PolicyConfig{
+			{Name: "no-major-on-main", Branches: []string{"main"}, MaxBump: core.BumpMinor, UnlessApproved: true},
+		},
+	}
+
+	// A detached HEAD releases the branch that the run pushes.
+	outputs := analyze(t, config)
+	assert.Equal(t, "block", outputs.NewReleasePolicy)
+
+	config.Branch = "release"
+	outputs = analyze(t, config)
+	assert.Empty(t, outputs.NewReleasePolicy)
+
+	// Without a branch, the rule applies.
+	config.Branch = ""
+	outputs = analyze(t, config)
+	assert.Equal(t, "block", outputs.NewReleasePolicy)
+
+	// An approval lifts the rule.
+	repo.Commit("docs: note the change\n\nBreaking-Approved-By: Jane Doe <jane@example.com>", "services/api/file.txt")
+	outputs = analyze(t, config)
+	assert.Empty(t, outputs.NewReleasePolicy)
+	assert.Equal(t, "api/v2.0.0", outputs.NewReleaseGitTag)
+}
+
+func TestScenarioBreakingChangesNeedAnApproval(t *testing.T) {
+	repo := newScenario()
+	breaking := repo.Commit("feat!: drop the v1 client", "services/api/file.txt")
+	repo.Commit("fix: repair the api", "services/api/file.txt")
+	config := core.Config{
+		Repository:        repo,
+		DryRun:            true,
+		BreakingApproval:  true,
+		BreakingApprovers: []string{"jane@example.com"},
+		Directories:       []string{"services/api", "services/worker"},
+	}
+
+	// The analysis reports the blocked target, and the run refuses it.
+	results, err := core.AnalyzeReleases(context.Background(), config)
+	require.NoError(t, err)
+	var unapproved *core.UnapprovedBreakingError
+	require.ErrorAs(t, results[0].Blocked, &unapproved)
+	assert.Equal(t, "api", unapproved.Package)
+	require.Len(t, unapproved.Commits, 1)
+	assert.Equal(t, breaking, unapproved.Commits[0].Hash)
+	assert.Equal(t, "v1.0.0", results[0].NextVersion.Version.FormattedString())
+	assert.False(t, results[0].ReleasePending())
+	assert.Nil(t, results[1].Blocked)
+	err = core.DoTagging(context.Background(), config)
+	require.ErrorAs(t, err, &unapproved)
+
+	// The status still lists every target.
+	statuses, err := core.Status(context.Background(), config)
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.Equal(t, core.BumpBlocked, statuses[0].Bump)
+	assert.Equal(t, "1.0.0", statuses[0].NextVersion)
+	assert.Equal(t, unapproved.Error(), statuses[0].Blocked)
+	assert.Equal(t, "none", statuses[1].Bump)
+
+	// The explanation names the block.
+	config.Explain = true
+	results, err = core.AnalyzeReleases(context.Background(), config)
+	require.NoError(t, err)
+	assert.Contains(t, results[0].Explanation.Bump, "; the version stays 1.0.0; the release is blocked: "+unapproved.Error())
+	config.Explain = false
+
+	// A later commit approves the breaking change before it.
+	repo.Commit("docs: note the removal\n\nBreaking-Approved-By: Jane Doe <jane@example.com>", "services/api/file.txt")
+	outputs := analyze(t, config)
+	assert.Equal(t, "api/v2.0.0,worker/v2.0.0", outputs.NewReleaseGitTag)
+
+	// An approver outside the list does not count.
+	config.BreakingApprovers = []string{"ops@example.com"}
+	err = core.DoTagging(context.Background(), config)
+	require.ErrorAs(t, err, &unapproved)
+}
+
+func TestScenarioStatusListsEveryTarget(t *testing.T) {
+	repo := newScenario()
+	repo.Commit("feat: add an endpoint", "services/api/endpoint.txt")
+	repo.Commit("chore: tidy the api", "services/api/file.txt")
+	repo.Commit("docs: describe the worker", "docs/worker.md")
+
+	statuses, err := core.Status(context.Background(), core.Config{
+		Repository:  repo,
+		FetchTags:   true,
+		Directories: []string{"services/api", "services/worker"},
+	})
+
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	tagged, _ := repo.TagCommit("api/v1.0.0")
+	assert.Equal(t, "api", statuses[0].Package)
+	assert.Equal(t, "1.0.0", statuses[0].Version)
+	assert.Equal(t, "api/v1.0.0", statuses[0].Tag)
+	assert.Equal(t, tagged, statuses[0].Commit)
+	require.NotNil(t, statuses[0].Date)
+	assert.Equal(t, 2, statuses[0].UnreleasedCommits)
+	assert.Equal(t, core.BumpMinor, statuses[0].Bump)
+	assert.Equal(t, "1.1.0", statuses[0].NextVersion)
+	assert.Equal(t, "api/v1.1.0", statuses[0].NextTag)
+	assert.Equal(t, "worker", statuses[1].Package)
+	assert.Equal(t, 0, statuses[1].UnreleasedCommits)
+	assert.Equal(t, "none", statuses[1].Bump)
+	assert.Equal(t, "worker/v2.0.0", statuses[1].NextTag)
+	// The status never fetches.
+	assert.Empty(t, repo.Fetches)
+}
+
+func TestScenarioExplainTracesEveryDecision(t *testing.T) {
+	repo := newScenario()
+	old := repo.Commit("fix: an old fix", "services/api/file.txt")
+	repo.Tag("api/v0.9.0", old)
+	breaking := repo.Commit("feat(api)!: drop the v1 client", "services/api/file.txt", "docs/api.md")
+	repo.Commit("wip", "docs/api.md")
+	config := core.Config{
+		Repository: repo,
+		DryRun:     true,
+		Explain:    true,
+		Targets: []core.TargetConfig{
+			{Name: "api", Paths: []string{"services/api", "docs"}},
+		},
+	}
+
+	results, err := core.AnalyzeReleases(context.Background(), config)
+
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	explanation := results[0].Explanation
+	require.NotNil(t, explanation)
+	assert.Equal(t, "api/v1.0.0", explanation.BaseTag)
+	assert.Equal(t, []core.IgnoredTag{
+		{Tag: "api/v0.9.0", Commit: old, Reason: "it is lower than the base"},
+	}, explanation.IgnoredTags)
+	require.Len(t, explanation.Commits, 3)
+	assert.Equal(t, "none", explanation.Commits[0].Level)
+	assert.Equal(t, []string{"docs"}, explanation.Commits[0].Paths)
+	assert.Equal(t, core.CommitExplanation{
+		Hash:     breaking,
+		Subject:  "feat(api)!: drop the v1 client",
+		Paths:    []string{"services/api", "docs"},
+		Type:     "feat",
+		Scope:    "api",
+		Breaking: "!",
+		Level:    core.BumpMajor,
+		Rule:     "a breaking marker makes a major release",
+	}, explanation.Commits[1])
+	assert.Contains(t, explanation.Bump, "1.0.0 -> 2.0.0")
+
+	var text strings.Builder
+	require.NoError(t, core.WriteExplanations(&text, results))
+	assert.Contains(t, text.String(), "target api\n  base: api/v1.0.0 at ")
+	assert.Contains(t, text.String(), "type=feat scope=api breaking=! paths=services/api,docs\n")
+
+	// Without Explain, the run does not explain.
+	config.Explain = false
+	results, err = core.AnalyzeReleases(context.Background(), config)
+	require.NoError(t, err)
+	assert.Nil(t, results[0].Explanation)
+}
+
+func TestScenarioChangelogGroupsEachRelease(t *testing.T) {
+	repo := newScenario()
+	feature := repo.Commit("feat(api): add an endpoint", "services/api/endpoint.txt")
+	repo.Commit("docs: describe the worker", "services/worker/file.txt")
+	repo.Commit("fix: repair the endpoint", "services/api/endpoint.txt")
+	repo.Tag("api/v1.1.0", repo.Commit("wip", "services/api/file.txt"))
+	breaking := repo.Commit("refactor!: rename the routes", "services/api/file.txt")
+	repo.Tag("api/v2.0.0", breaking)
+	repo.Commit("perf: cache the routes", "services/api/file.txt")
+	config := core.Config{Repository: repo, Directories: []string{"services/api", "services/worker"}}
+
+	changelogs, err := core.Changelogs(context.Background(), config, core.ChangelogOptions{
+		Targets:    []string{"api"},
+		Unreleased: true,
+	})
+
+	require.NoError(t, err)
+	require.Len(t, changelogs, 1)
+	releases := changelogs[0].Releases
+	require.Len(t, releases, 4)
+	assert.Equal(t, "", releases[0].Tag)
+	assert.Equal(t, "api/v2.0.0", releases[0].PreviousTag)
+	assert.Equal(t, "Performance Improvements", releases[0].Sections[0].Title)
+	assert.Equal(t, "api/v2.0.0", releases[1].Tag)
+	assert.Equal(t, []core.ChangelogSection{
+		{Title: "Breaking Changes", Entries: []core.ChangelogEntry{{Hash: breaking, Description: "rename the routes"}}},
+	}, releases[1].Sections)
+	assert.Equal(t, "1.1.0", releases[2].Version)
+	assert.Equal(t, "api/v1.0.0", releases[2].PreviousTag)
+	require.Len(t, releases[2].Sections, 2)
+	assert.Equal(t, "Features", releases[2].Sections[0].Title)
+	assert.Equal(t, core.ChangelogEntry{Hash: feature, Scope: "api", Description: "add an endpoint"}, releases[2].Sections[0].Entries[0])
+	assert.Equal(t, "Bug Fixes", releases[2].Sections[1].Title)
+	assert.Equal(t, "api/v1.0.0", releases[3].Tag)
+
+	var text strings.Builder
+	require.NoError(t, core.WriteChangelogs(&text, changelogs[:1], "https://example.com/org/repo/"))
+	assert.Contains(t, text.String(), "# api Changelog\n\n## [Unreleased](https://example.com/org/repo/compare/api/v2.0.0...HEAD)\n")
+	assert.Contains(t, text.String(), "## [1.1.0](https://example.com/org/repo/compare/api/v1.0.0...api/v1.1.0) (2026-01-01)\n\n### Features\n\n")
+	assert.Contains(t, text.String(), "- **api:** add an endpoint ([")
+
+	// A range starts after its tag.
+	changelogs, err = core.Changelogs(context.Background(), config, core.ChangelogOptions{From: "api/v1.1.0", Targets: []string{"api"}})
+	require.NoError(t, err)
+	require.Len(t, changelogs[0].Releases, 1)
+	assert.Equal(t, "api/v2.0.0", changelogs[0].Releases[0].Tag)
+
+	// Without named targets, the tag selects its own target.
+	changelogs, err = core.Changelogs(context.Background(), config, core.ChangelogOptions{From: "api/v1.1.0"})
+	require.NoError(t, err)
+	require.Len(t, changelogs, 1)
+	assert.Equal(t, "api", changelogs[0].Package)
+	require.Len(t, changelogs[0].Releases, 1)
+
+	_, err = core.Changelogs(context.Background(), config, core.ChangelogOptions{From: "worker/v2.0.0", Targets: []string{"api"}})
+	assert.ErrorContains(t, err, `not a version tag of target "api"`)
+	_, err = core.Changelogs(context.Background(), config, core.ChangelogOptions{From: "web/v1.0.0"})
+	assert.ErrorContains(t, err, `not a version tag of any release target`)
+}
+
+func TestScenarioOnlyMarkedReleaseCommitsAreLeftOut(t *testing.T) {
+	repo := newScenario()
+	repo.Commit("chore(release): api v1.1.0\n\nRelease-Commit: semver-tags", "services/api/CHANGELOG.md")
+	config := core.Config{
+		Repository:  repo,
+		DryRun:      true,
+		PatchTypes:  []string{"fix", "chore"},
+		Directories: []string{"services/api"},
+	}
+
+	// The marked commit is left out, even without release commits.
+	outputs := analyze(t, config)
+	assert.Equal(t, "api/v1.0.0", outputs.NewReleaseGitTag)
+	statuses, err := core.Status(context.Background(), config)
+	require.NoError(t, err)
+	assert.Equal(t, 0, statuses[0].UnreleasedCommits)
+
+	// A commit of our own with the same subject prefix counts.
+	pin := repo.Commit("chore(release): pin the release tooling", "services/api/file.txt")
+	outputs = analyze(t, config)
+	assert.Equal(t, "api/v1.0.1", outputs.NewReleaseGitTag)
+	changelogs, err := core.Changelogs(context.Background(), config, core.ChangelogOptions{Unreleased: true})
+	require.NoError(t, err)
+	require.Len(t, changelogs[0].Releases, 2)
+	assert.Equal(t, []core.ChangelogSection{{Title: "Chores", Entries: []core.ChangelogEntry{
+		{Hash: pin, Scope: "release", Description: "pin the release tooling"},
+	}}}, changelogs[0].Releases[0].Sections)
+}
+
+func TestScenarioPreReleaseNumbersCountOnlyFromACounter(t *testing.T) {
+	repo := newScenario()
+	repo.Tag("api/v1.1.0-pr.482.2", repo.Commit("fix: repair the api", "services/api/file.txt"))
+	repo.Commit("fix: repair the api again", "services/api/file.txt")
+	t.Setenv("PR_NUMBER", "100")
+	config := core.Config{
+		Repository:       repo,
+		DryRun:           true,
+		PreReleaseString: `pr.{{.Env "PR_NUMBER"}}`,
+		Directories:      []string{"services/api"},
+	}
+
+	// The number of another pull request is not a counter.
+	outputs := analyze(t, config)
+	assert.Equal(t, "api/v1.1.0-pr.100.1", outputs.NewReleaseGitTag)
+
+	// A commit count is, and it stays after the last version of its series.
+	t.Setenv("PR_NUMBER", "482")
+	config.PreReleaseString = `pr.{{.Env "PR_NUMBER"}}.{{.CommitCount}}`
+	outputs = analyze(t, config)
+	assert.Equal(t, "api/v1.1.0-pr.482.3", outputs.NewReleaseGitTag)
+}
+
+// The fake reads wildcard pathspecs like git, and takes the concurrent calls
+// of a run with more than one job.
+func TestScenarioGlobTargetsInParallel(t *testing.T) {
+	repo := newScenario()
+	repo.Commit("feat: add a schema", "libs/proto/api.proto")
+	repo.Commit("feat: describe the schema", "libs/proto/README.md")
+	repo.Commit("fix: repair the api", "services/api/file.txt")
+
+	outputs := analyze(t, core.Config{
+		Repository:  repo,
+		DryRun:      true,
+		Jobs:        4,
+		Directories: []string{"services/api"},
+		DirGroups:   []string{"services/worker,libs/*/*.proto"},
+	})
+
+	assert.Equal(t, "api/v1.0.1,worker/v2.1.0", outputs.NewReleaseGitTag)
+}
+
+func TestScenarioDefaultFormatReadsTagsWithoutTheVPrefix(t *testing.T) {
+	repo := gittest.New()
+	first := repo.Commit("feat: initial layout", "services/api/file.txt", "README.md")
+	repo.Tag("api/1.2.3", first)
+	repo.Tag("1.4.0", first)
+	repo.Commit("fix: repair the api", "services/api/file.txt", "README.md")
+
+	outputs := analyze(t, core.Config{
+		Repository:  repo,
+		DryRun:      true,
+		Directories: []string{"services/api"},
+	})
+	assert.Equal(t, "1.2.3", outputs.LastReleaseVersion)
+	assert.Equal(t, "api/v1.2.4", outputs.NewReleaseGitTag)
+
+	outputs = analyze(t, core.Config{Repository: repo, DryRun: true})
+	assert.Equal(t, "1.4.0", outputs.LastReleaseVersion)
+	assert.Equal(t, "v1.4.1", outputs.NewReleaseGitTag)
+
+	// A configured format reads only its own form.
+	outputs = analyze(t, core.Config{
+		Repository:  repo,
+		DryRun:      true,
+		TagFormat:   "{{.Package}}/v{{.Version}}",
+		Directories: []string{"services/api"},
+	})
+	assert.Equal(t, "api/v0.1.1", outputs.NewReleaseGitTag)
+}
@@ -27,6 +27,30 @@ func NewSemver(major, minor, patch uint32) *Semver {
 	return &Semver{Major: major, Minor: minor, Patch: patch}
 }
 
+// Parse reads a version without the "v" prefix, such as 1.2.3-rc.1+build7.
+func Parse(text string) (*Semver, error) {
+	versionPart, build, _ := strings.Cut(text, "+")
+	versionPart, preRelease, _ := strings.Cut(versionPart, "-")
+
+	numbers := strings.Split(versionPart, ".")
+	if len(numbers) != 3 {
+		return nil, fmt.Errorf("version %q must have three numbers", text)
+	}
+	var parsed [3]uint32
+	for index, number := range numbers {
+		value, err := strconv.ParseUint(number, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("version %q has an invalid number: %w", text, err)
+		}
+		parsed[index] = uint32(value)
+	}
+
+	version := NewSemver(parsed[0], parsed[1], parsed[2])
+	version.PreRelease = preRelease
+	version.Build = build
+	return version, nil
+}
+
 func (v *Semver) Clone() *Semver {
 	retVal := NewSemver(v.Major, v.Minor, v.Patch)
 	retVal.PreRelease = v.PreRelease
@@ -101,17 +125,71 @@ func compareIdentifiers(left string, right string) int {
 	}
 }
 
+// ValidatePreRelease reports whether a pre-release part follows the semantic
+// version rules: dot-separated identifiers of ASCII letters, digits, and
+// hyphens, and no leading zero in a numeric identifier.
+func ValidatePreRelease(preRelease string) error {
+	return validateIdentifiers("pre-release", preRelease, true)
+}
+
+// ValidateBuild reports whether a build part follows the semantic version
+// rules. A numeric build identifier can have a leading zero.
+func ValidateBuild(build string) error {
+	return validateIdentifiers("build", build, false)
+}
+
+func validateIdentifiers(kind string, value string, numericRule bool) error {
+	if value == "" {
+		return nil
+	}
+	for _, identifier := range strings.Split(value, ".") {
+		if identifier == "" {
+			return fmt.Errorf("%s %q has an empty identifier", kind, value)
+		}
+		numeric := true
+		for _, character := range identifier {
+			switch {
+			case character >= '0' && character <= '9':
+			case character >= 'A' && character <= 'Z',
+				character >= 'a' && character <= 'z',
+				character == '-':
+				numeric = false
+			default:
+				return fmt.Errorf("%s %q can hold only ASCII letters, digits, hyphens, and dots", kind, value)
+			}
+		}
+		if numericRule && numeric && len(identifier) > 1 && identifier[0] == '0' {
+			return fmt.Errorf("%s %q has a numeric identifier with a leading zero", kind, value)
+		}
+	}
+	return nil
+}
+
+// preReleaseSeries splits a pre-release into its series and its trailing
+// numeric identifier, so "pr.482.3" is number 3 of the series "pr.482". A
+// pre-release without a trailing number, such as "rc", is its own series and
+// has no number.
+func preReleaseSeries(preRelease string) (string, int, bool) {
+	idx := strings.LastIndex(preRelease, ".")
+	if idx < 0 {
+		return preRelease, 0, false
+	}
+	number, err := strconv.Atoi(preRelease[idx+1:])
+	if err != nil {
+		return preRelease, 0, false
+	}
+	return preRelease[:idx], number, true
+}
+
 // BumpVersion applies a commit level and optional version identifiers.
 func (v *Semver) BumpVersion(commitType CommitType, preRelease string, build string) {
 	cleanPreRelease := strings.Trim(preRelease, " \n\r\t")
-	currentPreRelease := strings.Split(v.PreRelease, ".")[0]
-
-	if currentPreRelease != "" && cleanPreRelease == currentPreRelease {
-		v.IncrementPreRelease()
-		return
-	}
 	if cleanPreRelease != "" {
-		v.PreRelease = preRelease + ".1"
+		if series, _, _ := preReleaseSeries(v.PreRelease); series == cleanPreRelease {
+			v.IncrementPreRelease()
+		} else {
+			v.PreRelease = cleanPreRelease + ".1"
+		}
 		if build != "" {
 			v.Build = build
 		}
@@ -156,22 +234,33 @@ func (v *Semver) BumpPatch() {
 	v.Build = ""
 }
 
-func (v *Semver) IncrementPreRelease() {
-	parts := strings.Split(v.PreRelease, ".")
-	if len(parts) < 2 {
-		v.PreRelease = parts[0] + ".2"
-		return
+// BumpCountedVersion applies a pre-release whose trailing number is a counter,
+// such as "pr.482.3" from three commits, and an optional build. The counter
+// is used as it is, unless the last version of the same series has a number
+// that is not lower; then that number increases, so the version still sorts
+// after it. The number of another series is never increased.
+func (v *Semver) BumpCountedVersion(preRelease string, build string) {
+	series, number, _ := preReleaseSeries(strings.Trim(preRelease, " \n\r\t"))
+	currentSeries, currentNumber, numbered := preReleaseSeries(v.PreRelease)
+	if numbered && currentSeries == series && currentNumber >= number {
+		v.IncrementPreRelease()
+	} else {
+		v.PreRelease = fmt.Sprintf("%s.%d", series, number)
 	}
-
-	numberPart := parts[1]
-	number, err := strconv.Atoi(numberPart)
-	// Restart at 1 when the existing suffix is not a number.
-	if err != nil {
-		v.PreRelease = parts[0] + ".1"
-		return
+	if build != "" {
+		v.Build = build
 	}
+}
 
-	v.PreRelease = parts[0] + "." + fmt.Sprintf("%d", number+1)
+// IncrementPreRelease increases the trailing number of the pre-release. A
+// pre-release without one counts as the first of its series, so "rc" becomes
+// "rc.2".
+func (v *Semver) IncrementPreRelease() {
+	series, number, numbered := preReleaseSeries(v.PreRelease)
+	if !numbered {
+		number = 1
+	}
+	v.PreRelease = fmt.Sprintf("%s.%d", series, number+1)
 }
 
 func (v *Semver) FormattedString() string {
@@ -117,3 +117,67 @@ func TestCompareOrdersAReleaseSeries(t *testing.T) {
 	assert.Equal(t, 1, NewSemver(2, 0, 0).Compare(NewSemver(1, 1, 0)))
 	assert.Equal(t, 1, parse(t, 2, 0, 0, "rc.1").Compare(NewSemver(1, 9, 9)))
 }
+
+func TestBumpVersionIncrementsAMultiPartPreRelease(t *testing.T) {
+	version := NewSemver(1, 3, 0)
+
+	version.BumpVersion(Minor, "pr.482", "")
+	assert.Equal(t, "v1.3.0-pr.482.1", version.FormattedString())
+
+	version.BumpVersion(Minor, "pr.482", "")
+	assert.Equal(t, "v1.3.0-pr.482.2", version.FormattedString())
+}
+
+// A value that ends in a number is a series like any other value, so its
+// number is never counted.
+func TestBumpVersionAddsASuffixToANumberedValue(t *testing.T) {
+	version := NewSemver(1, 3, 0)
+
+	version.BumpVersion(Minor, "alpha.1", "")
+	assert.Equal(t, "v1.3.0-alpha.1.1", version.FormattedString())
+
+	version.BumpVersion(Minor, "alpha.1", "")
+	assert.Equal(t, "v1.3.0-alpha.1.2", version.FormattedString())
+}
+
+func TestBumpVersionDoesNotRenumberALowerPR(t *testing.T) {
+	version := &Semver{Major: 1, Minor: 3, Patch: 0, PreRelease: "pr.482"}
+
+	version.BumpVersion(Minor, "pr.100", "")
+	assert.Equal(t, "v1.3.0-pr.100.1", version.FormattedString())
+}
+
+func TestBumpCountedVersionUsesTheCounter(t *testing.T) {
+	version := NewSemver(1, 3, 0)
+
+	version.BumpCountedVersion("pr.482.3", "g1a2b3c4")
+	assert.Equal(t, "v1.3.0-pr.482.3+g1a2b3c4", version.FormattedString())
+
+	version.BumpCountedVersion("pr.482.5", "")
+	assert.Equal(t, "v1.3.0-pr.482.5+g1a2b3c4", version.FormattedString())
+
+	// A count that does not sort after the last version of the series
+	// increases the last version instead.
+	version.BumpCountedVersion("pr.482.2", "")
+	assert.Equal(t, "v1.3.0-pr.482.6+g1a2b3c4", version.FormattedString())
+
+	// The number of another series is never increased.
+	version.BumpCountedVersion("pr.100.1", "")
+	assert.Equal(t, "v1.3.0-pr.100.1+g1a2b3c4", version.FormattedString())
+}
+
+func TestValidatePreRelease(t *testing.T) {
+	assert.NoError(t, ValidatePreRelease(""))
+	assert.NoError(t, ValidatePreRelease("pr.482-a.0"))
+	assert.Error(t, ValidatePreRelease("pr..1"))
+	assert.Error(t, ValidatePreRelease("feature/one"))
+	assert.Error(t, ValidatePreRelease("pr.01"))
+}
+
+// A build part can have a numeric identifier with a leading zero, because
+// build parts do not take part in precedence.
+func TestValidateBuild(t *testing.T) {
+	assert.NoError(t, ValidateBuild("g1a2b3c4.007"))
+	assert.Error(t, ValidateBuild("g1a2b3c4+1"))
+	assert.Error(t, ValidateBuild("."))
+}
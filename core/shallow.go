@@ -0,0 +1,94 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/catalystcommunity/app-utils-go/logging"
+)
+
+// firstDeepen is the number of commits that the first deepening fetch reads.
+// Each later fetch reads twice as many.
+const firstDeepen = 64
+
+// checkShallow stops a run in a shallow clone, where a missing tag or the
+// shallow boundary can give a wrong version. With Deepen, it fetches every
+// tag of the remote instead, and the run deepens the history later.
+func (t *tagger) checkShallow(ctx context.Context) error {
+	shallow, err := t.repo.Shallow(ctx)
+	if err != nil || !shallow {
+		return err
+	}
+	if !t.config.Deepen {
+		return fmt.Errorf(
+			"the repository is a shallow clone, so the tags and the first commit can give a wrong version; " +
+				"fetch the full history with \"git fetch --unshallow --tags\" or run with --deepen",
+		)
+	}
+
+	// A run with FetchTags has fetched the tags already.
+	if !t.config.FetchTags {
+		remote := t.config.primaryRemote()
+		logging.Log.Info(fmt.Sprintf("Fetching every tag from %s into the shallow clone", remote))
+		if err := t.repo.Fetch(ctx, remote, FetchOptions{Tags: true}); err != nil {
+			return err
+		}
+	}
+	t.shallow = true
+	return nil
+}
+
+// deepen fetches more history from the remote until HEAD holds the last
+// version of every group. A group without a version tag starts at the first
+// commit, so it needs the full history. The last version of such a group is
+// read again after the fetch.
+func (t *tagger) deepen(ctx context.Context, groups []DirectoryVersionInfo) error {
+	remote := t.config.primaryRemote()
+	depth := firstDeepen
+	for t.shallow {
+		options := FetchOptions{Deepen: depth}
+		complete := true
+		for _, group := range groups {
+			if group.LastVersion.initial {
+				options = FetchOptions{Unshallow: true}
+				complete = false
+				break
+			}
+			contains, err := t.repo.Contains(ctx, group.LastVersion.CommitHash)
+			if err != nil {
+				return err
+			}
+			if !contains {
+				complete = false
+			}
+		}
+		if complete {
+			return nil
+		}
+
+		if options.Unshallow {
+			logging.Log.Info(fmt.Sprintf("Fetching the full history from %s", remote))
+		} else {
+			logging.Log.Info(fmt.Sprintf("Deepening the shallow clone by %d commits from %s", depth, remote))
+		}
+		if err := t.repo.Fetch(ctx, remote, options); err != nil {
+			return err
+		}
+		depth *= 2
+
+		shallow, err := t.repo.Shallow(ctx)
+		if err != nil {
+			return err
+		}
+		t.shallow = shallow
+		for idx := range groups {
+			if !groups[idx].LastVersion.initial {
+				continue
+			}
+			if groups[idx].LastVersion, err = t.latestVersion(ctx, groups[idx]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// defaultSigningPrograms gives the program that git runs for each gpg.format
+// value when the configuration names no program.
+var defaultSigningPrograms = map[string]string{
+	"openpgp": "gpg",
+	"x509":    "gpgsm",
+	"ssh":     "ssh-keygen",
+}
+
+// SigningKey checks that git can sign tags and gives the key that signs them.
+// It reads the same settings as git: gpg.format, the signing program, and
+// user.signingkey. Without user.signingkey, OpenPGP and X.509 use the
+// committer identity. It runs before the first tag, so a missing key stops the
+// run before anything is tagged or pushed.
+func (r *GitRepository) SigningKey(ctx context.Context) (string, error) {
+	format, err := r.configValue(ctx, "gpg.format")
+	if err != nil {
+		return "", err
+	}
+	if format == "" {
+		format = "openpgp"
+	}
+	program, found := defaultSigningPrograms[format]
+	if !found {
+		return "", fmt.Errorf("can not sign tags: gpg.format %q is not openpgp, x509, or ssh", format)
+	}
+
+	configuredProgram, err := r.configValue(ctx, "gpg."+format+".program")
+	if err != nil {
+		return "", err
+	}
+	if configuredProgram == "" && format == "openpgp" {
+		configuredProgram, err = r.configValue(ctx, "gpg.program")
+		if err != nil {
+			return "", err
+		}
+	}
+	if configuredProgram != "" {
+		program = configuredProgram
+	}
+	if _, err := exec.LookPath(program); err != nil {
+		return "", fmt.Errorf("can not sign tags: the %s signing program %q is not available: %w", format, program, err)
+	}
+
+	key, err := r.configValue(ctx, "user.signingkey")
+	if err != nil {
+		return "", err
+	}
+	if format == "ssh" {
+		return r.sshSigningKey(ctx, key)
+	}
+	if key != "" {
+		return key, nil
+	}
+
+	identity, err := r.value(ctx, "var", "GIT_COMMITTER_IDENT")
+	if err != nil {
+		return "", fmt.Errorf("can not sign tags: no user.signingkey and no committer identity: %w", err)
+	}
+	// The identity ends with the date, which is not part of the key name.
+	if end := strings.LastIndex(identity, ">"); end >= 0 {
+		identity = identity[:end+1]
+	}
+	return identity, nil
+}
+
+// sshSigningKey checks an SSH user.signingkey. The value is a literal public
+// key with a "key::" prefix, a public key that starts with "ssh-", or the path
+// of a key file.
+func (r *GitRepository) sshSigningKey(ctx context.Context, key string) (string, error) {
+	if key == "" {
+		command, err := r.configValue(ctx, "gpg.ssh.defaultKeyCommand")
+		if err != nil {
+			return "", err
+		}
+		if command == "" {
+			return "", fmt.Errorf("can not sign tags: gpg.format is ssh, but user.signingkey and gpg.ssh.defaultKeyCommand are not set")
+		}
+		return "gpg.ssh.defaultKeyCommand", nil
+	}
+	if strings.HasPrefix(key, "key::") || strings.HasPrefix(key, "ssh-") {
+		return key, nil
+	}
+
+	path := key
+	if rest, found := strings.CutPrefix(path, "~/"); found {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("can not sign tags: can not expand %q: %w", key, err)
+		}
+		path = filepath.Join(home, rest)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("can not sign tags: the SSH signing key %q is not readable: %w", key, err)
+	}
+	return key, nil
+}
+
+// TagSigner gives the key that made the signature of one tag. It is empty
+// when the tag has no signature, or a signature that signatureKey can not
+// read.
+func (r *GitRepository) TagSigner(ctx context.Context, tag string) (string, error) {
+	signature, err := r.value(ctx, "for-each-ref", "--format=%(contents:signature)", "refs/tags/"+tag)
+	if err != nil {
+		return "", err
+	}
+	return signatureKey(signature)
+}
+
+// signatureKey gives the key of an armored signature: the public key of an
+// SSH signature, such as "ssh-ed25519 AAAA...", or the fingerprint of an
+// OpenPGP signature. It is empty for no signature and for an X.509
+// signature, which names its key only in a certificate chain.
+func signatureKey(signature string) (string, error) {
+	signature = strings.TrimSpace(signature)
+	switch {
+	case signature == "":
+		return "", nil
+	case strings.HasPrefix(signature, "-----BEGIN SSH SIGNATURE-----"):
+		return sshSignatureKey(signature)
+	case strings.HasPrefix(signature, "-----BEGIN PGP SIGNATURE-----"):
+		return openPGPSignatureKey(signature)
+	}
+	return "", nil
+}
+
+// sshSignatureKey reads the public key of an SSHSIG signature. The blob
+// starts with the "SSHSIG" magic, a version, and the public key.
+func sshSignatureKey(signature string) (string, error) {
+	var encoded strings.Builder
+	for _, line := range strings.Split(signature, "\n") {
+		if !strings.HasPrefix(line, "-----") {
+			encoded.WriteString(strings.TrimSpace(line))
+		}
+	}
+	blob, err := base64.StdEncoding.DecodeString(encoded.String())
+	if err != nil {
+		return "", fmt.Errorf("can not read the SSH signature: %w", err)
+	}
+	rest, found := bytes.CutPrefix(blob, []byte("SSHSIG"))
+	if !found || len(rest) < 4 {
+		return "", errors.New("can not read the SSH signature: it does not start with SSHSIG")
+	}
+	publicKey, _, err := sshString(rest[4:])
+	if err != nil {
+		return "", fmt.Errorf("can not read the key of the SSH signature: %w", err)
+	}
+	keyType, _, err := sshString(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("can not read the key of the SSH signature: %w", err)
+	}
+	return string(keyType) + " " + base64.StdEncoding.EncodeToString(publicKey), nil
+}
+
+// sshString reads one length-prefixed string of the SSH wire format, and
+// gives the rest of the data after it.
+func sshString(data []byte) ([]byte, []byte, error) {
+	if len(data) < 4 {
+		return nil, nil, errors.New("the data ends before a length")
+	}
+	length := binary.BigEndian.Uint32(data)
+	if uint64(len(data)-4) < uint64(length) {
+		return nil, nil, errors.New("the data ends before the end of a string")
+	}
+	return data[4 : 4+length], data[4+length:], nil
+}
+
+// openPGPSignatureKey reads the issuer of an OpenPGP signature: its
+// fingerprint, or the key ID of an older signature without one.
+func openPGPSignatureKey(signature string) (string, error) {
+	block, err := armor.Decode(strings.NewReader(signature))
+	if err != nil {
+		return "", fmt.Errorf("can not read the OpenPGP signature: %w", err)
+	}
+	read, err := packet.Read(block.Body)
+	if err != nil {
+		return "", fmt.Errorf("can not read the OpenPGP signature: %w", err)
+	}
+	signaturePacket, ok := read.(*packet.Signature)
+	if !ok {
+		return "", errors.New("can not read the OpenPGP signature: it holds no signature packet")
+	}
+	if len(signaturePacket.IssuerFingerprint) > 0 {
+		return strings.ToUpper(hex.EncodeToString(signaturePacket.IssuerFingerprint)), nil
+	}
+	if signaturePacket.IssuerKeyId != nil {
+		return fmt.Sprintf("%016X", *signaturePacket.IssuerKeyId), nil
+	}
+	return "", errors.New("the OpenPGP signature does not name its key")
+}
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignatureKeyReadsTheOpenPGPFingerprint(t *testing.T) {
+	entity, err := openpgp.NewEntity("Release", "", "release@example.com", nil)
+	require.NoError(t, err)
+	var signature strings.Builder
+	require.NoError(t, openpgp.ArmoredDetachSign(&signature, entity, strings.NewReader("api/v1.0.1\n"), nil))
+
+	key, err := signatureKey(signature.String())
+
+	require.NoError(t, err)
+	assert.Equal(t, strings.ToUpper(entity.PrimaryKey.KeyIdString()), key[len(key)-16:])
+	assert.Len(t, key, 40)
+}
+
+func TestSignatureKeyOfAnUnreadableSignature(t *testing.T) {
+	key, err := signatureKey("")
+	require.NoError(t, err)
+	assert.Empty(t, key)
+
+	key, err = signatureKey("-----BEGIN SIGNED MESSAGE-----\nMIAG\n-----END SIGNED MESSAGE-----")
+	require.NoError(t, err)
+	assert.Empty(t, key)
+
+	_, err = signatureKey("-----BEGIN SSH SIGNATURE-----\nbm90IGEgc2lnbmF0dXJl\n-----END SSH SIGNATURE-----")
+	assert.ErrorContains(t, err, "SSHSIG")
+}
+
+func TestCommitSignatureTrustsOnlyTheKeysOfTheGPGHome(t *testing.T) {
+	trusted := map[string]bool{"ABCDEF0123": true}
+
+	assert.Equal(t, "G", commitSignature("GABCDEF0123", trusted))
+	assert.Equal(t, "G", commitSignature("Uabcdef0123\n", trusted))
+	assert.Equal(t, "U", commitSignature("U0123456789", trusted))
+	assert.Equal(t, "U", commitSignature("USHA256:abc", nil))
+	assert.Equal(t, "N", commitSignature("N", nil))
+	assert.Equal(t, "", commitSignature("", nil))
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+const (
+	// SnapshotFormatGo makes a Go pseudo-version, such as
+	// v1.3.0-0.20261017120000-abcdef123456.
+	SnapshotFormatGo = "go"
+	// SnapshotFormatDescribe makes a git describe version, such as
+	// api/v1.2.3-4-gabcdef.
+	SnapshotFormatDescribe = "describe"
+)
+
+var snapshotFormats = []string{SnapshotFormatGo, SnapshotFormatDescribe}
+
+func validateSnapshotFormat(format string) error {
+	if format == "" || slices.Contains(snapshotFormats, format) {
+		return nil
+	}
+	return fmt.Errorf("snapshot format %q is not one of %v", format, snapshotFormats)
+}
+
+// goSnapshotVersion makes a Go pseudo-version from the next version. When the
+// target has nothing to release, it uses the next patch version, as Go does,
+// so the snapshot still sorts after the last release.
+func goSnapshotVersion(result DirectoryVersionInfo, head string, headTime string) (string, error) {
+	version := result.NextVersion.Version.Clone()
+	if version.Compare(result.LastVersion.Version) == 0 {
+		version.BumpPatch()
+	}
+	suffix := fmt.Sprintf("0.%s-%s", headTime, head[:min(12, len(head))])
+	if version.PreRelease != "" {
+		version.PreRelease += "." + suffix
+	} else {
+		version.PreRelease = suffix
+	}
+	version.Build = ""
+	return tagFor(&VersionInfo{
+		Package: result.NextVersion.Package,
+		Version: version,
+		format:  result.NextVersion.format,
+	})
+}
+
+// describeSnapshotVersion makes a git describe version from the last release
+// tag. A target with no commit after its last release gives the tag only. Like
+// git describe --always, a target without a release tag gives the abbreviated
+// HEAD commit only, since its first version names no tag.
+func describeSnapshotVersion(result DirectoryVersionInfo, count int, shortHead string) (string, error) {
+	if result.LastVersion.initial {
+		return shortHead, nil
+	}
+	tag, err := tagFor(result.LastVersion)
+	if err != nil || count == 0 {
+		return tag, err
+	}
+	return fmt.Sprintf("%s-%d-g%s", tag, count, shortHead), nil
+}
+
+// snapshotVersions gives each analyzed target its untagged snapshot version.
+func (t *tagger) snapshotVersions(ctx context.Context, results []DirectoryVersionInfo) error {
+	switch t.config.SnapshotFormat {
+	case SnapshotFormatDescribe:
+		shortHead, err := t.repo.ShortCommit(ctx, t.head)
+		if err != nil {
+			return err
+		}
+		for index := range results {
+			count := 0
+			if !results[index].LastVersion.initial {
+				if count, err = t.repo.CommitCount(ctx, results[index].LastVersion.CommitHash); err != nil {
+					return err
+				}
+			}
+			results[index].SnapshotVersion, err = describeSnapshotVersion(results[index], count, shortHead)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		headTime, err := t.repo.CommitTime(ctx, t.head)
+		if err != nil {
+			return err
+		}
+		for index := range results {
+			results[index].SnapshotVersion, err = goSnapshotVersion(
+				results[index], t.head, headTime.Format("20060102150405"),
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// TargetStatus is the release state of one target.
+type TargetStatus struct {
+	Package string   `json:"package"`
+	Paths   []string `json:"paths"`
+	// Version is the current version without the v prefix. A target without
+	// a version tag starts at 0.1.0 on the first commit, and its Tag,
+	// Commit, and Date are empty.
+	Version string     `json:"version"`
+	Tag     string     `json:"tag"`
+	Commit  string     `json:"commit"`
+	Date    *time.Time `json:"date"`
+	// UnreleasedCommits is the number of commits of the target after its
+	// current version.
+	UnreleasedCommits int `json:"unreleased_commits"`
+	// Bump is the pending BumpMajor, BumpMinor, BumpPatch, or
+	// BumpPrerelease, "none", or BumpBlocked.
+	Bump        string `json:"bump"`
+	NextVersion string `json:"next_version"`
+	NextTag     string `json:"next_tag"`
+	// Policy is the strongest action of the release policies that apply to
+	// the pending release, or "".
+	Policy string `json:"policy,omitempty"`
+	// Blocked is the reason that the target can not release, or "".
+	Blocked string `json:"blocked,omitempty"`
+}
+
+// BumpBlocked is the Bump of a target that can not release, such as a target
+// with an unapproved breaking change. Its next version is its current
+// version.
+const BumpBlocked = "blocked"
+
+// Status gives the release state of every target, in the output order of the
+// targets. It runs the analysis of a dry run and never writes a ref, so it
+// does not fetch. A release at HEAD is the current version. A blocked target
+// does not fail the status; its row gives the reason.
+func Status(ctx context.Context, config Config) ([]TargetStatus, error) {
+	config.DryRun = true
+	config.Snapshot = false
+	config.FetchTags = false
+	config.Deepen = false
+	results, err := AnalyzeReleases(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := config.repository()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]TargetStatus, 0, len(results))
+	for _, result := range results {
+		current, next := result.LastVersion, result.LastVersion
+		status := TargetStatus{
+			Package:           result.PackageName(),
+			Paths:             result.Directories,
+			UnreleasedCommits: result.UnreleasedCommits,
+			Bump:              "none",
+		}
+		switch {
+		case result.AlreadyReleased:
+			current, next = result.NextVersion, result.NextVersion
+		case result.hasNewVersion():
+			next = result.NextVersion
+			status.Bump = bumpLevel(current, next)
+			status.Policy = result.Policy
+		}
+		if result.Blocked != nil {
+			status.Bump = BumpBlocked
+			status.Blocked = result.Blocked.Error()
+		}
+
+		status.Version = strings.TrimPrefix(current.Version.FormattedString(), "v")
+		if !current.initial {
+			if status.Tag, err = current.Tag(); err != nil {
+				return nil, err
+			}
+			status.Commit = current.CommitHash
+			date, err := repo.CommitTime(ctx, current.CommitHash)
+			if err != nil {
+				return nil, err
+			}
+			status.Date = &date
+		}
+		status.NextVersion = strings.TrimPrefix(next.Version.FormattedString(), "v")
+		if status.NextTag, err = next.Tag(); err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
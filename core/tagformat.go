@@ -0,0 +1,166 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/catalystcommunity/semver-tags/core/semver"
+)
+
+// DefaultTagFormat makes "package/vX.Y.Z" for a package and "vX.Y.Z" for the
+// whole repository.
+const DefaultTagFormat = `{{if .Package}}{{.Package}}/{{end}}v{{.Version}}`
+
+// versionMarker stands in for the version when a format is split into the
+// text before and after the version. A tag can not hold this character.
+const versionMarker = "\x00"
+
+// TagFormatData holds the values that a tag format can read. Version has no
+// "v" prefix, so a format can leave the prefix out.
+type TagFormatData struct {
+	Package string
+	Version string
+}
+
+// tagFormat renders new tags and reads existing tags with one template, so
+// the two can not disagree.
+type tagFormat struct {
+	text     string
+	template *template.Template
+	// bareVersions also reads tags without the "v" before the version, such
+	// as "api/1.2.3", which the default format read before formats existed.
+	bareVersions bool
+
+	mu       sync.Mutex
+	affixMap map[string]tagAffixes
+}
+
+// tagAffixes holds the text before and after the version in the tags of one
+// package.
+type tagAffixes struct {
+	prefix string
+	suffix string
+}
+
+var defaultTagFormat = mustTagFormat(DefaultTagFormat)
+
+func mustTagFormat(text string) *tagFormat {
+	format, err := newTagFormat(text)
+	if err != nil {
+		panic(err)
+	}
+	return format
+}
+
+// newTagFormat reads one tag format. An empty format is the default format,
+// which also reads tags without the "v" before the version. The format must
+// use the version one time, or it could not read a tag back.
+func newTagFormat(text string) (*tagFormat, error) {
+	bareVersions := text == ""
+	if text == "" {
+		text = DefaultTagFormat
+	}
+	parsed, err := template.New("tag_format").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("can not read the tag format %q: %w", text, err)
+	}
+	format := &tagFormat{text: text, template: parsed, bareVersions: bareVersions}
+	if _, _, err := format.affixes("package"); err != nil {
+		return nil, err
+	}
+	return format, nil
+}
+
+// render makes the tag text of one package and version text.
+func (f *tagFormat) render(packageName string, version string) (string, error) {
+	var tag strings.Builder
+	if err := f.template.Execute(&tag, TagFormatData{Package: packageName, Version: version}); err != nil {
+		return "", fmt.Errorf("can not render the tag format %q: %w", f.text, err)
+	}
+	return tag.String(), nil
+}
+
+// affixes gives the text before and after the version in a tag of one
+// package.
+func (f *tagFormat) affixes(packageName string) (string, string, error) {
+	rendered, err := f.render(packageName, versionMarker)
+	if err != nil {
+		return "", "", err
+	}
+	parts := strings.Split(rendered, versionMarker)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("tag format %q must use {{.Version}} exactly one time", f.text)
+	}
+	return parts[0], parts[1], nil
+}
+
+// tag makes the full tag of one version.
+func (f *tagFormat) tag(packageName string, version *semver.Semver) (string, error) {
+	return f.render(packageName, strings.TrimPrefix(version.FormattedString(), "v"))
+}
+
+// shortTags makes the mutable major and minor tags of one version.
+func (f *tagFormat) shortTags(packageName string, version *semver.Semver) ([]string, error) {
+	minor, err := f.render(packageName, fmt.Sprintf("%d.%d", version.Major, version.Minor))
+	if err != nil {
+		return nil, err
+	}
+	major, err := f.render(packageName, fmt.Sprintf("%d", version.Major))
+	if err != nil {
+		return nil, err
+	}
+	return []string{minor, major}, nil
+}
+
+// cachedAffixes gives the affixes of one package, and renders them only the
+// first time.
+func (f *tagFormat) cachedAffixes(packageName string) (tagAffixes, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if affixes, found := f.affixMap[packageName]; found {
+		return affixes, nil
+	}
+	prefix, suffix, err := f.affixes(packageName)
+	if err != nil {
+		return tagAffixes{}, err
+	}
+	if f.affixMap == nil {
+		f.affixMap = map[string]tagAffixes{}
+	}
+	affixes := tagAffixes{prefix: prefix, suffix: suffix}
+	f.affixMap[packageName] = affixes
+	return affixes, nil
+}
+
+// parse gives the version of one tag of one package. It gives false when the
+// tag does not have the form of this package, such as a tag of another
+// package or a short version tag.
+func (f *tagFormat) parse(tag string, packageName string) (*semver.Semver, bool) {
+	affixes, err := f.cachedAffixes(packageName)
+	if err != nil {
+		return nil, false
+	}
+	if version, matches := parseAffixed(tag, affixes.prefix, affixes.suffix); matches {
+		return version, true
+	}
+	if f.bareVersions && strings.HasSuffix(affixes.prefix, "v") {
+		return parseAffixed(tag, strings.TrimSuffix(affixes.prefix, "v"), affixes.suffix)
+	}
+	return nil, false
+}
+
+// parseAffixed gives the version between a prefix and a suffix of a tag.
+func parseAffixed(tag string, prefix string, suffix string) (*semver.Semver, bool) {
+	if len(tag) < len(prefix)+len(suffix) ||
+		!strings.HasPrefix(tag, prefix) ||
+		!strings.HasSuffix(tag, suffix) {
+		return nil, false
+	}
+	version, err := semver.Parse(tag[len(prefix) : len(tag)-len(suffix)])
+	if err != nil {
+		return nil, false
+	}
+	return version, true
+}
@@ -1,10 +1,13 @@
 package core
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/catalystcommunity/app-utils-go/logging"
 	"github.com/sirupsen/logrus"
@@ -16,125 +19,510 @@ const shortVersionWarning = "WARNING: Short version tags will become the default
 
 // Config holds every setting of one tagging run.
 type Config struct {
-	DryRun            bool
-	GithubAction      bool
-	OutputJson        bool
-	Atomic            bool
-	PreReleaseString  string
-	BuildString       string
-	Remote            string
-	Branch            string
-	AllowedTypes      []string
-	PatchTypes        []string
-	MinorTypes        []string
-	MajorTypes        []string
-	ShortVersions     bool
-	SkipShortVersions bool
-	Directories       []string
-	DirGroups         []string
-	Targets           []TargetConfig
+	DryRun             bool
+	GithubAction       bool
+	OutputJson         bool
+	Atomic             bool
+	PreReleaseString   string
+	BuildString        string
+	Remote             string
+	Branch             string
+	AllowedTypes       []string
+	PatchTypes         []string
+	MinorTypes         []string
+	MajorTypes         []string
+	ShortVersions      bool
+	SkipShortVersions  bool
+	Directories        []string
+	DirGroups          []string
+	Targets            []TargetConfig
+	Snapshot           bool
+	SnapshotFormat     string
+	TagFormat          string
+	Annotate           bool
+	AnnotationTemplate string
+	Sign               bool
+	TrustedSigners     string
+	SignedCommits      string
+	// Remotes lists every remote that a run pushes to. The first one is the
+	// primary remote, and Remote is not used. An empty list pushes to Remote.
+	Remotes []RemoteConfig
+	// MirrorFailure is MirrorFailureFail or MirrorFailureWarn. It decides
+	// what a failed push to a remote after the first does. An empty value is
+	// MirrorFailureFail.
+	MirrorFailure string
+	// FetchTags makes a run fetch every tag of the primary remote before it
+	// works out the versions. A remote tag replaces a local tag of the same
+	// name.
+	FetchTags bool
+	// PushRetries is the number of times a run works out its versions again
+	// when another run pushed one of its new tags first. A run with
+	// FetchTags or retries asks the primary remote for the new tags before it
+	// pushes.
+	PushRetries int
+	// RequireClean stops a run whose work tree has changes that HEAD does not
+	// hold.
+	RequireClean bool
+	// Deepen makes a run in a shallow clone fetch the tags and enough
+	// history from the primary remote. Without it, a shallow clone stops the run.
+	Deepen bool
+	// BreakingApproval makes a breaking change fail the run unless its commit
+	// or a later commit of the target carries a BreakingApprovalTrailer.
+	BreakingApproval bool
+	// BreakingApprovers limits the approval trailers that count to these
+	// names or email addresses. An empty list takes any approval.
+	BreakingApprovers []string
+	// Policies holds the release rules that a run checks before it makes
+	// tags, in order.
+	Policies []PolicyConfig
+	// Now is the time that the policies check. A zero value is the current
+	// time.
+	Now time.Time
+	// ReleaseCommit makes a run commit the version files and changelog of
+	// each target with a new tag, then tag that commit and push it with the
+	// branch. It needs a clean work tree, a Branch, and Atomic.
+	ReleaseCommit bool
+	// VersionFiles lists the files that a release commit updates for each
+	// target without its own list.
+	VersionFiles []VersionFile
+	// RepoURL is the web address of the repository, such as
+	// https://github.com/org/repo. Changelogs link to it when it is set.
+	RepoURL string
+	// Explain makes a run fill the Explanation of each target, and DoTagging
+	// write them to standard error.
+	Explain bool
+	// Jobs is the number of targets that a run analyzes at a time. A value
+	// below one analyzes one target at a time.
+	Jobs int
+	// GitBackend selects GitBackendExec or GitBackendNative when Repository
+	// is nil. An empty value is GitBackendExec.
+	GitBackend string
+	// Repository is the git backend of the run. A nil value uses GitBackend
+	// in the current directory.
+	Repository Repository
 }
 
 // DoTagging works out the next version of each directory group, makes the
-// tags, and writes the outputs.
-func DoTagging(config Config) error {
+// tags, and writes the outputs. A snapshot run writes the outputs only. When
+// the context ends, the run stops its git commands and makes no more tags.
+func DoTagging(ctx context.Context, config Config) error {
 	if config.ShortVersions && config.SkipShortVersions {
 		return errors.New("short_versions and skip_short_versions cannot both be true")
 	}
-	if !config.ShortVersions && !config.SkipShortVersions &&
+	if !config.Snapshot && !config.ShortVersions && !config.SkipShortVersions &&
 		logging.Log.IsLevelEnabled(logrus.WarnLevel) {
 		if _, err := fmt.Fprintln(os.Stdout, shortVersionWarning); err != nil {
 			return fmt.Errorf("can not write the short-version migration warning: %w", err)
 		}
 	}
-	rules, err := newBumpRules(config)
+
+	annotation, err := newAnnotationTemplate(config)
 	if err != nil {
 		return err
 	}
-
-	if !IsGitRepo() {
-		return errors.New("current directory is not a git repo, nothing to do")
+	if err := validateRemotes(config); err != nil {
+		return err
 	}
-
-	gitRoot, err := GetGitRootDir()
-	if err != nil {
+	if err := validateReleaseCommit(config); err != nil {
 		return err
 	}
-
-	results, err := ParseReleaseTargets(config.Directories, config.DirGroups, config.Targets, gitRoot)
+	repo, err := config.repository()
 	if err != nil {
 		return err
 	}
-	// An empty target list selects the full repository.
-	if len(results) == 0 {
-		results = append(results, DirectoryVersionInfo{FullPath: gitRoot})
+	config.Repository = repo
+	// A dry run makes no tag, so it needs no key.
+	var key string
+	if config.Sign && !config.Snapshot && !config.DryRun {
+		if key, err = repo.SigningKey(ctx); err != nil {
+			return err
+		}
 	}
 
-	head, err := headCommit()
-	if err != nil {
-		return err
-	}
+	// lostTags holds the tags of each target that another run pushed first.
+	lostTags := map[int][]string{}
+	for attempt := 0; ; attempt++ {
+		results, err := AnalyzeReleases(ctx, config)
+		if err != nil {
+			return err
+		}
+		if config.Explain {
+			if err := WriteExplanations(os.Stderr, results); err != nil {
+				return fmt.Errorf("can not write the explanations: %w", err)
+			}
+		}
+		if err := BlockedError(results); err != nil {
+			return err
+		}
 
-	run := &tagger{config: config, rules: rules, head: head}
-	for idx := range results {
-		results[idx].LastVersion, err = run.latestVersion(results[idx])
+		if config.Snapshot {
+			outputs, err := GenerateOutputs(results, true)
+			if err != nil {
+				return err
+			}
+			return writeOutputs(config, outputs)
+		}
+
+		release, err := planTags(config, annotation, results)
 		if err != nil {
 			return err
 		}
-		if err := run.analyzeCommits(&results[idx]); err != nil {
+		if !config.DryRun && len(release.newTags) > 0 {
+			err := release.preflight(ctx, repo, config)
+			if release.lostRace(err, config, attempt, lostTags) {
+				config.FetchTags = true
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		// Every error from the release commit to the push restores the local
+		// tags and the branch.
+		journal := newTagJournal(repo)
+		if config.ReleaseCommit {
+			if err := commitRelease(ctx, repo, config, journal, results, &release); err != nil {
+				return journal.fail(ctx, err)
+			}
+		}
+		if err := release.make(ctx, repo, journal, config.DryRun); err != nil {
+			return journal.fail(ctx, err)
+		}
+		if config.Sign && !config.DryRun {
+			if err := release.readSigningKeys(ctx, repo, key, results); err != nil {
+				return journal.fail(ctx, err)
+			}
+		}
+		for idx := range results {
+			results[idx].LostTags = lostTags[idx]
+		}
+
+		outputs, err := GenerateOutputs(results, config.DryRun)
+		if err != nil {
+			return journal.fail(ctx, err)
+		}
+
+		// Push after all local tags exist so that an earlier error cannot publish a
+		// partial result.
+		var pushes []remotePush
+		if !config.DryRun && len(release.newTags) > 0 {
+			pushes, err = release.push(ctx, repo, config)
+			if release.lostRace(err, config, attempt, lostTags) {
+				if err := journal.rollback(ctx); err != nil {
+					return fmt.Errorf("can not restore the local tags: %w", err)
+				}
+				config.FetchTags = true
+				continue
+			}
+			if err != nil {
+				return journal.fail(ctx, err)
+			}
+		}
+
+		// The primary remote holds the tags now, so a failed mirror keeps
+		// the local tags and still writes the outputs.
+		outputs.NewReleaseRemotePushes = remotePushesOutput(config, pushes)
+		if err := writeOutputs(config, outputs); err != nil {
 			return err
 		}
+		if config.DryRun {
+			return mirrorError(config, pushes)
+		}
+		return errors.Join(mirrorError(config, pushes), policyError(results))
 	}
+}
 
-	var newTags []string
-	var shortTags []string
-	for _, result := range results {
-		if result.NextVersion == nil ||
-			result.LastVersion.Version.FormattedString() == result.NextVersion.Version.FormattedString() {
+// planTags works out the tags of every target with a new version. It makes
+// no tag, so the checks before tagging can see every tag first.
+func planTags(config Config, annotation annotationTemplate, results []DirectoryVersionInfo) (releaseTags, error) {
+	release := releaseTags{targets: map[int]string{}, commits: map[string]string{}}
+	for idx, result := range results {
+		if !result.hasNewVersion() {
 			logging.Log.Info(fmt.Sprintf("No new version for: %s", result.Printable()))
 			continue
 		}
 
-		tag := tagFor(result.NextVersion)
+		tag, err := tagFor(result.NextVersion)
+		if err != nil {
+			return releaseTags{}, err
+		}
+		switch result.Policy {
+		case PolicyBlock:
+			logging.Log.Warn(fmt.Sprintf("A policy blocks the new version: %s", tag))
+			continue
+		case PolicyDryRun:
+			logging.Log.Info(fmt.Sprintf("A policy makes a dry run; we would be tagging a new version: %s", tag))
+			continue
+		}
 
-		if config.DryRun {
-			logging.Log.Info(fmt.Sprintf("We would be tagging a new version: %s", tag))
+		message, err := annotation.message(result, tag)
+		if err != nil {
+			return releaseTags{}, err
+		}
+		options := TagOptions{Message: message, Sign: config.Sign}
+
+		if result.AlreadyReleased {
+			// The tag exists. Pushing it again completes an earlier run whose
+			// push failed.
+			logging.Log.Info(fmt.Sprintf("Keeping the release at HEAD: %s", tag))
 		} else {
-			logging.Log.Info(fmt.Sprintf("Tagging new version: %s", tag))
-			if err := createTag(tag); err != nil {
-				return err
-			}
+			release.changes = append(release.changes, tagChange{
+				tag: tag, commit: result.NextVersion.CommitHash, options: options,
+			})
 		}
-		newTags = append(newTags, tag)
+		release.targets[idx] = tag
+		release.commits[tag] = result.NextVersion.CommitHash
+		release.newTags = append(release.newTags, tag)
 
 		if config.ShortVersions {
-			for _, shortTag := range shortTagsFor(result.NextVersion) {
-				if config.DryRun {
-					logging.Log.Info(fmt.Sprintf("We would be updating a short version tag: %s", shortTag))
-				} else {
-					logging.Log.Info(fmt.Sprintf("Updating short version tag: %s", shortTag))
-					if err := updateTag(shortTag); err != nil {
-						return err
-					}
-				}
-				shortTags = append(shortTags, shortTag)
+			resultShortTags, err := shortTagsFor(result.NextVersion)
+			if err != nil {
+				return releaseTags{}, err
+			}
+			for _, shortTag := range resultShortTags {
+				release.changes = append(release.changes, tagChange{
+					tag: shortTag, commit: result.NextVersion.CommitHash, options: options, short: true,
+				})
+				release.shortTags = append(release.shortTags, shortTag)
 			}
 		}
 	}
+	return release, nil
+}
 
-	outputs, err := GenerateOutputs(results, config.DryRun)
+// make makes the local tags of the release, and the journal records each tag
+// before its change. A dry run only logs the tags it would make.
+func (r releaseTags) make(ctx context.Context, repo Repository, journal *tagJournal, dryRun bool) error {
+	for _, change := range r.changes {
+		switch {
+		case dryRun && change.short:
+			logging.Log.Info(fmt.Sprintf("We would be updating a short version tag: %s", change.tag))
+			continue
+		case dryRun:
+			logging.Log.Info(fmt.Sprintf("We would be tagging a new version: %s", change.tag))
+			continue
+		case change.short:
+			logging.Log.Info(fmt.Sprintf("Updating short version tag: %s", change.tag))
+		default:
+			logging.Log.Info(fmt.Sprintf("Tagging new version: %s", change.tag))
+		}
+		if err := journal.record(ctx, change.tag); err != nil {
+			return err
+		}
+		var err error
+		if change.short {
+			err = repo.UpdateTag(ctx, change.tag, change.commit, change.options)
+		} else {
+			err = repo.CreateTag(ctx, change.tag, change.commit, change.options)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSigningKeys gives each target with a new tag the key that signed the
+// tag. A signature that does not name its key, such as an X.509 signature,
+// gives the configured key.
+func (r releaseTags) readSigningKeys(ctx context.Context, repo Repository, key string, results []DirectoryVersionInfo) error {
+	for idx, tag := range r.targets {
+		if results[idx].AlreadyReleased {
+			continue
+		}
+		signer, err := repo.TagSigner(ctx, tag)
+		if err != nil {
+			return fmt.Errorf("can not read the key that signed %s: %w", tag, err)
+		}
+		if signer == "" {
+			signer = key
+		}
+		results[idx].SigningKey = signer
+	}
+	return nil
+}
+
+// AnalyzeReleases works out the last and next version of every release target
+// and never makes a tag. With FetchTags or Deepen, it fetches from the remote
+// first. A target that can not release, such as one with an unapproved
+// breaking change, keeps its last version and gives the reason in Blocked;
+// BlockedError joins these reasons. A snapshot configuration also gives each
+// target its snapshot version. It analyzes up to config.Jobs targets at a
+// time, and the results keep the target order.
+func AnalyzeReleases(ctx context.Context, config Config) ([]DirectoryVersionInfo, error) {
+	results, run, err := prepareRun(ctx, config)
 	if err != nil {
+		return nil, err
+	}
+
+	// The tags are read before the workers start, so they share one list.
+	if err := run.loadTags(ctx); err != nil {
+		return nil, err
+	}
+	err = forEachTarget(ctx, config.Jobs, len(results), func(ctx context.Context, idx int) error {
+		var err error
+		results[idx].LastVersion, err = run.latestVersion(ctx, results[idx])
 		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := run.deepen(ctx, results); err != nil {
+		return nil, err
+	}
+	for idx := range results {
+		if err := run.findRelease(ctx, &results[idx]); err != nil {
+			return nil, err
+		}
+	}
+	if err := run.loadHistory(ctx, results); err != nil {
+		return nil, err
+	}
+	err = forEachTarget(ctx, config.Jobs, len(results), func(ctx context.Context, idx int) error {
+		return run.analyzeCommits(ctx, &results[idx])
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Push after all local tags exist so that an earlier error cannot publish a
-	// partial result.
-	if !config.DryRun && len(newTags) > 0 {
-		if err := pushTags(config.Remote, config.Branch, config.Atomic, newTags, shortTags); err != nil {
-			return err
+	if config.Snapshot {
+		if err := run.snapshotVersions(ctx, results); err != nil {
+			return nil, err
+		}
+	} else if err := run.applyPolicies(ctx, results); err != nil {
+		return nil, err
+	}
+	if config.Explain {
+		if err := run.explain(ctx, results); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// prepareRun checks the configuration and reads the release targets of one
+// run. It gives a tagger that has not read any tag or commit yet.
+func prepareRun(ctx context.Context, config Config) ([]DirectoryVersionInfo, *tagger, error) {
+	rules, err := newBumpRules(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	identifiers, err := newIdentifierTemplates(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := validateSnapshotFormat(config.SnapshotFormat); err != nil {
+		return nil, nil, err
+	}
+	if err := validateSignedCommits(config); err != nil {
+		return nil, nil, err
+	}
+	policies, err := newReleasePolicies(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	repo, err := config.repository()
+	if err != nil {
+		return nil, nil, err
+	}
+	verifier, err := newSignatureVerifier(repo, config.TrustedSigners)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	gitRoot, err := repo.Root(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results, err := ParseReleaseTargets(config.Directories, config.DirGroups, config.Targets, gitRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+	// An empty target list selects the full repository.
+	if len(results) == 0 {
+		results = append(results, DirectoryVersionInfo{FullPath: gitRoot})
+	}
+	for idx := range results {
+		if results[idx].TagFormat == "" {
+			results[idx].TagFormat = config.TagFormat
+		}
+		if err := validateTagFormat(results[idx]); err != nil {
+			return nil, nil, fmt.Errorf("package %q: %w", results[idx].PackageName(), err)
+		}
+	}
+
+	head, err := repo.Head(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	run := &tagger{
+		repo:        repo,
+		config:      config,
+		rules:       rules,
+		identifiers: identifiers,
+		policies:    policies,
+		approvers:   approverList(config.BreakingApprovers),
+		verifier:    verifier,
+		root:        gitRoot,
+		head:        head,
+	}
+	if config.FetchTags {
+		if err := run.fetchTags(ctx); err != nil {
+			return nil, nil, err
 		}
 	}
+	if err := run.checkShallow(ctx); err != nil {
+		return nil, nil, err
+	}
+	if identifiers.usesData {
+		run.headData, err = headIdentifierData(ctx, repo, head)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return results, run, nil
+}
+
+// forEachTarget runs work for each target index with at most jobs calls at a
+// time. The first error cancels the context of the other calls, and it is
+// the error that forEachTarget gives.
+func forEachTarget(ctx context.Context, jobs int, count int, work func(context.Context, int) error) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	indexes := make(chan int)
+	var workers sync.WaitGroup
+	for worker := 0; worker < min(max(jobs, 1), count); worker++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for idx := range indexes {
+				if err := work(ctx, idx); err != nil {
+					cancel(err)
+				}
+			}
+		}()
+	}
+
+feed:
+	for idx := 0; idx < count; idx++ {
+		select {
+		case indexes <- idx:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	workers.Wait()
+	return context.Cause(ctx)
+}
 
+// writeOutputs writes the outputs of one run in the forms that the
+// configuration selects.
+func writeOutputs(config Config, outputs Outputs) error {
 	if config.GithubAction {
 		SetGithubActionOutputs(outputs)
 	}
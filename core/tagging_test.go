@@ -1,12 +1,14 @@
 package core
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/catalystcommunity/app-utils-go/logging"
@@ -20,6 +22,12 @@ import (
 // two services and one library that both services share.
 type TaggingSuite struct {
 	suite.Suite
+	// backend is the git backend of every run. Each backend must give the
+	// same results.
+	backend string
+	// jobs is the number of targets that each run analyzes at a time. Each
+	// value must give the same results.
+	jobs        int
 	repoDir     string
 	previousDir string
 	commitCount int
@@ -30,6 +38,14 @@ func TestTaggingSuite(t *testing.T) {
 	suite.Run(t, new(TaggingSuite))
 }
 
+func TestNativeTaggingSuite(t *testing.T) {
+	suite.Run(t, &TaggingSuite{backend: GitBackendNative})
+}
+
+func TestParallelTaggingSuite(t *testing.T) {
+	suite.Run(t, &TaggingSuite{jobs: 4})
+}
+
 func (s *TaggingSuite) SetupTest() {
 	previousDir, err := os.Getwd()
 	require.NoError(s.T(), err)
@@ -68,6 +84,23 @@ func (s *TaggingSuite) git(args ...string) {
 	require.NoError(s.T(), err, "git %v failed: %s", args, string(output))
 }
 
+// addRemote makes a bare repository and adds it as the origin remote.
+func (s *TaggingSuite) addRemote() string {
+	remoteDir := filepath.Join(s.T().TempDir(), "remote.git")
+	command := exec.Command("git", "init", "-q", "--bare", remoteDir)
+	require.NoError(s.T(), command.Run())
+	s.git("remote", "add", "origin", remoteDir)
+	return remoteDir
+}
+
+func (s *TaggingSuite) gitOutput(args ...string) string {
+	command := exec.Command("git", args...)
+	command.Dir = s.repoDir
+	output, err := command.Output()
+	require.NoError(s.T(), err, "git %v failed", args)
+	return string(output)
+}
+
 func (s *TaggingSuite) write(relativePath string, content string) {
 	fullPath := filepath.Join(s.repoDir, relativePath)
 	require.NoError(s.T(), os.WriteFile(fullPath, []byte(content+"\n"), 0o644))
@@ -123,6 +156,24 @@ func (s *TaggingSuite) targetDryRun(targets []TargetConfig) Outputs {
 	})
 }
 
+func (s *TaggingSuite) doTagging(config Config) error {
+	config.GitBackend = s.backend
+	config.Jobs = s.jobs
+	return DoTagging(context.Background(), config)
+}
+
+func (s *TaggingSuite) migrateTags(config Config) ([]TagMigration, error) {
+	config.GitBackend = s.backend
+	config.Jobs = s.jobs
+	return MigrateTags(context.Background(), config)
+}
+
+func (s *TaggingSuite) verifyTags(config Config) ([]TagVerification, error) {
+	config.GitBackend = s.backend
+	config.Jobs = s.jobs
+	return VerifyTags(context.Background(), config)
+}
+
 func (s *TaggingSuite) runTagging(config Config) Outputs {
 	previousStdout := os.Stdout
 	capturePath := filepath.Join(s.T().TempDir(), "outputs.json")
@@ -130,7 +181,7 @@ func (s *TaggingSuite) runTagging(config Config) Outputs {
 	require.NoError(s.T(), err)
 	os.Stdout = captureFile
 
-	taggingErr := DoTagging(config)
+	taggingErr := s.doTagging(config)
 
 	os.Stdout = previousStdout
 	require.NoError(s.T(), captureFile.Close())
@@ -462,7 +513,7 @@ func (s *TaggingSuite) TestShortVersionsMoveMajorAndMinorTags() {
 }
 
 func (s *TaggingSuite) TestShortVersionFlagsCannotConflict() {
-	err := DoTagging(Config{ShortVersions: true, SkipShortVersions: true})
+	err := s.doTagging(Config{ShortVersions: true, SkipShortVersions: true})
 
 	require.Error(s.T(), err)
 	assert.Contains(s.T(), err.Error(), "cannot both be true")
@@ -765,3 +816,1136 @@ func (s *TaggingSuite) TestCiAndPerfCommitsRelease() {
 	assert.Equal(s.T(), "true", outputs.NewReleasePublished)
 	assert.Equal(s.T(), "api/v1.0.1", outputs.NewReleaseGitTag)
 }
+
+func (s *TaggingSuite) TestIdentifierTemplatesUseGitAndRunContext() {
+	s.T().Setenv("PR_NUMBER", "482")
+	s.write("services/api/file.txt", "api change")
+	s.commit("feat: new api endpoint")
+	s.write("services/api/file.txt", "another api change")
+	s.commit("fix: api change")
+
+	outputs := s.runTagging(Config{
+		DryRun:           true,
+		OutputJson:       true,
+		PreReleaseString: `pr.{{.Env "PR_NUMBER"}}.{{.CommitCount}}`,
+		BuildString:      "g{{.ShortSHA}}.{{.Date}}",
+		Directories:      []string{"services/api"},
+	})
+
+	shortSHA := strings.TrimSpace(s.gitOutput("rev-parse", "--short", "HEAD"))
+	assert.Equal(s.T(), "api/v1.0.0-pr.482.2+g"+shortSHA+".20260101", outputs.NewReleaseGitTag)
+}
+
+func (s *TaggingSuite) TestIdentifierFunctionCleansTheBranchName() {
+	s.git("checkout", "-q", "-b", "feature/new-thing")
+	s.write("services/api/file.txt", "api change")
+	s.commit("fix: api change")
+
+	outputs := s.runTagging(Config{
+		DryRun:           true,
+		OutputJson:       true,
+		PreReleaseString: "{{identifier .Branch}}",
+		Directories:      []string{"services/api"},
+	})
+
+	assert.Equal(s.T(), "api/v1.0.0-feature-new-thing.1", outputs.NewReleaseGitTag)
+}
+
+func (s *TaggingSuite) TestInvalidRenderedIdentifierIsAnError() {
+	s.git("checkout", "-q", "-b", "feature/new-thing")
+	s.write("services/api/file.txt", "api change")
+	s.commit("fix: api change")
+
+	err := s.doTagging(Config{
+		DryRun:           true,
+		PreReleaseString: "{{.Branch}}",
+		Directories:      []string{"services/api"},
+	})
+
+	require.Error(s.T(), err)
+	assert.Contains(s.T(), err.Error(), "invalid identifier")
+}
+
+func (s *TaggingSuite) TestGoSnapshotVersionUsesTheNextVersionAndHead() {
+	s.write("services/api/file.txt", "api change")
+	s.commit("feat: new api endpoint")
+
+	outputs := s.runTagging(Config{
+		OutputJson:     true,
+		Snapshot:       true,
+		SnapshotFormat: SnapshotFormatGo,
+		Directories:    []string{"services/api", "services/worker"},
+	})
+
+	assert.Equal(
+		s.T(),
+		"api/v1.1.0-0.20260101000200-"+s.headCommit()[:12]+",worker/v2.0.1-0.20260101000200-"+s.headCommit()[:12],
+		outputs.SnapshotVersion,
+	)
+	assert.Equal(s.T(), "true,true", outputs.DryRun)
+	assert.Empty(s.T(), s.gitOutput("tag", "--list", "api/v1.1.0"))
+}
+
+func (s *TaggingSuite) TestDescribeSnapshotVersionCountsCommitsSinceTheLastTag() {
+	s.write("services/api/file.txt", "api change")
+	s.commit("fix: api change")
+	s.write("services/worker/file.txt", "worker change")
+	s.commit("fix: worker change")
+
+	outputs := s.runTagging(Config{
+		OutputJson:     true,
+		Snapshot:       true,
+		SnapshotFormat: SnapshotFormatDescribe,
+		Directories:    []string{"services/api"},
+	})
+
+	shortSHA := strings.TrimSpace(s.gitOutput("rev-parse", "--short", "HEAD"))
+	assert.Equal(s.T(), "api/v1.0.0-2-g"+shortSHA, outputs.SnapshotVersion)
+}
+
+func (s *TaggingSuite) TestDescribeSnapshotVersionOfAnUntaggedTargetIsTheCommit() {
+	s.write("libs/shared/file.txt", "shared change")
+	s.commit("feat: change the shared library")
+
+	outputs := s.runTagging(Config{
+		OutputJson:     true,
+		Snapshot:       true,
+		SnapshotFormat: SnapshotFormatDescribe,
+		Directories:    []string{"libs/shared"},
+	})
+
+	shortSHA := strings.TrimSpace(s.gitOutput("rev-parse", "--short", "HEAD"))
+	assert.Equal(s.T(), shortSHA, outputs.SnapshotVersion)
+}
+
+func (s *TaggingSuite) TestSnapshotFormatMustBeKnown() {
+	err := s.doTagging(Config{Snapshot: true, SnapshotFormat: "calver"})
+
+	require.Error(s.T(), err)
+	assert.Contains(s.T(), err.Error(), `snapshot format "calver"`)
+}
+
+func (s *TaggingSuite) TestTagFormatRendersAndReadsTagsWithoutThePrefix() {
+	s.git("tag", "release-1.4.2")
+	s.write("services/api/file.txt", "api change")
+	s.commit("feat: new api endpoint")
+
+	outputs := s.runTagging(Config{
+		DryRun:     true,
+		OutputJson: true,
+		TagFormat:  "release-{{.Version}}",
+	})
+
+	assert.Equal(s.T(), "release-1.4.2", outputs.LastReleaseGitTag)
+	assert.Equal(s.T(), "release-1.5.0", outputs.NewReleaseGitTag)
+}
+
+func (s *TaggingSuite) TestTargetTagFormatReadsNpmStyleTags() {
+	s.git("tag", "@scope/api@2.3.4")
+	s.git("tag", "@scope/worker@9.0.0")
+	s.write("services/api/file.txt", "api change")
+	s.commit("fix: api change")
+
+	outputs := s.targetDryRun([]TargetConfig{{
+		Name:      "api",
+		Paths:     []string{"services/api"},
+		TagFormat: "@scope/{{.Package}}@{{.Version}}",
+	}})
+
+	assert.Equal(s.T(), "@scope/api@2.3.4", outputs.LastReleaseGitTag)
+	assert.Equal(s.T(), "@scope/api@2.3.5", outputs.NewReleaseGitTag)
+	assert.Equal(s.T(), "2.3.5", outputs.NewReleaseVersion)
+}
+
+func (s *TaggingSuite) TestShortVersionTagsFollowTheTagFormat() {
+	remoteDir := s.addRemote()
+	s.git("tag", "api-1.3.6")
+	s.write("services/api/file.txt", "api change")
+	s.commit("fix: api change")
+
+	outputs := s.runTagging(Config{
+		OutputJson:    true,
+		Atomic:        true,
+		Remote:        "origin",
+		ShortVersions: true,
+		TagFormat:     "{{.Package}}-{{.Version}}",
+		Directories:   []string{"services/api"},
+	})
+
+	assert.Equal(s.T(), "api-1.3.7", outputs.NewReleaseGitTag)
+	for _, tag := range []string{"api-1.3.7", "api-1.3", "api-1"} {
+		check := exec.Command("git", "--git-dir", remoteDir, "rev-parse", "refs/tags/"+tag)
+		content, err := check.Output()
+		require.NoError(s.T(), err, tag)
+		assert.Equal(s.T(), s.headCommit(), string(content[:40]))
+	}
+}
+
+func (s *TaggingSuite) TestTagFormatMustUseTheVersionOneTime() {
+	err := s.doTagging(Config{
+		DryRun:      true,
+		TagFormat:   "{{.Package}}",
+		Directories: []string{"services/api"},
+	})
+
+	require.Error(s.T(), err)
+	assert.Contains(s.T(), err.Error(), "exactly one time")
+}
+
+func (s *TaggingSuite) TestRenamedTargetKeepsItsVersionSeries() {
+	s.git("tag", "old-api/v3.1.0")
+	s.write("services/api/file.txt", "api change")
+	s.commit("fix: api change")
+
+	outputs := s.targetDryRun([]TargetConfig{{
+		Name:          "public-api",
+		Paths:         []string{"services/api"},
+		PreviousNames: []string{"old-api"},
+	}})
+
+	assert.Equal(s.T(), "public-api/v3.1.0", outputs.LastReleaseGitTag)
+	assert.Equal(s.T(), "public-api/v3.1.1", outputs.NewReleaseGitTag)
+}
+
+func (s *TaggingSuite) TestPreviousNameCanNotBelongToAnotherTarget() {
+	_, err := ParseReleaseTargets(nil, nil, []TargetConfig{
+		{Name: "public-api", Paths: []string{"services/api"}, PreviousNames: []string{"worker"}},
+		{Name: "worker", Paths: []string{"services/worker"}},
+	}, s.repoDir)
+
+	require.Error(s.T(), err)
+	assert.Contains(s.T(), err.Error(), `previous name "worker"`)
+}
+
+func (s *TaggingSuite) TestMigrateTagsCopiesTheLatestPreviousVersion() {
+	remoteDir := s.addRemote()
+	firstHead := s.headCommit()
+	s.git("tag", "old-api/v3.0.0")
+	s.write("services/api/file.txt", "api change")
+	s.commit("fix: api change")
+	s.git("tag", "old-api/v3.1.0")
+	s.git("tag", "old-api/v2.9.0", firstHead)
+
+	migrations, err := s.migrateTags(Config{
+		Atomic: true,
+		Remote: "origin",
+		Targets: []TargetConfig{{
+			Name:          "public-api",
+			Paths:         []string{"services/api"},
+			PreviousNames: []string{"old-api"},
+		}},
+	})
+
+	require.NoError(s.T(), err)
+	require.Len(s.T(), migrations, 1)
+	assert.Equal(s.T(), "old-api/v3.1.0", migrations[0].FromTag)
+	assert.Equal(s.T(), "public-api/v3.1.0", migrations[0].Tag)
+	assert.True(s.T(), migrations[0].Migrated)
+	check := exec.Command("git", "--git-dir", remoteDir, "rev-parse", "refs/tags/public-api/v3.1.0")
+	content, err := check.Output()
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), s.headCommit(), string(content[:40]))
+
+	// A second migration finds the new tag and does nothing.
+	migrations, err = s.migrateTags(Config{
+		Atomic: true,
+		Remote: "origin",
+		Targets: []TargetConfig{{
+			Name:          "public-api",
+			Paths:         []string{"services/api"},
+			PreviousNames: []string{"old-api"},
+		}},
+	})
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), migrations)
+}
+
+func (s *TaggingSuite) TestMigrateTagsUsesTheAnnotationTemplate() {
+	s.addRemote()
+	s.git("tag", "old-api/v3.0.0")
+
+	_, err := s.migrateTags(Config{
+		Atomic:             true,
+		Remote:             "origin",
+		Annotate:           true,
+		AnnotationTemplate: "{{.Package}} {{.Version}} from {{.PreviousTag}}",
+		Targets: []TargetConfig{{
+			Name:          "public-api",
+			Paths:         []string{"services/api"},
+			PreviousNames: []string{"old-api"},
+		}},
+	})
+
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "tag\n", s.gitOutput("cat-file", "-t", "public-api/v3.0.0"))
+	assert.Equal(s.T(), "public-api 3.0.0 from old-api/v3.0.0\n\n", s.gitOutput("tag", "--list", "--format=%(contents)", "public-api/v3.0.0"))
+}
+
+func (s *TaggingSuite) TestAnnotateMakesAnAnnotatedTagWithTheNotes() {
+	s.addRemote()
+	s.write("services/api/file.txt", "api change")
+	s.commit("fix: api change (#12)")
+
+	outputs := s.runTagging(Config{
+		OutputJson:    true,
+		Atomic:        true,
+		Remote:        "origin",
+		Annotate:      true,
+		ShortVersions: true,
+		Directories:   []string{"services/api"},
+	})
+
+	assert.Equal(s.T(), "api/v1.0.1", outputs.NewReleaseGitTag)
+	for _, tag := range []string{"api/v1.0.1", "api/v1.0", "api/v1"} {
+		assert.Equal(s.T(), "tag\n", s.gitOutput("cat-file", "-t", tag), tag)
+	}
+	assert.Equal(
+		s.T(),
+		"api/v1.0.1\n\n- fix: api change (#12)\n\n",
+		s.gitOutput("tag", "--list", "--format=%(contents)", "api/v1.0.1"),
+	)
+}
+
+func (s *TaggingSuite) TestAnnotationTemplateReadsThePreviousTag() {
+	s.addRemote()
+	s.write("services/api/file.txt", "api change")
+	s.commit("feat: api change")
+
+	s.runTagging(Config{
+		OutputJson:         true,
+		Remote:             "origin",
+		Annotate:           true,
+		AnnotationTemplate: "{{.Package}} {{.Version}} follows {{.PreviousTag}}",
+		Directories:        []string{"services/api"},
+	})
+
+	assert.Equal(
+		s.T(),
+		"api 1.1.0 follows api/v1.0.0\n\n",
+		s.gitOutput("tag", "--list", "--format=%(contents)", "api/v1.1.0"),
+	)
+}
+
+// An annotated tag gives the commit it points at, not the tag object.
+func (s *TaggingSuite) TestAnnotatedTagIsPeeledToItsCommit() {
+	s.git("tag", "--annotate", "--message", "release", "api/v1.5.0")
+	s.write("services/api/file.txt", "api change")
+	s.commit("fix: api change")
+
+	outputs := s.tagDryRun([]string{"services/api"}, nil)
+
+	assert.Equal(s.T(), "api/v1.5.0", outputs.LastReleaseGitTag)
+	assert.Equal(s.T(), strings.TrimSpace(s.gitOutput("rev-parse", "HEAD~1")), outputs.LastReleaseGitHead)
+	assert.Equal(s.T(), "api/v1.5.1", outputs.NewReleaseGitTag)
+}
+
+// useSSHSigningKey makes an SSH key and tells git to sign with it. It gives
+// the public key line.
+func (s *TaggingSuite) useSSHSigningKey() string {
+	if s.backend == GitBackendNative {
+		s.T().Skip("the native backend can not make or check signatures")
+	}
+	keyPath := filepath.Join(s.T().TempDir(), "signing_key")
+	command := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", "release@example.com", "-f", keyPath)
+	output, err := command.CombinedOutput()
+	require.NoError(s.T(), err, "ssh-keygen failed: %s", string(output))
+	s.git("config", "gpg.format", "ssh")
+	s.git("config", "user.signingkey", keyPath)
+	publicKey, err := os.ReadFile(keyPath + ".pub")
+	require.NoError(s.T(), err)
+	return strings.TrimSpace(string(publicKey))
+}
+
+func (s *TaggingSuite) TestSignMakesSignedFullAndShortTags() {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		s.T().Skip("ssh-keygen is not available")
+	}
+	publicKey := s.useSSHSigningKey()
+	s.addRemote()
+	s.write("services/api/file.txt", "api change")
+	s.commit("fix: api change")
+
+	outputs := s.runTagging(Config{
+		OutputJson:    true,
+		Atomic:        true,
+		Remote:        "origin",
+		Sign:          true,
+		ShortVersions: true,
+		Directories:   []string{"services/worker", "services/api"},
+	})
+
+	// The output names the key of the signature, without the comment of the
+	// public key line.
+	keyType, keyData, _ := strings.Cut(publicKey, " ")
+	keyData, _, _ = strings.Cut(keyData, " ")
+	assert.Equal(s.T(), ","+keyType+" "+keyData, outputs.NewReleaseSigningKey)
+	for _, tag := range []string{"api/v1.0.1", "api/v1.0", "api/v1"} {
+		assert.Contains(s.T(), s.gitOutput("cat-file", "tag", tag), "-----BEGIN SSH SIGNATURE-----", tag)
+	}
+}
+
+func (s *TaggingSuite) TestSignedDryRunNeedsNoKey() {
+	s.git("config", "gpg.format", "ssh")
+	s.write("services/api/file.txt", "api change")
+	s.commit("fix: api change")
+
+	outputs := s.runTagging(Config{
+		DryRun:            true,
+		OutputJson:        true,
+		SkipShortVersions: true,
+		Sign:              true,
+		Directories:       []string{"services/api"},
+	})
+
+	assert.Equal(s.T(), "api/v1.0.1", outputs.NewReleaseGitTag)
+	assert.Empty(s.T(), outputs.NewReleaseSigningKey)
+}
+
+func (s *TaggingSuite) TestSignFailsBeforeTaggingWithoutAKey() {
+	s.git("config", "gpg.format", "ssh")
+	s.write("services/api/file.txt", "api change")
+	s.commit("fix: api change")
+
+	err := s.doTagging(Config{
+		SkipShortVersions: true,
+		Sign:              true,
+		Directories:       []string{"services/api"},
+	})
+
+	require.Error(s.T(), err)
+	if s.backend == GitBackendNative {
+		assert.ErrorIs(s.T(), err, errNativeSignatures)
+	} else {
+		assert.Contains(s.T(), err.Error(), "user.signingkey")
+	}
+	assert.Empty(s.T(), s.gitOutput("tag", "--list", "api/v1.0.1"))
+}
+
+// allowedSigners writes an SSH allowed-signers file for one public key.
+func (s *TaggingSuite) allowedSigners(publicKey string) string {
+	path := filepath.Join(s.T().TempDir(), "allowed_signers")
+	require.NoError(s.T(), os.WriteFile(path, []byte("release@example.com "+publicKey+"\n"), 0o644))
+	return path
+}
+
+func (s *TaggingSuite) TestTrustedSignersIgnoreUnsignedAndUntrustedTags() {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		s.T().Skip("ssh-keygen is not available")
+	}
+	trustedKey := s.useSSHSigningKey()
+	s.git("tag", "--sign", "--message", "release", "api/v1.2.0")
+	s.useSSHSigningKey()
+	s.git("tag", "--sign", "--message", "release", "api/v8.0.0")
+	s.git("tag", "api/v9.0.0")
+	s.write("services/api/file.txt", "api change")
+	s.commit("fix: api change")
+
+	outputs := s.runTagging(Config{
+		DryRun:         true,
+		OutputJson:     true,
+		TrustedSigners: s.allowedSigners(trustedKey),
+		Directories:    []string{"services/api"},
+	})
+
+	assert.Equal(s.T(), "api/v1.2.0", outputs.LastReleaseGitTag)
+	assert.Equal(s.T(), "api/v1.2.1", outputs.NewReleaseGitTag)
+}
+
+func (s *TaggingSuite) TestVerifyTagsReportsEveryVersionTag() {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		s.T().Skip("ssh-keygen is not available")
+	}
+	trustedKey := s.useSSHSigningKey()
+	s.git("tag", "--sign", "--message", "release", "api/v1.2.0")
+	s.useSSHSigningKey()
+	s.git("tag", "--sign", "--message", "release", "api/v1.3.0")
+
+	verifications, err := s.verifyTags(Config{
+		TrustedSigners: s.allowedSigners(trustedKey),
+		Directories:    []string{"services/api"},
+	})
+
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), []TagVerification{
+		{Package: "api", Tag: "api/v1.0.0", Trust: TagUnsigned},
+		{Package: "api", Tag: "api/v1.2.0", Trust: TagTrusted},
+		{Package: "api", Tag: "api/v1.3.0", Trust: TagUntrusted},
+	}, verifications)
+}
+
+// signedCommit makes one commit with the configured signing key.
+func (s *TaggingSuite) signedCommit(message string) {
+	s.git("config", "commit.gpgsign", "true")
+	s.commit(message)
+	s.git("config", "commit.gpgsign", "false")
+}
+
+func (s *TaggingSuite) TestSignedCommitsIgnoreCountsOnlyTrustedCommits() {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		s.T().Skip("ssh-keygen is not available")
+	}
+	trustedKey := s.useSSHSigningKey()
+	s.git("tag", "--sign", "--message", "release", "api/v1.2.0")
+	s.write("services/api/feature.txt", "feature")
+	s.signedCommit("feat: signed feature")
+	s.write("services/api/breaking.txt", "breaking")
+	s.commit("feat!: unsigned breaking change")
+	unsigned := s.headCommit()
+
+	outputs := s.runTagging(Config{
+		DryRun:         true,
+		OutputJson:     true,
+		TrustedSigners: s.allowedSigners(trustedKey),
+		SignedCommits:  SignedCommitsIgnore,
+		Directories:    []string{"services/api"},
+	})
+
+	assert.Equal(s.T(), "api/v1.3.0", outputs.NewReleaseGitTag)
+	assert.Equal(s.T(), "feat!: unsigned breaking change [unverified]\nfeat: signed feature", outputs.NewReleaseNotes)
+	assert.Equal(s.T(), unsigned, outputs.NewReleaseUnverifiedCommits)
+}
+
+func (s *TaggingSuite) TestSignedCommitsIgnoreAKeyThatIsNotTrusted() {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		s.T().Skip("ssh-keygen is not available")
+	}
+	trustedKey := s.useSSHSigningKey()
+	s.git("tag", "--sign", "--message", "release", "api/v1.2.0")
+	s.write("services/api/feature.txt", "feature")
+	s.signedCommit("feat: signed feature")
+	// Git gives a good signature of a key that the allowed-signers file does
+	// not list the "U" state.
+	s.useSSHSigningKey()
+	s.write("services/api/breaking.txt", "breaking")
+	s.signedCommit("feat!: breaking change of another key")
+	untrusted := s.headCommit()
+	assert.Equal(s.T(), "U", strings.TrimSpace(s.gitOutput(
+		"-c", "gpg.ssh.allowedSignersFile="+s.allowedSigners(trustedKey), "log", "-1", "--format=%G?",
+	)))
+
+	for _, parallel := range []int{1, 2} {
+		outputs := s.runTagging(Config{
+			DryRun:         true,
+			OutputJson:     true,
+			TrustedSigners: s.allowedSigners(trustedKey),
+			SignedCommits:  SignedCommitsIgnore,
+			Jobs:           parallel,
+			Directories:    []string{"services/api", "services/worker"},
+		})
+
+		// The breaking change does not count, so api makes a minor release.
+		// The worker tag is not signed, so worker starts again.
+		assert.Equal(s.T(), "api/v1.3.0,worker/v0.1.0", outputs.NewReleaseGitTag)
+		assert.Equal(s.T(), untrusted, outputs.NewReleaseUnverifiedCommits)
+	}
+}
+
+func (s *TaggingSuite) TestSignedCommitsFailStopsOnAnUnverifiedCommit() {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		s.T().Skip("ssh-keygen is not available")
+	}
+	trustedKey := s.useSSHSigningKey()
+	s.git("tag", "--sign", "--message", "release", "api/v1.2.0")
+	s.write("services/api/file.txt", "api change")
+	s.commit("fix: unsigned change")
+
+	config := Config{
+		DryRun:         true,
+		TrustedSigners: s.allowedSigners(trustedKey),
+		SignedCommits:  SignedCommitsFail,
+		Directories:    []string{"services/api"},
+	}
+	err := s.doTagging(config)
+
+	var unverified *UnverifiedCommitError
+	require.ErrorAs(s.T(), err, &unverified)
+	assert.Contains(s.T(), err.Error(), "fix: unsigned change")
+
+	// The status reports the blocked target instead of failing.
+	config.GitBackend = s.backend
+	statuses, err := Status(context.Background(), config)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), statuses, 1)
+	assert.Equal(s.T(), BumpBlocked, statuses[0].Bump)
+	assert.Equal(s.T(), "1.2.0", statuses[0].NextVersion)
+	assert.Equal(s.T(), unverified.Error(), statuses[0].Blocked)
+}
+
+func (s *TaggingSuite) TestSignedCommitsNeedTrustedSigners() {
+	err := s.doTagging(Config{
+		DryRun:        true,
+		SignedCommits: SignedCommitsIgnore,
+		Directories:   []string{"services/api"},
+	})
+
+	require.Error(s.T(), err)
+	assert.Contains(s.T(), err.Error(), "trusted_signers")
+}
+
+func (s *TaggingSuite) TestNativeBackendTagsAndPushesWithoutGit() {
+	if s.backend != GitBackendNative {
+		s.T().Skip("only the native backend runs without git")
+	}
+	remoteDir := s.addRemote()
+	s.write("services/api/file.txt", "api change")
+	s.commit("fix: api change")
+
+	path := os.Getenv("PATH")
+	require.NoError(s.T(), os.Setenv("PATH", ""))
+	err := s.doTagging(Config{
+		Atomic:        true,
+		Remote:        "origin",
+		Branch:        "main",
+		ShortVersions: true,
+		Annotate:      true,
+		Directories:   []string{"services/api"},
+	})
+	require.NoError(s.T(), os.Setenv("PATH", path))
+
+	require.NoError(s.T(), err)
+	command := exec.Command("git", "for-each-ref", "--format=%(refname) %(objecttype)", "refs/tags/api", "refs/heads")
+	command.Dir = remoteDir
+	output, err := command.Output()
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), strings.Join([]string{
+		"refs/heads/main commit",
+		"refs/tags/api/v1 tag",
+		"refs/tags/api/v1.0 tag",
+		"refs/tags/api/v1.0.1 tag",
+	}, "\n")+"\n", string(output))
+}
+
+// merge merges one branch into the checked-out branch with a later date, like
+// commit.
+func (s *TaggingSuite) merge(branch string, args ...string) {
+	s.commitCount++
+	date := fmt.Sprintf("2026-01-01T00:%02d:00", s.commitCount)
+	command := exec.Command("git", append([]string{"merge", "-q", "--no-ff", "--no-edit"}, append(args, branch)...)...)
+	command.Dir = s.repoDir
+	command.Env = append(
+		os.Environ(),
+		"GIT_AUTHOR_DATE="+date,
+		"GIT_COMMITTER_DATE="+date,
+	)
+	output, err := command.CombinedOutput()
+	require.NoError(s.T(), err, "git merge failed: %s", string(output))
+}
+
+func (s *TaggingSuite) TestHistoryGivesTheCommitsOfEachTargetLog() {
+	if s.backend != "" {
+		s.T().Skip("only the exec backend reads the history in one pass")
+	}
+	first := s.headCommit()
+	s.git("checkout", "-q", "-b", "side")
+	s.write("services/worker/file.txt", "worker change")
+	s.commit("fix: worker change on a branch")
+	s.git("checkout", "-q", "main")
+	s.write("services/api/file.txt", "api change")
+	s.commit("feat: api change")
+	tagged := s.headCommit()
+	s.write("libs/shared/file.txt", "library change")
+	s.commit("fix: library change")
+	s.merge("side")
+	s.git("checkout", "-q", "-b", "ignored", tagged)
+	s.write("services/api/file.txt", "dropped api change")
+	s.commit("fix: api change that the merge drops")
+	s.git("checkout", "-q", "main")
+	s.merge("ignored", "-s", "ours")
+	s.write("services/worker/new.txt", "new file")
+	s.commit("feat: new worker file")
+
+	repo := NewGitRepository("")
+	head, err := repo.Head(context.Background())
+	require.NoError(s.T(), err)
+	history, err := repo.History(context.Background(), []string{first, tagged}, "")
+	require.NoError(s.T(), err)
+	index := newHistoryIndex(history)
+
+	for _, paths := range [][]string{
+		{"services/api"},
+		{"services/worker", "libs/shared"},
+		{":(top,literal)services/worker/new.txt"},
+		{":(top,literal)libs"},
+		{":(top)"},
+		{s.repoDir},
+		{"services/*"},
+		{"libs/*/file.txt"},
+		{"services/ap?"},
+		{"services/ap[a-z]/file.txt"},
+		{"services/ap[a-z]"},
+		{"services/[!a]*"},
+		{"services/[^w]*"},
+		{"servic?s/worker/*.txt"},
+	} {
+		for _, afterCommit := range []string{first, tagged} {
+			expected, err := repo.Commits(context.Background(), afterCommit, paths, "")
+			require.NoError(s.T(), err)
+			filter, err := newPathFilter(paths, s.repoDir, history.Dir)
+			require.NoError(s.T(), err)
+			actual, ok := index.commits(head, afterCommit, filter)
+			require.True(s.T(), ok)
+			assert.Equal(s.T(), expected, actual, "paths %v after %s", paths, afterCommit)
+			native, err := NewNativeRepository("").Commits(context.Background(), afterCommit, paths, "")
+			require.NoError(s.T(), err)
+			if len(expected) == 0 {
+				assert.Empty(s.T(), native, "native paths %v after %s", paths, afterCommit)
+			} else {
+				assert.Equal(s.T(), expected, native, "native paths %v after %s", paths, afterCommit)
+			}
+		}
+	}
+}
+
+func (s *TaggingSuite) TestCanceledRunStopsBeforeItTags() {
+	s.addRemote()
+	s.write("services/api/file.txt", "api change")
+	s.commit("fix: api change")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := DoTagging(ctx, Config{
+		GitBackend:        s.backend,
+		Jobs:              s.jobs,
+		Remote:            "origin",
+		SkipShortVersions: true,
+		Directories:       []string{"services/api", "services/worker"},
+	})
+
+	require.ErrorIs(s.T(), err, context.Canceled)
+	assert.NotContains(s.T(), s.gitOutput("tag", "--list"), "api/v1.0.1")
+}
+
+// shallowClone pushes main and every tag to a bare remote, clones the remote
+// with one commit of history and moves the test into the clone.
+func (s *TaggingSuite) shallowClone() {
+	remoteDir := s.addRemote()
+	s.git("push", "-q", "origin", "main", "--tags")
+	cloneDir := filepath.Join(s.T().TempDir(), "clone")
+	s.git("clone", "-q", "--depth", "1", "--branch", "main", "file://"+remoteDir, cloneDir)
+	s.repoDir = cloneDir
+	require.NoError(s.T(), os.Chdir(s.repoDir))
+}
+
+// addFillerCommits adds empty commits, so the tagged commits fall behind
+// the boundary of a shallow clone.
+func (s *TaggingSuite) addFillerCommits(count int) {
+	for range count {
+		s.git("commit", "-q", "--allow-empty", "-m", "chore: filler")
+	}
+}
+
+func (s *TaggingSuite) TestShallowCloneIsAnErrorWithoutDeepen() {
+	s.write("services/api/file.txt", "api change")
+	s.commit("fix: api change")
+	s.shallowClone()
+
+	err := s.doTagging(Config{
+		DryRun:      true,
+		Remote:      "origin",
+		Directories: []string{"services/api"},
+	})
+
+	require.ErrorContains(s.T(), err, "shallow clone")
+	require.ErrorContains(s.T(), err, "--deepen")
+}
+
+func (s *TaggingSuite) TestDeepenFetchesTheHistoryOfEveryLastVersion() {
+	if s.backend != "" {
+		s.T().Skip("only the exec backend can deepen a shallow clone")
+	}
+	s.write("services/worker/file.txt", "worker change")
+	s.commit("feat: worker change")
+	s.addFillerCommits(100)
+	s.write("services/api/file.txt", "api change")
+	s.commit("fix: api change")
+	expected := s.tagDryRun([]string{"services/api", "services/worker"}, nil)
+	s.shallowClone()
+
+	actual := s.runTagging(Config{
+		DryRun:      true,
+		OutputJson:  true,
+		Deepen:      true,
+		Remote:      "origin",
+		Directories: []string{"services/api", "services/worker"},
+	})
+
+	assert.Equal(s.T(), expected, actual)
+	assert.Equal(s.T(), "1.0.1,2.1.0", actual.NewReleaseVersion)
+	assert.Equal(s.T(), "false\n", s.gitOutput("rev-parse", "--is-shallow-repository"))
+}
+
+func (s *TaggingSuite) TestDeepenFetchesTheFullHistoryForAnUntaggedTarget() {
+	if s.backend != "" {
+		s.T().Skip("only the exec backend can deepen a shallow clone")
+	}
+	s.write("libs/shared/file.txt", "library change")
+	s.commit("fix: library change")
+	s.addFillerCommits(3)
+	expected := s.tagDryRun([]string{"services/api", "libs/shared"}, nil)
+	s.shallowClone()
+
+	actual := s.runTagging(Config{
+		DryRun:      true,
+		OutputJson:  true,
+		Deepen:      true,
+		Remote:      "origin",
+		Directories: []string{"services/api", "libs/shared"},
+	})
+
+	assert.Equal(s.T(), expected, actual)
+	assert.Equal(s.T(), "false\n", s.gitOutput("rev-parse", "--is-shallow-repository"))
+}
+
+// pushOtherRelease pushes a tag that the local repository does not hold, like
+// a release job on another machine.
+func (s *TaggingSuite) pushOtherRelease(tag string, commit string) {
+	s.git("push", "-q", "origin", commit+":refs/tags/"+tag)
+}
+
+func (s *TaggingSuite) TestFetchTagsReadsTheReleasesOfTheRemote() {
+	s.addRemote()
+	s.write("services/api/file.txt", "api change")
+	s.commit("feat: api change")
+	s.pushOtherRelease("api/v1.1.0", s.headCommit())
+	s.write("services/api/file.txt", "api fix")
+	s.commit("fix: api fix")
+
+	outputs := s.runTagging(Config{
+		DryRun:      true,
+		OutputJson:  true,
+		FetchTags:   true,
+		Remote:      "origin",
+		Directories: []string{"services/api"},
+	})
+
+	assert.Equal(s.T(), "api/v1.1.0", outputs.LastReleaseGitTag)
+	assert.Equal(s.T(), "api/v1.1.1", outputs.NewReleaseGitTag)
+}
+
+func (s *TaggingSuite) TestPushRetriesTagTheNextVersionAfterALostRace() {
+	s.addRemote()
+	s.write("services/api/file.txt", "api change")
+	s.commit("feat: api change")
+	other := s.headCommit()
+	s.pushOtherRelease("api/v1.1.0", other)
+	s.write("services/api/file.txt", "api fix")
+	s.commit("fix: api fix")
+
+	outputs := s.runTagging(Config{
+		OutputJson:        true,
+		Atomic:            true,
+		SkipShortVersions: true,
+		PushRetries:       2,
+		Remote:            "origin",
+		Branch:            "main",
+		Directories:       []string{"services/api"},
+	})
+
+	assert.Equal(s.T(), "api/v1.1.1", outputs.NewReleaseGitTag)
+	assert.Equal(s.T(), "api/v1.1.0", outputs.NewReleaseLostTags)
+	remoteTags := s.gitOutput("ls-remote", "--tags", "origin")
+	assert.Contains(s.T(), remoteTags, other+"\trefs/tags/api/v1.1.0")
+	assert.Contains(s.T(), remoteTags, s.headCommit()+"\trefs/tags/api/v1.1.1")
+	assert.Equal(s.T(), other+"\n", s.gitOutput("rev-list", "-n", "1", "api/v1.1.0"))
+}
+
+func (s *TaggingSuite) TestFetchTagsReplacesAStaleLocalTag() {
+	s.addRemote()
+	s.write("services/api/file.txt", "api change")
+	s.commit("feat: api change")
+	other := s.headCommit()
+	s.pushOtherRelease("api/v1.1.0", other)
+	s.write("services/api/file.txt", "api fix")
+	s.commit("fix: api fix")
+	// A failed push of an earlier run left its tag in the work tree.
+	s.git("tag", "api/v1.1.0")
+
+	outputs := s.runTagging(Config{
+		DryRun:      true,
+		OutputJson:  true,
+		FetchTags:   true,
+		Remote:      "origin",
+		Directories: []string{"services/api"},
+	})
+
+	assert.Equal(s.T(), other, outputs.LastReleaseGitHead)
+	assert.Equal(s.T(), "api/v1.1.1", outputs.NewReleaseGitTag)
+}
+
+func (s *TaggingSuite) TestFailedPushRestoresTheLocalTags() {
+	s.addRemote()
+	s.git("tag", "--annotate", "--message", "api/v1", "api/v1", "api/v1.0.0")
+	shortTag := s.gitOutput("rev-parse", "refs/tags/api/v1")
+	tagsBefore := s.gitOutput("tag", "--list")
+	s.write("services/api/file.txt", "api change")
+	s.commit("fix: api change")
+	// The remote can not make api/v1.0.1 next to a ref below that name.
+	s.pushOtherRelease("api/v1.0.1/blocker", s.headCommit())
+	config := Config{
+		OutputJson:    true,
+		Atomic:        true,
+		ShortVersions: true,
+		Remote:        "origin",
+		Branch:        "main",
+		Directories:   []string{"services/api"},
+	}
+
+	err := s.doTagging(config)
+
+	require.Error(s.T(), err)
+	assert.Equal(s.T(), tagsBefore, s.gitOutput("tag", "--list"))
+	assert.Equal(s.T(), shortTag, s.gitOutput("rev-parse", "refs/tags/api/v1"))
+
+	// A rerun in the same work tree makes the same release.
+	s.git("push", "-q", "origin", ":refs/tags/api/v1.0.1/blocker")
+	outputs := s.runTagging(config)
+	assert.Equal(s.T(), "api/v1.0.0", outputs.LastReleaseGitTag)
+	assert.Equal(s.T(), "api/v1.0.1", outputs.NewReleaseGitTag)
+}
+
+func (s *TaggingSuite) TestDetachedHeadStopsARelease() {
+	s.addRemote()
+	s.git("checkout", "-q", "--detach")
+	s.write("services/api/file.txt", "api change")
+	s.commit("fix: api change")
+
+	err := s.doTagging(Config{
+		Atomic:            true,
+		SkipShortVersions: true,
+		Remote:            "origin",
+		Branch:            "main",
+		Directories:       []string{"services/api"},
+	})
+
+	var mismatch *BranchMismatchError
+	require.ErrorAs(s.T(), err, &mismatch)
+	assert.Equal(s.T(), "main", mismatch.Branch)
+	assert.Equal(s.T(), s.headCommit(), mismatch.Head)
+	assert.NotContains(s.T(), s.gitOutput("tag", "--list"), "api/v1.0.1")
+	assert.Empty(s.T(), s.gitOutput("ls-remote", "origin"))
+}
+
+func (s *TaggingSuite) TestRequireCleanStopsADirtyRelease() {
+	s.addRemote()
+	s.write("services/api/file.txt", "api change")
+	s.commit("fix: api change")
+	s.write("services/api/notes.txt", "not committed")
+
+	err := s.doTagging(Config{
+		Atomic:            true,
+		SkipShortVersions: true,
+		Remote:            "origin",
+		Branch:            "main",
+		RequireClean:      true,
+		Directories:       []string{"services/api"},
+	})
+
+	var dirty *DirtyWorkTreeError
+	require.ErrorAs(s.T(), err, &dirty)
+	assert.Equal(s.T(), []string{"services/api/notes.txt"}, dirty.Paths)
+	assert.NotContains(s.T(), s.gitOutput("tag", "--list"), "api/v1.0.1")
+}
+
+func (s *TaggingSuite) TestRemoteBranchAheadStopsARelease() {
+	s.addRemote()
+	s.write("services/worker/file.txt", "worker change")
+	s.commit("fix: worker change")
+	remoteCommit := s.headCommit()
+	s.git("push", "-q", "origin", "main")
+	// The local branch drops the commit that the remote holds.
+	s.git("reset", "-q", "--hard", "HEAD~1")
+	s.write("services/api/file.txt", "api change")
+	s.commit("fix: api change")
+
+	err := s.doTagging(Config{
+		Atomic:            true,
+		SkipShortVersions: true,
+		Remote:            "origin",
+		Branch:            "main",
+		Directories:       []string{"services/api", "services/worker"},
+	})
+
+	var diverged *DivergedBranchError
+	require.ErrorAs(s.T(), err, &diverged)
+	assert.Equal(s.T(), "origin", diverged.Remote)
+	assert.Equal(s.T(), remoteCommit, diverged.RemoteCommit)
+	assert.NotContains(s.T(), s.gitOutput("ls-remote", "--tags", "origin"), "refs/tags/")
+}
+
+func (s *TaggingSuite) TestBreakingApprovalReadsTheCommitTrailer() {
+	s.write("services/api/file.txt", "api change")
+	s.commit("feat!: drop the v1 client\n\nBreaking-Approved-By: Jane Doe <jane@example.com>")
+	s.write("services/worker/file.txt", "worker change")
+	s.commit("feat!: drop the old queue")
+	config := Config{
+		DryRun:            true,
+		OutputJson:        true,
+		SkipShortVersions: true,
+		BreakingApproval:  true,
+		Directories:       []string{"services/api"},
+	}
+
+	outputs := s.runTagging(config)
+	assert.Equal(s.T(), "api/v2.0.0", outputs.NewReleaseGitTag)
+
+	config.Directories = []string{"services/api", "services/worker"}
+	err := s.doTagging(config)
+	var unapproved *UnapprovedBreakingError
+	require.ErrorAs(s.T(), err, &unapproved)
+	assert.Equal(s.T(), "worker", unapproved.Package)
+	assert.Equal(s.T(), "feat!: drop the old queue", unapproved.Commits[0].Subject)
+}
+
+func (s *TaggingSuite) TestRerunPushesTheReleaseThatHeadAlreadyHas() {
+	s.addRemote()
+	s.write("services/api/file.txt", "api change")
+	s.commit("feat: api change")
+	// An earlier run made the tag, but its push did not reach the remote.
+	s.git("tag", "api/v1.1.0")
+
+	outputs := s.runTagging(Config{
+		OutputJson:        true,
+		Atomic:            true,
+		SkipShortVersions: true,
+		Remote:            "origin",
+		Branch:            "main",
+		Directories:       []string{"services/api", "services/worker"},
+	})
+
+	assert.Equal(s.T(), "true,false", outputs.NewReleasePublished)
+	assert.Equal(s.T(), "true,false", outputs.NewReleaseAlreadyReleased)
+	assert.Equal(s.T(), "api/v1.1.0,worker/v2.0.0", outputs.NewReleaseGitTag)
+	assert.Equal(s.T(), "api/v1.0.0,worker/v2.0.0", outputs.LastReleaseGitTag)
+	assert.Equal(s.T(), "feat: api change", outputs.NewReleaseNotes)
+	assert.Contains(s.T(), s.gitOutput("ls-remote", "--tags", "origin"), s.headCommit()+"\trefs/tags/api/v1.1.0")
+}
+
+func (s *TaggingSuite) TestRemotesReportEachPush() {
+	s.addRemote()
+	mirrorDir := filepath.Join(s.T().TempDir(), "mirror.git")
+	s.git("init", "-q", "--bare", mirrorDir)
+	s.write("services/api/file.txt", "api change")
+	s.commit("fix: api change")
+
+	outputs := s.runTagging(Config{
+		OutputJson:        true,
+		Atomic:            true,
+		SkipShortVersions: true,
+		Branch:            "main",
+		Remotes:           []RemoteConfig{{Name: "origin"}, {Name: mirrorDir}, {Name: "missing"}},
+		MirrorFailure:     MirrorFailureWarn,
+		Directories:       []string{"services/api"},
+	})
+
+	assert.Equal(s.T(), "origin=pushed,"+mirrorDir+"=pushed,missing=failed", outputs.NewReleaseRemotePushes)
+	for _, remote := range []string{"origin", mirrorDir} {
+		assert.Contains(s.T(), s.gitOutput("ls-remote", "--tags", remote), "refs/tags/api/v1.0.1")
+	}
+}
+
+func (s *TaggingSuite) TestRemotesNeedUniqueNames() {
+	err := s.doTagging(Config{
+		DryRun:  true,
+		Remotes: []RemoteConfig{{Name: "origin"}, {Name: "origin"}},
+	})
+
+	require.ErrorContains(s.T(), err, "more than one time")
+}
+
+func TestForEachTargetGivesTheFirstErrorAndCancelsTheRest(t *testing.T) {
+	failure := fmt.Errorf("target failed")
+	var canceled atomic.Int32
+	err := forEachTarget(context.Background(), 2, 10, func(ctx context.Context, index int) error {
+		if index == 0 {
+			return failure
+		}
+		<-ctx.Done()
+		canceled.Add(1)
+		return ctx.Err()
+	})
+
+	require.ErrorIs(t, err, failure)
+	assert.Less(t, canceled.Load(), int32(10))
+}
+
+func TestForEachTargetRunsEveryTargetOnce(t *testing.T) {
+	counts := make([]atomic.Int32, 7)
+	err := forEachTarget(context.Background(), 3, len(counts), func(_ context.Context, index int) error {
+		counts[index].Add(1)
+		return nil
+	})
+
+	require.NoError(t, err)
+	for index := range counts {
+		assert.Equal(t, int32(1), counts[index].Load(), "target %d", index)
+	}
+}
+
+func (s *TaggingSuite) TestReleaseCommitTagsTheUpdatedFiles() {
+	remoteDir := s.addRemote()
+	s.write("services/api/VERSION", "1.0.0")
+	s.commit("chore: keep the api version")
+	s.write("services/api/file.txt", "api change")
+	s.commit("feat(api): add an endpoint")
+	config := Config{
+		OutputJson:        true,
+		Atomic:            true,
+		SkipShortVersions: true,
+		Remote:            "origin",
+		Branch:            "main",
+		ReleaseCommit:     true,
+		VersionFiles:      []VersionFile{{Path: "VERSION"}},
+		Directories:       []string{"services/api"},
+	}
+
+	outputs := s.runTagging(config)
+
+	head := s.headCommit()
+	assert.Equal(s.T(), "api/v1.1.0", outputs.NewReleaseGitTag)
+	assert.Equal(s.T(), head, outputs.NewReleaseGitHead)
+	assert.Equal(s.T(), "chore(release): api v1.1.0\n", s.gitOutput("log", "-1", "--format=%s"))
+	assert.Equal(s.T(), head+"\n", s.gitOutput("rev-list", "-n", "1", "api/v1.1.0"))
+	assert.Equal(s.T(), "services/api/CHANGELOG.md\nservices/api/VERSION\n", s.gitOutput("show", "--format=", "--name-only", "HEAD"))
+	content, err := os.ReadFile(filepath.Join(s.repoDir, "services/api/VERSION"))
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "1.1.0\n", string(content))
+	changelog, err := os.ReadFile(filepath.Join(s.repoDir, "services/api/CHANGELOG.md"))
+	require.NoError(s.T(), err)
+	assert.Contains(s.T(), string(changelog), "# api Changelog\n\n## 1.1.0 (")
+	assert.Contains(s.T(), string(changelog), "- **api:** add an endpoint (")
+	remoteMain := exec.Command("git", "--git-dir", remoteDir, "rev-parse", "refs/heads/main")
+	remoteHead, err := remoteMain.Output()
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), head, strings.TrimSpace(string(remoteHead)))
+	assert.Empty(s.T(), s.gitOutput("status", "--porcelain"))
+
+	// The release commit does not make another release.
+	outputs = s.runTagging(config)
+	assert.Equal(s.T(), "api/v1.1.0", outputs.NewReleaseGitTag)
+	assert.Equal(s.T(), head, s.headCommit())
+}
+
+func (s *TaggingSuite) TestFailedPushRemovesTheReleaseCommit() {
+	s.addRemote()
+	s.write("services/api/file.txt", "api change")
+	s.commit("fix: api change")
+	head := s.headCommit()
+	// The remote can not make api/v1.0.1 next to a ref below that name.
+	s.pushOtherRelease("api/v1.0.1/blocker", head)
+
+	err := s.doTagging(Config{
+		Atomic:            true,
+		SkipShortVersions: true,
+		Remote:            "origin",
+		Branch:            "main",
+		ReleaseCommit:     true,
+		Directories:       []string{"services/api"},
+	})
+
+	require.Error(s.T(), err)
+	assert.Equal(s.T(), head, s.headCommit())
+	assert.Equal(s.T(), head+"\n", s.gitOutput("rev-parse", "refs/heads/main"))
+	assert.NotContains(s.T(), s.gitOutput("tag", "--list"), "api/v1.0.1")
+	assert.Empty(s.T(), s.gitOutput("status", "--porcelain"))
+	assert.NoFileExists(s.T(), filepath.Join(s.repoDir, "services/api/CHANGELOG.md"))
+}
@@ -0,0 +1,182 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/catalystcommunity/app-utils-go/logging"
+)
+
+// TagTrust is the signature state of one version tag.
+type TagTrust string
+
+const (
+	// TagTrusted is a tag with a signature from a trusted signer.
+	TagTrusted TagTrust = "trusted"
+	// TagUntrusted is a signed tag whose signature does not verify against
+	// the trusted signers.
+	TagUntrusted TagTrust = "untrusted"
+	// TagUnsigned is a lightweight tag or an annotated tag without a
+	// signature.
+	TagUnsigned TagTrust = "unsigned"
+)
+
+// signatureVerifier checks version tags and commits against the trusted
+// signers, which are an SSH allowed-signers file or a GPG home directory.
+type signatureVerifier struct {
+	repo    Repository
+	signers string
+	// mu guards trust, because the targets of a run check tags at the same
+	// time.
+	mu    sync.Mutex
+	trust map[string]TagTrust
+}
+
+func newSignatureVerifier(repo Repository, trustedSigners string) (*signatureVerifier, error) {
+	if trustedSigners == "" {
+		return nil, nil
+	}
+	path, err := filepath.Abs(trustedSigners)
+	if err != nil {
+		return nil, fmt.Errorf("can not resolve the trusted signers %s: %w", trustedSigners, err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("can not read the trusted signers: %w", err)
+	}
+	return &signatureVerifier{repo: repo, signers: path, trust: map[string]TagTrust{}}, nil
+}
+
+// check gives the trust state of one tag. It reads each tag one time.
+func (v *signatureVerifier) check(ctx context.Context, tag string) (TagTrust, error) {
+	v.mu.Lock()
+	trust, found := v.trust[tag]
+	v.mu.Unlock()
+	if found {
+		return trust, nil
+	}
+	trust, err := v.repo.TagTrust(ctx, tag, v.signers)
+	if err != nil {
+		return "", err
+	}
+	v.mu.Lock()
+	v.trust[tag] = trust
+	v.mu.Unlock()
+	return trust, nil
+}
+
+// trusted tells if a version tag can be the base of a release. Without trusted
+// signers, every tag is trusted.
+func (v *signatureVerifier) trusted(ctx context.Context, tag string) (bool, error) {
+	if v == nil {
+		return true, nil
+	}
+	trust, err := v.check(ctx, tag)
+	if err != nil {
+		return false, err
+	}
+	if trust != TagTrusted {
+		logging.Log.Warn(fmt.Sprintf("Ignoring %s version tag %s", trust, tag))
+		return false, nil
+	}
+	return true, nil
+}
+
+const (
+	// SignedCommitsIgnore counts only commits with a trusted signature toward
+	// a release. The other commits stay in the release notes with a marker.
+	SignedCommitsIgnore = "ignore"
+	// SignedCommitsFail stops the run when a commit of a release has no
+	// trusted signature. The commands that only read, such as status, report
+	// the target as blocked at its last version instead.
+	SignedCommitsFail = "fail"
+)
+
+// unverifiedMarker follows the release note of a commit without a trusted
+// signature.
+const unverifiedMarker = " [unverified]"
+
+// UnverifiedCommitError is the error of a target with a commit that no
+// trusted signer signed, when SignedCommits is SignedCommitsFail. The analysis
+// gives it as the Blocked reason of the target, and DoTagging fails with it.
+type UnverifiedCommitError struct {
+	Package string
+	Commit  Commit
+}
+
+func (e *UnverifiedCommitError) Error() string {
+	return fmt.Sprintf("package %q: commit %s %q has no trusted signature", e.Package, e.Commit.Hash, e.Commit.Subject)
+}
+
+func validateSignedCommits(config Config) error {
+	switch config.SignedCommits {
+	case "":
+		return nil
+	case SignedCommitsIgnore, SignedCommitsFail:
+		if config.TrustedSigners == "" {
+			return fmt.Errorf("signed_commits needs trusted_signers to verify the commits")
+		}
+		return nil
+	default:
+		return fmt.Errorf("signed_commits %q is not %q or %q", config.SignedCommits, SignedCommitsIgnore, SignedCommitsFail)
+	}
+}
+
+// verifiedCommit tells if a trusted signer signed a commit. Only "G" counts:
+// with SSH, "U" is a good signature of a key that the allowed-signers file
+// does not list. The git backend turns a "U" signature of a key in a trusted
+// GPG home directory into "G".
+func verifiedCommit(commit Commit) bool {
+	return commit.Signature == "G"
+}
+
+// TagVerification is the trust state of one version tag of one target.
+type TagVerification struct {
+	Package string
+	Tag     string
+	Trust   TagTrust
+}
+
+// VerifyTags gives the trust state of every version tag of every release
+// target, in the output order of the targets and then the tag name order.
+func VerifyTags(ctx context.Context, config Config) ([]TagVerification, error) {
+	if config.TrustedSigners == "" {
+		return nil, fmt.Errorf("trusted_signers must name an SSH allowed-signers file or a GPG home directory")
+	}
+	results, run, err := prepareRun(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := run.loadTags(ctx); err != nil {
+		return nil, err
+	}
+
+	var verifications []TagVerification
+	for _, result := range results {
+		format, err := newTagFormat(result.TagFormat)
+		if err != nil {
+			return nil, err
+		}
+		names := append([]string{result.PackageName()}, result.TagAliases...)
+		for _, tag := range run.tags {
+			for _, name := range names {
+				if _, matches := format.parse(tag.Name, name); !matches {
+					continue
+				}
+				trust, err := run.verifier.check(ctx, tag.Name)
+				if err != nil {
+					return nil, err
+				}
+				verifications = append(verifications, TagVerification{
+					Package: result.PackageName(),
+					Tag:     tag.Name,
+					Trust:   trust,
+				})
+				break
+			}
+		}
+	}
+	return verifications, nil
+}